@@ -0,0 +1,136 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"errors"
+	"fmt"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmparser"
+)
+
+// ContractAbiVersionMethod optional contract export () -> i32 returning the sys_call abi version of its sdk.
+// without the export, the abi_version of the sdk metadata custom section is used, then AbiVersion1
+const ContractAbiVersionMethod = "abi_version"
+
+// abiVersionGasLimit the gas of the abi_version export, run when the pool is created out of any transaction.
+// the export returns a constant, the limit stops a contract doing more
+const abiVersionGasLimit = 10000
+
+// AbiVersion the version of the sys_call protocol between the contract sdk and the runtime
+type AbiVersion int32
+
+const (
+	// AbiVersion1 sdks before abi versioning: the chainmaker sys_calls, "Len" results matched by the request
+	AbiVersion1 AbiVersion = 1
+	// AbiVersion2 adds result handles, leveled logs, the call stack, gas caps of cross contract calls
+	// and the error codes of the failures
+	AbiVersion2 AbiVersion = 2
+
+	minAbiVersion = AbiVersion1
+	maxAbiVersion = AbiVersion2
+)
+
+// abiBehaviour the sys_call behaviour of an abi version
+type abiBehaviour struct {
+	version AbiVersion
+	// "Len" sys_calls write a handle the fetch presents
+	resultHandles bool
+	// cross contract calls accept a gas cap
+	gasCaps bool
+	// a failure is saved in ContractResult.Code by its ErrorCode, otherwise by ErrorCodeContract,
+	// the code of every failure before they were classified
+	errorCodes bool
+	// sys_call methods added to the chainmaker ones
+	extensions map[string]bool
+}
+
+// extensionMethods the sys_call methods not supported by every abi version
+var extensionMethods = map[string]bool{
+	ContractMethodLogMessageLevel: true,
+	ContractMethodGetCallStackLen: true,
+	ContractMethodGetCallStack:    true,
+}
+
+// abiBehaviours the compatibility matrix, abi version -> sys_call behaviour
+var abiBehaviours = map[AbiVersion]*abiBehaviour{
+	AbiVersion1: {
+		version: AbiVersion1,
+	},
+	AbiVersion2: {
+		version:       AbiVersion2,
+		resultHandles: true,
+		gasCaps:       true,
+		errorCodes:    true,
+		extensions:    extensionMethods,
+	},
+}
+
+// supports whether the sys_call method is available to the abi version
+func (b *abiBehaviour) supports(method string) bool {
+	return !extensionMethods[method] || b.extensions[method]
+}
+
+// resultCode the ContractResult.Code of a failure of the code
+func (b *abiBehaviour) resultCode(code ErrorCode) uint32 {
+	if b.errorCodes || code == ErrorCodeSuccess {
+		return uint32(code)
+	}
+	return uint32(ErrorCodeContract)
+}
+
+// selectAbi return the sys_call behaviour of the abi version, unsupported versions are rejected
+func selectAbi(version AbiVersion) (*abiBehaviour, error) {
+	behaviour, ok := abiBehaviours[version]
+	if !ok {
+		return nil, newContractError(ErrorCodeAbiUnsupported,
+			"contract sdk abi version %d is not supported, the runtime supports %d to %d",
+			version, minAbiVersion, maxAbiVersion)
+	}
+	return behaviour, nil
+}
+
+// readAbiVersion return the abi version declared by the contract export or sdk metadata
+func readAbiVersion(instance InstanceHandle, byteCode []byte) (AbiVersion, error) {
+	if instance.HasExport(ContractAbiVersionMethod) {
+		// the export runs out of any transaction, the sys_calls it makes are rejected
+		sc := NewSimContext(ContractAbiVersionMethod, log, "")
+		defer sc.removeCtxPointer()
+		sc.Contract = &commonPb.Contract{}
+		sc.ContractResult = &commonPb.ContractResult{}
+		instance.SetContextData(sc.CtxPtr)
+		instance.SetGasUsed(0)
+		instance.SetGasLimit(abiVersionGasLimit)
+		version, err := instance.Call(ContractAbiVersionMethod)
+		if err == nil && sc.ContractResult.Code != uint32(ErrorCodeSuccess) {
+			err = errors.New(sc.ContractResult.Message)
+		}
+		if err == nil && instance.GetGasUsed() > abiVersionGasLimit {
+			err = fmt.Errorf("out of gas %d/%d", instance.GetGasUsed(), abiVersionGasLimit)
+		}
+		if err != nil {
+			return 0, newContractError(ErrorCodeTrap, "%s invoke failed, %s", ContractAbiVersionMethod, err.Error())
+		}
+		return AbiVersion(version), nil
+	}
+
+	// byte code the wasmer accepts but the parser does not is treated as having no metadata
+	module, err := wasmparser.Parse(byteCode)
+	if err != nil {
+		return AbiVersion1, nil
+	}
+	metadata, err := module.SDKMetadata()
+	if err != nil {
+		return 0, newContractError(ErrorCodeBytecodeInvalid, "%s", err.Error())
+	}
+	if metadata == nil || metadata.AbiVersion == 0 {
+		return AbiVersion1, nil
+	}
+	return AbiVersion(metadata.AbiVersion), nil
+}
@@ -0,0 +1,168 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"strings"
+	"testing"
+
+	"chainmaker.org/chainmaker/common/v2/serialize"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmparser"
+)
+
+// sdkModule an empty wasm module with the sdk metadata section
+func sdkModule(metadata string) []byte {
+	name := wasmparser.SDKSection
+	section := append([]byte{byte(len(name))}, name...)
+	section = append(section, metadata...)
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x00, byte(len(section))}
+	return append(module, section...)
+}
+
+func TestAbiCompatibilityMatrix(t *testing.T) {
+	cases := []struct {
+		version AbiVersion
+		method  string
+		expect  bool
+	}{
+		{AbiVersion1, protocol.ContractMethodPutState, true},
+		{AbiVersion1, ContractMethodLogMessageLevel, false},
+		{AbiVersion1, ContractMethodGetCallStack, false},
+		{AbiVersion2, protocol.ContractMethodPutState, true},
+		{AbiVersion2, ContractMethodLogMessageLevel, true},
+		{AbiVersion2, ContractMethodGetCallStackLen, true},
+	}
+	for _, c := range cases {
+		behaviour, err := selectAbi(c.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if supported := behaviour.supports(c.method); supported != c.expect {
+			t.Errorf("abi version %d supports %s: expected %v, got %v", c.version, c.method, c.expect, supported)
+		}
+	}
+	if v1, v2 := abiBehaviours[AbiVersion1], abiBehaviours[AbiVersion2]; v1.resultHandles || v1.gasCaps ||
+		!v2.resultHandles || !v2.gasCaps {
+		t.Error("expected result handles and gas caps from abi version 2 only")
+	}
+}
+
+func TestUnsupportedAbiVersion(t *testing.T) {
+	for _, version := range []AbiVersion{0, maxAbiVersion + 1, -1} {
+		if _, err := selectAbi(version); classifyError(err).Code != ErrorCodeAbiUnsupported {
+			t.Errorf("expected abi version %d to be rejected, got %v", version, err)
+		}
+	}
+
+	engine := newFakeEngine()
+	byteCode := engine.contract("future", map[string]fakeExport{
+		ContractAbiVersionMethod: func(*fakeInstance, ...int32) (int32, error) {
+			return int32(maxAbiVersion + 1), nil
+		},
+	})
+	_, err := newVmPool(engine, &commonPb.Contract{Name: "future", Version: "1.0"}, byteCode, log)
+	if code := classifyError(err).Code; code != ErrorCodeAbiUnsupported {
+		t.Errorf("expected the pool of an unsupported abi version to be rejected, got %d, %v", code, err)
+	}
+}
+
+func TestReadAbiVersion(t *testing.T) {
+	engine := newFakeEngine()
+	engine.contract("export", map[string]fakeExport{
+		ContractAbiVersionMethod: func(*fakeInstance, ...int32) (int32, error) {
+			return int32(AbiVersion2), nil
+		},
+	})
+	engine.contract("greedy", map[string]fakeExport{
+		ContractAbiVersionMethod: func(instance *fakeInstance, args ...int32) (int32, error) {
+			instance.gasUsed = instance.gasLimit + 1
+			return int32(AbiVersion2), nil
+		},
+	})
+	engine.contract("metadata", nil)
+	instantiate := func(name string) *fakeInstance {
+		module, _ := engine.Compile([]byte(name))
+		instance, _ := module.Instantiate()
+		return instance.(*fakeInstance)
+	}
+
+	instance := instantiate("export")
+	version, err := readAbiVersion(instance, nil)
+	if err != nil || version != AbiVersion2 || instance.gasLimit != abiVersionGasLimit {
+		t.Errorf("expected the version of the export run with a small gas limit, got %d, %v, gas limit %d",
+			version, err, instance.gasLimit)
+	}
+	if _, err = readAbiVersion(instantiate("greedy"), nil); err == nil {
+		t.Error("expected the abi_version export exceeding its gas limit to fail")
+	}
+
+	for metadata, expect := range map[string]AbiVersion{
+		`{"name":"rust","abi_version":2}`: AbiVersion2,
+		`{"name":"rust"}`:                 AbiVersion1,
+	} {
+		version, err = readAbiVersion(instantiate("metadata"), sdkModule(metadata))
+		if err != nil || version != expect {
+			t.Errorf("metadata %s: expected abi version %d, got %d, %v", metadata, expect, version, err)
+		}
+	}
+	if _, err = readAbiVersion(instantiate("metadata"), sdkModule("{")); err == nil {
+		t.Error("expected invalid sdk metadata to be rejected")
+	}
+}
+
+func TestSysCallOfAbiVersionExport(t *testing.T) {
+	engine := newFakeEngine()
+	engine.contract("logging", map[string]fakeExport{
+		ContractAbiVersionMethod: func(instance *fakeInstance, args ...int32) (int32, error) {
+			header := serialize.NewEasyCodec()
+			header.AddValue(serialize.EasyKeyType_SYSTEM, "ctx_ptr", serialize.EasyValueType_INT32, instance.ctxPtr)
+			header.AddValue(serialize.EasyKeyType_SYSTEM, "method", serialize.EasyValueType_STRING,
+				protocol.ContractMethodLogMessage)
+			request := header.Marshal()
+			instance.memory = make([]byte, len(request))
+			copy(instance.memory, request)
+			if ret := handleSysCall(instance.Memory(), 0, int32(len(request)), 0, 0); ret !=
+				protocol.ContractSdkSignalResultFail {
+				t.Error("expected the sys_call out of a transaction to fail")
+			}
+			return int32(AbiVersion2), nil
+		},
+	})
+	module, _ := engine.Compile([]byte("logging"))
+	instance, _ := module.Instantiate()
+	if _, err := readAbiVersion(instance, nil); err == nil {
+		t.Error("expected the abi_version export making a sys_call to be rejected")
+	}
+
+	// a sys_call of no context fails
+	if ret := handleSysCall(instance.Memory(), 0, int32(len(instance.(*fakeInstance).memory)), 0, 0); ret !=
+		protocol.ContractSdkSignalResultFail {
+		t.Error("expected the sys_call of a removed context to fail")
+	}
+}
+
+func TestSysCallGatedByAbiVersion(t *testing.T) {
+	sc := NewSimContext("increase", log, "chain1")
+	defer sc.removeCtxPointer()
+	sc.abi = abiBehaviours[AbiVersion1]
+	sc.TxSimContext = newKvTxContext()
+	sc.Contract = &commonPb.Contract{Name: "counter"}
+	sc.ContractResult = &commonPb.ContractResult{}
+
+	waci := &WaciInstance{Sc: sc}
+	if ret := waci.invoke(ContractMethodLogMessageLevel); ret != protocol.ContractSdkSignalResultFail {
+		t.Fatalf("expected the sys_call of abi version 2 to fail for an abi version 1 contract")
+	}
+	// the failure is saved by the code of the contract sdks before error codes
+	if sc.ContractResult.Code != uint32(ErrorCodeContract) ||
+		!strings.HasPrefix(sc.ContractResult.Message, ErrorCodeSyscall.String()+": ") {
+		t.Errorf("expected a sys_call error, got %d, %s", sc.ContractResult.Code, sc.ContractResult.Message)
+	}
+}
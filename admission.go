@@ -0,0 +1,268 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"fmt"
+	"strings"
+
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmparser"
+)
+
+const (
+	// the max size of contract byte code
+	defaultMaxBytecodeSize = 8 * 1024 * 1024
+	// the max memory pages declared by a contract, 64KiB per page
+	defaultMaxMemoryPages = 1024
+	// the max functions defined by a contract
+	defaultMaxFunctions = 20000
+	// the max tables defined by a contract
+	defaultMaxTables = 1
+	// the max globals defined by a contract
+	defaultMaxGlobals = 1024
+)
+
+// NondeterminismAction what the admission does with a non deterministic feature used by the byte code
+type NondeterminismAction int
+
+const (
+	// the feature is not checked
+	NondeterminismAllow NondeterminismAction = iota
+	// every use of the feature is reported as a warning
+	NondeterminismReport
+	// every use of the feature is a violation
+	NondeterminismReject
+)
+
+// AdmissionPolicy the limits of contract byte code checked at install and upgrade, a limit of 0 means unlimited
+type AdmissionPolicy struct {
+	MaxBytecodeSize int
+	// max initial and max memory pages of every memory
+	MaxMemoryPages uint32
+	MaxFunctions   int
+	MaxTables      int
+	MaxGlobals     int
+	// functions the contract must export
+	RequiredExports []string
+	// import namespace -> function names the contract may import, nil allows any import
+	AllowedImports map[string][]string
+	// allow the module to declare a start function, run at every instantiation
+	AllowStart bool
+	// non deterministic feature -> the action on its uses, features not in the map are allowed
+	Nondeterminism map[wasmparser.Feature]NondeterminismAction
+}
+
+// DefaultAdmissionPolicy return the admission policy of DefaultRuntimeConfig,
+// the allowed imports are the host functions of the runtime
+func DefaultAdmissionPolicy() *AdmissionPolicy {
+	return &AdmissionPolicy{
+		MaxBytecodeSize: defaultMaxBytecodeSize,
+		MaxMemoryPages:  defaultMaxMemoryPages,
+		MaxFunctions:    defaultMaxFunctions,
+		MaxTables:       defaultMaxTables,
+		MaxGlobals:      defaultMaxGlobals,
+		RequiredExports: []string{
+			protocol.ContractRuntimeTypeMethod,
+			protocol.ContractAllocateMethod,
+			protocol.ContractDeallocateMethod,
+		},
+		AllowedImports: map[string][]string{
+			"env":                    {"sys_call", "log_message"},
+			"wasi_unstable":          {"fd_write", "fd_read", "fd_close", "fd_seek"},
+			"wasi_snapshot_preview1": {"proc_exit"},
+		},
+		// the float code of existing contracts, e.g. from formatting, is reported only
+		Nondeterminism: map[wasmparser.Feature]NondeterminismAction{
+			wasmparser.FeatureFloat:   NondeterminismReport,
+			wasmparser.FeatureSIMD:    NondeterminismReject,
+			wasmparser.FeatureThreads: NondeterminismReject,
+		},
+	}
+}
+
+// AdmissionReport the violations found by the admission checks, warnings do not reject the byte code
+type AdmissionReport struct {
+	Violations []string
+	Warnings   []string
+}
+
+// Violationf add a violation to the report
+func (r *AdmissionReport) Violationf(format string, args ...interface{}) {
+	r.Violations = append(r.Violations, fmt.Sprintf(format, args...))
+}
+
+// Warnf add a warning to the report
+func (r *AdmissionReport) Warnf(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Err return an error listing every violation, nil if the byte code is admitted
+func (r *AdmissionReport) Err() error {
+	if len(r.Violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("byte code rejected, %d violations: %s", len(r.Violations), strings.Join(r.Violations, "; "))
+}
+
+// AdmissionCheck a check of the contract byte code, it adds the violations found to the report
+type AdmissionCheck func(byteCode []byte, module *wasmparser.Module, report *AdmissionReport)
+
+// AdmissionPipeline the checks run on contract byte code before its vm pool is created
+type AdmissionPipeline struct {
+	checks []AdmissionCheck
+}
+
+// NewAdmissionPipeline return a pipeline running the checks in order
+func NewAdmissionPipeline(checks ...AdmissionCheck) *AdmissionPipeline {
+	return &AdmissionPipeline{checks: checks}
+}
+
+// Use append checks to the pipeline
+func (p *AdmissionPipeline) Use(checks ...AdmissionCheck) {
+	p.checks = append(p.checks, checks...)
+}
+
+// Run all checks on the byte code, every check runs even if an earlier one found violations
+func (p *AdmissionPipeline) Run(byteCode []byte) *AdmissionReport {
+	report := &AdmissionReport{}
+	module, err := wasmparser.Parse(byteCode)
+	if err != nil {
+		report.Violationf("invalid wasm module, %s", err.Error())
+		return report
+	}
+	for _, check := range p.checks {
+		check(byteCode, module, report)
+	}
+	return report
+}
+
+// Checks return the admission checks enforcing the policy
+func (p *AdmissionPolicy) Checks() []AdmissionCheck {
+	return []AdmissionCheck{
+		p.checkSize,
+		p.checkMemory,
+		p.checkCounts,
+		p.checkExports,
+		p.checkImports,
+		p.checkStart,
+		p.checkNondeterminism,
+	}
+}
+
+func (p *AdmissionPolicy) checkSize(byteCode []byte, module *wasmparser.Module, report *AdmissionReport) {
+	if p.MaxBytecodeSize > 0 && len(byteCode) > p.MaxBytecodeSize {
+		report.Violationf("byte code size %d exceeds the limit %d", len(byteCode), p.MaxBytecodeSize)
+	}
+}
+
+func (p *AdmissionPolicy) checkMemory(byteCode []byte, module *wasmparser.Module, report *AdmissionReport) {
+	if p.MaxMemoryPages == 0 {
+		return
+	}
+	for i, memory := range module.Memories {
+		if memory.Min > p.MaxMemoryPages {
+			report.Violationf("memory %d declares %d initial pages, exceeds the limit %d",
+				i, memory.Min, p.MaxMemoryPages)
+		}
+		if memory.HasMax && memory.Max > p.MaxMemoryPages {
+			report.Violationf("memory %d declares %d max pages, exceeds the limit %d",
+				i, memory.Max, p.MaxMemoryPages)
+		}
+	}
+}
+
+func (p *AdmissionPolicy) checkCounts(byteCode []byte, module *wasmparser.Module, report *AdmissionReport) {
+	limits := []struct {
+		name  string
+		count int
+		limit int
+	}{
+		{"functions", len(module.Functions) + module.ImportedCount(wasmparser.KindFunction), p.MaxFunctions},
+		{"tables", len(module.Tables) + module.ImportedCount(wasmparser.KindTable), p.MaxTables},
+		{"globals", len(module.Globals) + module.ImportedCount(wasmparser.KindGlobal), p.MaxGlobals},
+	}
+	for _, l := range limits {
+		if l.limit > 0 && l.count > l.limit {
+			report.Violationf("%d %s exceeds the limit %d", l.count, l.name, l.limit)
+		}
+	}
+}
+
+func (p *AdmissionPolicy) checkExports(byteCode []byte, module *wasmparser.Module, report *AdmissionReport) {
+	for _, name := range p.RequiredExports {
+		export, ok := module.Export(name)
+		if !ok {
+			report.Violationf("required export [%s] is missing", name)
+		} else if export.Kind != wasmparser.KindFunction {
+			report.Violationf("required export [%s] is a %s, expect a function", name, export.Kind)
+		}
+	}
+}
+
+func (p *AdmissionPolicy) checkImports(byteCode []byte, module *wasmparser.Module, report *AdmissionReport) {
+	if p.AllowedImports == nil {
+		return
+	}
+	for _, imp := range module.Imports {
+		if !p.importAllowed(imp) {
+			report.Violationf("import [%s.%s] (%s) is not allowed", imp.Module, imp.Name, imp.Kind)
+		}
+	}
+}
+
+func (p *AdmissionPolicy) importAllowed(imp wasmparser.Import) bool {
+	if imp.Kind != wasmparser.KindFunction {
+		return false
+	}
+	for _, name := range p.AllowedImports[imp.Module] {
+		if name == imp.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *AdmissionPolicy) checkStart(byteCode []byte, module *wasmparser.Module, report *AdmissionReport) {
+	if !p.AllowStart && module.HasStart {
+		report.Violationf("start function is not allowed")
+	}
+}
+
+func (p *AdmissionPolicy) checkNondeterminism(byteCode []byte, module *wasmparser.Module, report *AdmissionReport) {
+	scan := false
+	for _, action := range p.Nondeterminism {
+		scan = scan || action != NondeterminismAllow
+	}
+	if !scan {
+		return
+	}
+	findings, err := module.ScanCode(byteCode)
+	if err != nil {
+		report.Violationf("scan code failed, %s", err.Error())
+		return
+	}
+	// the reported uses are summarized by feature, the rejected ones are listed
+	reported := make(map[wasmparser.Feature][]wasmparser.Finding)
+	var features []wasmparser.Feature
+	for _, finding := range findings {
+		switch p.Nondeterminism[finding.Feature] {
+		case NondeterminismReport:
+			if len(reported[finding.Feature]) == 0 {
+				features = append(features, finding.Feature)
+			}
+			reported[finding.Feature] = append(reported[finding.Feature], finding)
+		case NondeterminismReject:
+			report.Violationf("non deterministic %s", finding)
+		}
+	}
+	for _, feature := range features {
+		uses := reported[feature]
+		report.Warnf("%d non deterministic %s uses, the first is %s", len(uses), feature, uses[0])
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmparser"
+)
+
+// symbols the debug info of a contract, read once at pool creation to symbolize the traps of the contract
+type symbols struct {
+	byteCode []byte
+	module   *wasmparser.Module
+	// function names of the name section, nil without a name section
+	names *wasmparser.Names
+	// DWARF line table, nil without DWARF debug info
+	lines *wasmparser.Lines
+	// offset of the content of the code section, the origin of DWARF addresses
+	codeOffset int
+}
+
+// newSymbols read the name section and the DWARF debug info of the byte code
+func newSymbols(byteCode []byte) (*symbols, error) {
+	module, err := wasmparser.Parse(byteCode)
+	if err != nil {
+		return nil, err
+	}
+	s := &symbols{byteCode: byteCode, module: module}
+	for _, section := range module.Sections {
+		if section.ID == wasmparser.SectionCode {
+			s.codeOffset = section.Offset
+		}
+	}
+	if s.names, err = module.Names(); err != nil {
+		return nil, err
+	}
+	if s.lines, err = module.Lines(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// guestFrame a wasm frame reported in a trap message, -1 for what the message does not report
+type guestFrame struct {
+	function int
+	// offset in the module
+	offset int
+}
+
+var (
+	// "<module>[12]:0x1a2b", the frames of the wasmer 1.x traces
+	traceFramePattern = regexp.MustCompile(`\[(\d+)\]:0x([0-9a-fA-F]+)`)
+	// "wasm function 12", "function index 12"
+	functionPattern = regexp.MustCompile(`(?:wasm function|function index) (\d+)`)
+	// "at offset 6699"
+	offsetPattern = regexp.MustCompile(`at offset (\d+)`)
+)
+
+// parseGuestFrames read the wasm frames of a trap message, innermost first, nil if the message reports none
+func parseGuestFrames(message string) []guestFrame {
+	var frames []guestFrame
+	for _, match := range traceFramePattern.FindAllStringSubmatch(message, -1) {
+		function, _ := strconv.Atoi(match[1])
+		offset, err := strconv.ParseInt(match[2], 16, 64)
+		if err != nil {
+			offset = -1
+		}
+		frames = append(frames, guestFrame{function: function, offset: int(offset)})
+	}
+	if len(frames) > 0 {
+		return frames
+	}
+	frame := guestFrame{function: -1, offset: -1}
+	if match := functionPattern.FindStringSubmatch(message); match != nil {
+		frame.function, _ = strconv.Atoi(match[1])
+	}
+	if match := offsetPattern.FindStringSubmatch(message); match != nil {
+		frame.offset, _ = strconv.Atoi(match[1])
+	}
+	if frame.function < 0 && frame.offset < 0 {
+		return nil
+	}
+	return []guestFrame{frame}
+}
+
+// symbolize describe the wasm frame by its function name and source location
+func (s *symbols) symbolize(frame guestFrame) string {
+	if frame.function < 0 && frame.offset >= 0 && s != nil {
+		if function, ok := s.module.FunctionAt(s.byteCode, frame.offset); ok {
+			frame.function = function
+		}
+	}
+	var b strings.Builder
+	if frame.function < 0 {
+		b.WriteString("<unknown function>")
+	} else if s != nil {
+		b.WriteString(s.names.Function(uint32(frame.function)))
+	} else {
+		fmt.Fprintf(&b, "function[%d]", frame.function)
+	}
+	if frame.offset < 0 {
+		return b.String()
+	}
+	if s != nil && frame.offset >= s.codeOffset {
+		if line, ok := s.lines.At(uint64(frame.offset - s.codeOffset)); ok {
+			fmt.Fprintf(&b, " at %s", line)
+		}
+	}
+	fmt.Fprintf(&b, " (wasm offset 0x%x)", frame.offset)
+	return b.String()
+}
+
+// entryFrame the frame of the exported function called by the runtime, located at its first instruction
+func (s *symbols) entryFrame(entry string) (guestFrame, bool) {
+	if s == nil {
+		return guestFrame{}, false
+	}
+	export, ok := s.module.Export(entry)
+	if !ok || export.Kind != wasmparser.KindFunction {
+		return guestFrame{}, false
+	}
+	frame := guestFrame{function: int(export.Index), offset: -1}
+	if offset, ok := s.module.FunctionBody(s.byteCode, frame.function); ok {
+		frame.offset = offset
+	}
+	return frame, true
+}
+
+// backtrace the symbolized wasm frames of the trap message followed by the contract call stack, innermost first.
+// the bundled libwasmer reports no frame for most traps, the trap is then located in the exported function entry
+// called by the runtime, the trapping instruction is in this function or in a function it calls
+func (s *symbols) backtrace(message string, entry string, frames []*callFrame) string {
+	var b strings.Builder
+	b.WriteString("backtrace:")
+	nth := 0
+	guestFrames := parseGuestFrames(message)
+	for _, frame := range guestFrames {
+		fmt.Fprintf(&b, "\n  #%d %s", nth, s.symbolize(frame))
+		nth++
+	}
+	if len(guestFrames) == 0 {
+		if frame, ok := s.entryFrame(entry); ok {
+			fmt.Fprintf(&b, "\n  #%d in %s, exported function entry", nth, s.symbolize(frame))
+			nth++
+		}
+	}
+	for i := len(frames) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "\n  #%d contract %s.%s, depth %d", nth, frames[i].ContractName, frames[i].Method, frames[i].Depth)
+		nth++
+	}
+	return b.String()
+}
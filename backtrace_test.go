@@ -0,0 +1,97 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// debugSymbols the symbols of wasmparser/testdata/debug.wasm, whose invoke function traps at offset 9
+// of the code section content, located at /src/lib.rs:8:9
+func debugSymbols(t *testing.T) *symbols {
+	byteCode, err := ioutil.ReadFile("wasmparser/testdata/debug.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newSymbols(byteCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.names == nil || s.lines == nil {
+		t.Fatal("expect the name section and the line table")
+	}
+	return s
+}
+
+func TestParseGuestFrames(t *testing.T) {
+	expect := map[string][]guestFrame{
+		"RuntimeError: unreachable\n    at <module>[2]:0x4c\n    at <module>[1]:0x43": {{2, 0x4c}, {1, 0x43}},
+		"unreachable in wasm function 2 at offset 76":                                 {{2, 76}},
+		"trap at offset 76":         {{-1, 76}},
+		"wasm function 2 trapped":   {{2, -1}},
+		"RuntimeError: unreachable": nil,
+	}
+	for message, frames := range expect {
+		if got := parseGuestFrames(message); !reflect.DeepEqual(got, frames) {
+			t.Errorf("%q expect frames %v, but got %v", message, frames, got)
+		}
+	}
+}
+
+func TestSymbolize(t *testing.T) {
+	s := debugSymbols(t)
+	trap := s.codeOffset + 9
+
+	expect := map[guestFrame]string{
+		{2, trap}:  fmt.Sprintf("invoke at /src/lib.rs:8:9 (wasm offset 0x%x)", trap),
+		{-1, trap}: fmt.Sprintf("invoke at /src/lib.rs:8:9 (wasm offset 0x%x)", trap),
+		{0, -1}:    "sys_call",
+		{-1, 0}:    "<unknown function> (wasm offset 0x0)",
+	}
+	for frame, symbolized := range expect {
+		if got := s.symbolize(frame); got != symbolized {
+			t.Errorf("frame %v expect %q, but got %q", frame, symbolized, got)
+		}
+	}
+	if got := (*symbols)(nil).symbolize(guestFrame{2, trap}); got != fmt.Sprintf("function[2] (wasm offset 0x%x)", trap) {
+		t.Errorf("expect the function index without symbols, but got %q", got)
+	}
+}
+
+func TestBacktrace(t *testing.T) {
+	s := debugSymbols(t)
+	frames := []*callFrame{
+		{ContractName: "caller", Method: "call", Depth: 0},
+		{ContractName: "callee", Method: "invoke", Depth: 1},
+	}
+
+	// the frames of the message come first
+	backtrace := s.backtrace(fmt.Sprintf("unreachable\n    at <module>[2]:0x%x", s.codeOffset+9), "invoke", frames)
+	expect := fmt.Sprintf("backtrace:\n  #0 invoke at /src/lib.rs:8:9 (wasm offset 0x%x)\n"+
+		"  #1 contract callee.invoke, depth 1\n  #2 contract caller.call, depth 0", s.codeOffset+9)
+	if backtrace != expect {
+		t.Errorf("expect\n%s\nbut got\n%s", expect, backtrace)
+	}
+
+	// without frames in the message, the trap is located in the exported function called
+	backtrace = s.backtrace("RuntimeError: unreachable", "invoke", frames)
+	expect = fmt.Sprintf("#0 in invoke at /src/lib.rs:8:9 (wasm offset 0x%x), exported function entry", s.codeOffset+9)
+	if !strings.Contains(backtrace, expect) || !strings.Contains(backtrace, "#1 contract callee.invoke") {
+		t.Errorf("expect the entry frame, but got\n%s", backtrace)
+	}
+
+	// without symbols, only the contract call stack
+	backtrace = (*symbols)(nil).backtrace("RuntimeError: unreachable", "invoke", frames)
+	if backtrace != "backtrace:\n  #0 contract callee.invoke, depth 1\n  #1 contract caller.call, depth 0" {
+		t.Errorf("expect the contract call stack, but got\n%s", backtrace)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"fmt"
+	"strconv"
+
+	"chainmaker.org/chainmaker/common/v2/serialize"
+)
+
+// CallContractGasLimitKey optional CallContract request field, the max gas the callee may use as a decimal string.
+// a callee running out of its gas cap fails alone, the caller receives a fail signal and keeps running
+const CallContractGasLimitKey = "gas_limit"
+
+// calleeGas the gas used by a finished cross contract call
+type calleeGas struct {
+	// no more than the gas cap of the callee
+	gasUsed uint64
+	// the callee ran out of the gas cap given by its caller
+	outOfGas bool
+}
+
+// setCalleeGasCap save the gas cap of the cross contract call about to be made by the current frame
+func (s *callStack) setCalleeGasCap(requestBody []byte) error {
+	caller := s.frames[len(s.frames)-1]
+	caller.calleeGasCap = 0
+	caller.callee = nil
+	gasLimit, err := serialize.NewEasyCodecWithBytes(requestBody).GetString(CallContractGasLimitKey)
+	if err != nil || gasLimit == "" {
+		return nil
+	}
+	gasCap, err := strconv.ParseUint(gasLimit, 10, 64)
+	if err != nil || gasCap == 0 {
+		return fmt.Errorf("invalid %s [%s], expect a positive integer", CallContractGasLimitKey, gasLimit)
+	}
+	caller.calleeGasCap = gasCap
+	return nil
+}
+
+// limitGas return the gas limit of the frame just pushed: txGasLimit for the top level call,
+// otherwise the limit of its caller, lowered to the gas cap given by the caller
+func (s *callStack) limitGas(frame *callFrame, gasUsed uint64, txGasLimit uint64) uint64 {
+	frame.gasLimit = txGasLimit
+	if len(s.frames) < 2 {
+		return frame.gasLimit
+	}
+	caller := s.frames[len(s.frames)-2]
+	frame.gasLimit = caller.gasLimit
+	if caller.calleeGasCap > 0 && gasUsed < caller.gasLimit && caller.calleeGasCap < caller.gasLimit-gasUsed {
+		frame.gasLimit = gasUsed + caller.calleeGasCap
+		frame.gasCapped = true
+	}
+	caller.calleeGasCap = 0
+	return frame.gasLimit
+}
+
+// finishGas report the gas used by the frame to its caller, must be called before the frame is popped
+func (s *callStack) finishGas(frame *callFrame, gasUsed uint64) {
+	if len(s.frames) < 2 {
+		return
+	}
+	callee := &calleeGas{gasUsed: gasUsed}
+	if frame.gasCapped && gasUsed > frame.gasLimit {
+		// the caller is charged by the cap it gave, not by the overshoot of the last metered block
+		callee.gasUsed = frame.gasLimit
+		callee.outOfGas = true
+	}
+	s.frames[len(s.frames)-2].callee = callee
+}
+
+// takeCalleeGas return the gas used by the last cross contract call of the current frame,
+// nil if the call did not reach the callee
+func (s *callStack) takeCalleeGas() *calleeGas {
+	caller := s.frames[len(s.frames)-1]
+	callee := caller.callee
+	caller.calleeGasCap = 0
+	caller.callee = nil
+	return callee
+}
@@ -0,0 +1,113 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	"chainmaker.org/chainmaker/common/v2/serialize"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/vm/v2"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go/wasmertypes"
+)
+
+func TestCalleeChargedNoMoreThanItsCap(t *testing.T) {
+	stack := getCallStack(newKvTxContext())
+	stack.push(&callFrame{ContractName: "A"})
+	defer stack.pop()
+	caller := stack.frames[0]
+	stack.limitGas(caller, 0, 1000)
+	caller.calleeGasCap = 100
+
+	callee := &callFrame{ContractName: "B", Depth: 1}
+	stack.push(callee)
+	if limit := stack.limitGas(callee, 300, 1000); limit != 400 {
+		t.Fatalf("expected the callee limited to 300+100, got %d", limit)
+	}
+	// the last metered block of the callee overshoots its cap
+	stack.finishGas(callee, 450)
+	stack.pop()
+
+	gas := stack.takeCalleeGas()
+	if gas == nil || !gas.outOfGas || gas.gasUsed != 400 {
+		t.Fatalf("expected the callee out of gas and charged by its cap, got %+v", gas)
+	}
+}
+
+// outOfGasWacsi Wacsi whose cross contract calls run a callee out of the gas cap given by its caller
+type outOfGasWacsi struct {
+	vm.Wacsi
+}
+
+func (w *outOfGasWacsi) CallContract(requestBody []byte, txSimContext protocol.TxSimContext, memory []byte,
+	data []byte, gasUsed uint64, isLen bool) (*commonPb.ContractResult, uint64, protocol.ExecOrderTxType, error) {
+	if !isLen {
+		copy(memory, data)
+		return nil, gasUsed, protocol.ExecOrderTxTypeNormal, nil
+	}
+	stack := getCallStack(txSimContext)
+	callee := &callFrame{ContractName: "callee", Depth: 1}
+	stack.push(callee)
+	limit := stack.limitGas(callee, gasUsed, 1000)
+	stack.finishGas(callee, limit+50)
+	stack.pop()
+	return &commonPb.ContractResult{Code: uint32(ErrorCodeOutOfGas)}, limit + 50, protocol.ExecOrderTxTypeNormal,
+		fmt.Errorf("out of gas")
+}
+
+func TestCalleeOutOfGasKeepsTheCaller(t *testing.T) {
+	memory := &growingMemory{data: make([]byte, 256)}
+	defer func(original vm.Wacsi) { wacsi = original }(wacsi)
+	wacsi = &outOfGasWacsi{}
+
+	sc := NewSimContext("invoke", log, "chain1")
+	defer sc.removeCtxPointer()
+	sc.TxSimContext = newKvTxContext()
+	sc.Contract = &commonPb.Contract{Name: "caller"}
+	sc.ContractResult = &commonPb.ContractResult{}
+	sc.Instance = &fakeInstance{}
+	sc.Instance.SetGasUsed(100)
+	stack := getCallStack(sc.TxSimContext)
+	stack.push(&callFrame{ContractName: "caller"})
+	defer stack.pop()
+	stack.limitGas(stack.frames[0], 100, 1000)
+
+	request := serialize.NewEasyCodec()
+	request.AddString("contract_name", "callee")
+	request.AddString("method", "loop")
+	request.AddString(CallContractGasLimitKey, "200")
+	request.AddInt32("value_ptr", 8)
+	request.AddInt32(resultHandlePtrKey, 16)
+	s := &WaciInstance{Sc: sc, RequestBody: request.Marshal(), memory: wasmertypes.NewMemoryView(memory)}
+
+	if s.CallContractLen() != protocol.ContractSdkSignalResultFail {
+		t.Fatal("expected the call of the callee out of gas to fail")
+	}
+	if sc.ContractResult.Code != uint32(ErrorCodeSuccess) {
+		t.Fatalf("expected the caller not failed, got %d, %s", sc.ContractResult.Code, sc.ContractResult.Message)
+	}
+	if gas := sc.Instance.GetGasUsed(); gas != 300 {
+		t.Errorf("expected the caller charged by the cap of the callee, got %d", gas)
+	}
+
+	length := binary.LittleEndian.Uint32(memory.data[8:])
+	request.AddInt32(resultHandleKey, int32(binary.LittleEndian.Uint32(memory.data[16:])))
+	request.RemoveKey("value_ptr")
+	request.AddInt32("value_ptr", 32)
+	s.RequestBody = request.Marshal()
+	if s.CallContract() != protocol.ContractSdkSignalResultSuccess {
+		t.Fatalf("expected the out of gas error fetched as the result, %s", sc.ContractResult.Message)
+	}
+	if got := string(memory.data[32 : 32+length]); !strings.HasPrefix(got, ErrorCodeOutOfGas.String()+": ") {
+		t.Errorf("expected an out of gas error as the result, got %q", memory.data[32:32+length])
+	}
+}
@@ -0,0 +1,262 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/store"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+// stateWrite a state write or delete made inside a cross contract call
+type stateWrite struct {
+	contractName string
+	key          []byte
+	// nil if the key is deleted
+	value []byte
+}
+
+// callTxContext the TxSimContext seen by a cross contract call. its state writes are buffered in the call stack
+// and reach the transaction only when the outermost cross contract call succeeds,
+// so a failing call leaves no write in the read-write set of the transaction
+type callTxContext struct {
+	protocol.TxSimContext
+	stack *callStack
+}
+
+// Get read the buffered writes first
+func (c *callTxContext) Get(contractName string, key []byte) ([]byte, error) {
+	if write := c.stack.bufferedWrite(contractName, key); write != nil {
+		return write.value, nil
+	}
+	return c.TxSimContext.Get(contractName, key)
+}
+
+func (c *callTxContext) Put(contractName string, key []byte, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	c.stack.writes = append(c.stack.writes, &stateWrite{
+		contractName: contractName,
+		key:          append([]byte{}, key...),
+		value:        append([]byte{}, value...),
+	})
+	return nil
+}
+
+func (c *callTxContext) Del(contractName string, key []byte) error {
+	c.stack.writes = append(c.stack.writes, &stateWrite{contractName: contractName, key: append([]byte{}, key...)})
+	return nil
+}
+
+// Select iterate the state of the transaction merged with the buffered writes
+func (c *callTxContext) Select(contractName string, startKey []byte, limit []byte) (protocol.StateIterator, error) {
+	iterator, err := c.TxSimContext.Select(contractName, startKey, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &bufferedIterator{base: iterator, writes: c.stack.bufferedRange(contractName, startKey, limit)}, nil
+}
+
+// bufferedWrite the last buffered write of the key, nil if none
+func (s *callStack) bufferedWrite(contractName string, key []byte) *stateWrite {
+	for i := len(s.writes) - 1; i >= 0; i-- {
+		if write := s.writes[i]; write.contractName == contractName && bytes.Equal(write.key, key) {
+			return write
+		}
+	}
+	return nil
+}
+
+// bufferedRange the last buffered write of every key of the contract in [startKey, limit), in key order
+func (s *callStack) bufferedRange(contractName string, startKey []byte, limit []byte) []*stateWrite {
+	last := make(map[string]*stateWrite)
+	for _, write := range s.writes {
+		if write.contractName == contractName &&
+			bytes.Compare(write.key, startKey) >= 0 && bytes.Compare(write.key, limit) < 0 {
+			last[string(write.key)] = write
+		}
+	}
+	writes := make([]*stateWrite, 0, len(last))
+	for _, write := range last {
+		writes = append(writes, write)
+	}
+	sort.Slice(writes, func(i, j int) bool {
+		return bytes.Compare(writes[i].key, writes[j].key) < 0
+	})
+	return writes
+}
+
+// beginSqlSavePoints create a sql save point for every cross contract call frame without one.
+// must be called before each sql write, the save point of a frame is created before the first sql write
+// inside the frame (its nested calls included), so it rolls back exactly the sql writes of the frame
+func (s *callStack) beginSqlSavePoints() error {
+	var transaction protocol.SqlDBTransaction
+	for _, frame := range s.frames {
+		if frame.Depth == 0 || frame.sqlSavePoint != "" {
+			continue
+		}
+		if transaction == nil {
+			var err error
+			if transaction, err = s.dbTransaction(); err != nil {
+				return err
+			}
+		}
+		s.savePointSeq++
+		savePoint := fmt.Sprintf("%s_call_%d", s.txContext.GetTx().Payload.TxId, s.savePointSeq)
+		if err := transaction.BeginDbSavePoint(savePoint); err != nil {
+			return fmt.Errorf("begin sql save point of cross contract call failed, %s", err.Error())
+		}
+		frame.sqlSavePoint = savePoint
+	}
+	return nil
+}
+
+// savePointReleaser a sql transaction able to release a save point, releasing keeps the writes after it
+type savePointReleaser interface {
+	ReleaseDbSavePoint(savePointName string) error
+}
+
+// commit keep the state writes and sql writes of the succeeded cross contract call.
+// the writes go to the transaction when the outermost cross contract call succeeds,
+// the writes of a nested call are kept in the buffer of its caller
+func (s *callStack) commit(frame *callFrame) error {
+	if frame.Depth == 1 {
+		if err := s.flushWrites(frame.writeMark); err != nil {
+			return err
+		}
+	}
+	if frame.sqlSavePoint == "" {
+		return nil
+	}
+	transaction, err := s.dbTransaction()
+	if err != nil {
+		return err
+	}
+	// the sql transaction releases the save points on commit if it can not release them one by one
+	if releaser, ok := transaction.(savePointReleaser); ok {
+		if err = releaser.ReleaseDbSavePoint(frame.sqlSavePoint); err != nil {
+			return fmt.Errorf("release sql save point of cross contract call failed, %s", err.Error())
+		}
+	}
+	frame.sqlSavePoint = ""
+	return nil
+}
+
+// flushWrites write the last buffered write of every key to the transaction, in the order of the first write
+func (s *callStack) flushWrites(mark int) error {
+	writes := s.writes[mark:]
+	last := make(map[string]int, len(writes))
+	for i, write := range writes {
+		last[write.contractName+"/"+string(write.key)] = i
+	}
+	for i, write := range writes {
+		if last[write.contractName+"/"+string(write.key)] != i {
+			continue
+		}
+		var err error
+		if write.value == nil {
+			err = s.txContext.Del(write.contractName, write.key)
+		} else {
+			err = s.txContext.Put(write.contractName, write.key, write.value)
+		}
+		if err != nil {
+			return fmt.Errorf("write state of [%s] failed, %s", write.contractName, err.Error())
+		}
+	}
+	s.writes = s.writes[:mark]
+	return nil
+}
+
+// rollback discard the state writes and sql writes made inside the frame and its nested calls
+func (s *callStack) rollback(frame *callFrame) error {
+	s.writes = s.writes[:frame.writeMark]
+
+	if frame.sqlSavePoint == "" {
+		return nil
+	}
+	transaction, err := s.dbTransaction()
+	if err != nil {
+		return err
+	}
+	if err = transaction.RollbackDbSavePoint(frame.sqlSavePoint); err != nil {
+		return fmt.Errorf("roll back sql save point of cross contract call failed, %s", err.Error())
+	}
+	frame.sqlSavePoint = ""
+	return nil
+}
+
+func (s *callStack) dbTransaction() (protocol.SqlDBTransaction, error) {
+	txKey := commonPb.GetTxKewWith(s.txContext.GetBlockProposer().MemberInfo, s.txContext.GetBlockHeight())
+	transaction, err := s.txContext.GetBlockchainStore().GetDbTransaction(txKey)
+	if err != nil {
+		return nil, fmt.Errorf("get sql db transaction failed, %s", err.Error())
+	}
+	return transaction, nil
+}
+
+// bufferedIterator a StateIterator of the transaction state, with the buffered writes of cross contract calls
+type bufferedIterator struct {
+	base     protocol.StateIterator
+	baseNext *store.KV
+	baseDone bool
+	err      error
+	writes   []*stateWrite
+	current  *store.KV
+}
+
+func (i *bufferedIterator) Next() bool {
+	i.err = nil
+	for {
+		if i.baseNext == nil && !i.baseDone {
+			if !i.base.Next() {
+				i.baseDone = true
+			} else if i.baseNext, i.err = i.base.Value(); i.err != nil {
+				// Value reports the error, the iteration stops at the buffered writes
+				i.baseDone = true
+				return true
+			}
+		}
+		if i.baseNext == nil && len(i.writes) == 0 {
+			i.current = nil
+			return false
+		}
+		if len(i.writes) == 0 || (i.baseNext != nil && bytes.Compare(i.baseNext.Key, i.writes[0].key) < 0) {
+			i.current, i.baseNext = i.baseNext, nil
+			return true
+		}
+		// the buffered write replaces the state of the key
+		write := i.writes[0]
+		i.writes = i.writes[1:]
+		if i.baseNext != nil && bytes.Equal(i.baseNext.Key, write.key) {
+			i.baseNext = nil
+		}
+		if write.value != nil {
+			i.current = &store.KV{ContractName: write.contractName, Key: write.key, Value: write.value}
+			return true
+		}
+	}
+}
+
+func (i *bufferedIterator) Value() (*store.KV, error) {
+	if i.err != nil {
+		return nil, i.err
+	}
+	if i.current == nil {
+		return nil, fmt.Errorf("iterator has no value")
+	}
+	return i.current, nil
+}
+
+func (i *bufferedIterator) Release() {
+	i.base.Release()
+}
@@ -0,0 +1,291 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"fmt"
+	"testing"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/store"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go/wasmertypes"
+)
+
+// kvTxContext TxSimContext keeping the state in a map and recording the read-write set,
+// cross contract calls are routed to the runtimes. other methods are not implemented
+type kvTxContext struct {
+	protocol.TxSimContext
+	state map[string][]byte
+	// the keys read and written, as the read-write set of the transaction
+	reads  []string
+	writes []string
+
+	tx       *commonPb.Transaction
+	depth    int
+	runtimes map[string]*RuntimeInstance
+}
+
+func newKvTxContext() *kvTxContext {
+	return &kvTxContext{
+		state:    make(map[string][]byte),
+		tx:       &commonPb.Transaction{Payload: &commonPb.Payload{TxId: "tx1"}},
+		runtimes: make(map[string]*RuntimeInstance),
+	}
+}
+
+func (c *kvTxContext) Get(contractName string, key []byte) ([]byte, error) {
+	c.reads = append(c.reads, contractName+"/"+string(key))
+	return c.state[contractName+"/"+string(key)], nil
+}
+
+func (c *kvTxContext) Put(contractName string, key []byte, value []byte) error {
+	c.writes = append(c.writes, contractName+"/"+string(key))
+	c.state[contractName+"/"+string(key)] = value
+	return nil
+}
+
+func (c *kvTxContext) Del(contractName string, key []byte) error {
+	c.writes = append(c.writes, contractName+"/"+string(key))
+	delete(c.state, contractName+"/"+string(key))
+	return nil
+}
+
+func (c *kvTxContext) Select(contractName string, startKey []byte, limit []byte) (protocol.StateIterator, error) {
+	iterator := &sliceIterator{position: -1}
+	for _, key := range []string{"a", "b", "c", "d"} {
+		if value, ok := c.state[contractName+"/"+key]; ok && key >= string(startKey) && key < string(limit) {
+			iterator.kvs = append(iterator.kvs, &store.KV{ContractName: contractName, Key: []byte(key), Value: value})
+		}
+	}
+	return iterator, nil
+}
+
+func (c *kvTxContext) GetTx() *commonPb.Transaction {
+	return c.tx
+}
+
+func (c *kvTxContext) GetDepth() int {
+	return c.depth
+}
+
+func (c *kvTxContext) CallContract(contract *commonPb.Contract, method string, byteCode []byte,
+	parameter map[string][]byte, gasUsed uint64, refTxType commonPb.TxType) (
+	*commonPb.ContractResult, protocol.ExecOrderTxType, commonPb.TxStatusCode) {
+
+	c.depth++
+	result, specialTxType := c.runtimes[contract.Name].Invoke(contract, method, nil, parameter, c, gasUsed)
+	c.depth--
+	if result.Code != uint32(ErrorCodeSuccess) {
+		return result, specialTxType, commonPb.TxStatusCode_CONTRACT_FAIL
+	}
+	return result, specialTxType, commonPb.TxStatusCode_SUCCESS
+}
+
+// sliceIterator a StateIterator over the kvs
+type sliceIterator struct {
+	kvs      []*store.KV
+	position int
+}
+
+func (i *sliceIterator) Next() bool {
+	i.position++
+	return i.position < len(i.kvs)
+}
+
+func (i *sliceIterator) Value() (*store.KV, error) {
+	return i.kvs[i.position], nil
+}
+
+func (i *sliceIterator) Release() {}
+
+func put(t *testing.T, txContext protocol.TxSimContext, contractName, key, value string) {
+	if err := txContext.Put(contractName, []byte(key), []byte(value)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectState(t *testing.T, txContext protocol.TxSimContext, contractName, key, value string) {
+	got, _ := txContext.Get(contractName, []byte(key))
+	if string(got) != value {
+		t.Fatalf("state %s/%s expect [%s], but got [%s]", contractName, key, value, got)
+	}
+}
+
+func TestRollbackFailingNestedCall(t *testing.T) {
+	txContext := newKvTxContext()
+	stack := getCallStack(txContext)
+	stack.push(&callFrame{ContractName: "A", Depth: 0})
+	defer stack.pop()
+	put(t, txContext, "A", "k", "a")
+
+	// A -> B -> C, C fails after overwriting B's write and creating a key
+	b := &callFrame{ContractName: "B", Depth: 1}
+	stack.push(b)
+	callContext := &callTxContext{TxSimContext: txContext, stack: stack}
+	put(t, callContext, "B", "k1", "b")
+	c := &callFrame{ContractName: "C", Depth: 2}
+	stack.push(c)
+	put(t, callContext, "B", "k1", "c")
+	put(t, callContext, "C", "k2", "c")
+	expectState(t, callContext, "B", "k1", "c")
+	if err := stack.rollback(c); err != nil {
+		t.Fatal(err)
+	}
+	stack.pop()
+	expectState(t, callContext, "B", "k1", "b")
+	if err := stack.commit(b); err != nil {
+		t.Fatal(err)
+	}
+	stack.pop()
+
+	expectState(t, txContext, "A", "k", "a")
+	expectState(t, txContext, "B", "k1", "b")
+	expectState(t, txContext, "C", "k2", "")
+	if fmt.Sprint(txContext.writes) != "[A/k B/k1]" {
+		t.Errorf("expected the writes of the failing call out of the read-write set, got %v", txContext.writes)
+	}
+}
+
+func TestRollbackSucceededCallOfFailingCaller(t *testing.T) {
+	txContext := newKvTxContext()
+	stack := getCallStack(txContext)
+	stack.push(&callFrame{ContractName: "A", Depth: 0})
+	defer stack.pop()
+	put(t, txContext, "A", "k", "a")
+
+	// A -> B -> C, C succeeds and B fails afterwards, both are rolled back
+	b := &callFrame{ContractName: "B", Depth: 1}
+	stack.push(b)
+	callContext := &callTxContext{TxSimContext: txContext, stack: stack}
+	put(t, callContext, "A", "k", "b")
+	c := &callFrame{ContractName: "C", Depth: 2}
+	stack.push(c)
+	put(t, callContext, "A", "k", "c")
+	if err := callContext.Del("C", []byte("k3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := stack.commit(c); err != nil {
+		t.Fatal(err)
+	}
+	stack.pop()
+	put(t, callContext, "B", "k4", "b")
+	if err := stack.rollback(b); err != nil {
+		t.Fatal(err)
+	}
+	stack.pop()
+
+	expectState(t, txContext, "A", "k", "a")
+	if len(stack.writes) != 0 || fmt.Sprint(txContext.writes) != "[A/k]" || len(txContext.reads) != 1 {
+		t.Fatalf("expected nothing of the failing call in the read-write set, writes %v, reads %v",
+			txContext.writes, txContext.reads)
+	}
+
+	// a later call of A keeps its writes
+	d := &callFrame{ContractName: "D", Depth: 1}
+	stack.push(d)
+	put(t, callContext, "D", "k5", "d")
+	put(t, callContext, "D", "k5", "e")
+	if err := stack.commit(d); err != nil {
+		t.Fatal(err)
+	}
+	stack.pop()
+	expectState(t, txContext, "D", "k5", "e")
+	if fmt.Sprint(txContext.writes) != "[A/k D/k5]" {
+		t.Errorf("expected one write of the key written twice, got %v", txContext.writes)
+	}
+}
+
+func TestSelectBufferedWrites(t *testing.T) {
+	txContext := newKvTxContext()
+	put(t, txContext, "B", "a", "1")
+	put(t, txContext, "B", "c", "3")
+	put(t, txContext, "B", "d", "4")
+	stack := getCallStack(txContext)
+	stack.push(&callFrame{ContractName: "A", Depth: 0})
+	defer stack.pop()
+	stack.push(&callFrame{ContractName: "B", Depth: 1})
+	defer stack.pop()
+
+	callContext := &callTxContext{TxSimContext: txContext, stack: stack}
+	put(t, callContext, "B", "b", "2")
+	put(t, callContext, "B", "a", "0")
+	if err := callContext.Del("B", []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	iterator, err := callContext.Select("B", []byte("a"), []byte("d"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iterator.Release()
+	var kvs []string
+	for iterator.Next() {
+		kv, err := iterator.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		kvs = append(kvs, string(kv.Key)+"="+string(kv.Value))
+	}
+	if fmt.Sprint(kvs) != "[a=0 b=2]" {
+		t.Errorf("expected the state merged with the buffered writes, got %v", kvs)
+	}
+}
+
+func TestRollbackCrossContractCallThroughInvoke(t *testing.T) {
+	engine := newFakeEngine()
+	sim := func(instance *fakeInstance) *SimContext {
+		return GetVmBridgeManager().get(instance.ctxPtr)
+	}
+	engine.contract("caller", map[string]fakeExport{
+		"call": func(instance *fakeInstance, args ...int32) (int32, error) {
+			txContext := sim(instance).TxSimContext
+			put(t, txContext, "caller", "k", "caller")
+			for _, method := range []string{"fail", "succeed"} {
+				txContext.CallContract(&commonPb.Contract{Name: "callee", Version: "1.0"}, method, nil,
+					map[string][]byte{}, 0, commonPb.TxType_INVOKE_CONTRACT)
+			}
+			return 0, nil
+		},
+	})
+	engine.contract("callee", map[string]fakeExport{
+		"fail": func(instance *fakeInstance, args ...int32) (int32, error) {
+			txContext := sim(instance).TxSimContext
+			put(t, txContext, "callee", "k", "failed")
+			if err := txContext.Del("callee", []byte("absent")); err != nil {
+				return 0, err
+			}
+			return 0, &wasmertypes.TrapError{Kind: wasmertypes.TrapKindUnreachable, Message: "unreachable"}
+		},
+		"succeed": func(instance *fakeInstance, args ...int32) (int32, error) {
+			put(t, sim(instance).TxSimContext, "callee", "k", "succeeded")
+			return 0, nil
+		},
+	})
+
+	txContext := newKvTxContext()
+	for _, name := range []string{"caller", "callee"} {
+		contract := &commonPb.Contract{Name: name, Version: "1.0"}
+		pool, err := newVmPool(engine, contract, []byte(name), log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pool.close()
+		pool.grow(1)
+		txContext.runtimes[name] = &RuntimeInstance{pool: pool, log: log, chainId: "chain1", config: defaultRuntimeConfig}
+	}
+
+	result, _ := txContext.runtimes["caller"].Invoke(&commonPb.Contract{Name: "caller", Version: "1.0"}, "call",
+		nil, map[string][]byte{}, txContext, 0)
+	if result.Code != uint32(ErrorCodeSuccess) {
+		t.Fatalf("expected the caller to succeed, got %d, %s", result.Code, result.Message)
+	}
+	expectState(t, txContext, "callee", "k", "succeeded")
+	if fmt.Sprint(txContext.writes) != "[caller/k callee/k]" {
+		t.Errorf("expected no write of the failing call in the read-write set, got %v", txContext.writes)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+const (
+	// ContractDenyReentrancyParam install parameter, "true" rejects calls into the contract
+	// while it is already on the call stack, e.g. A calls B which calls back into A
+	ContractDenyReentrancyParam = "__deny_reentrancy__"
+	// state key of the reentrancy policy, saved in the namespace of the contract
+	denyReentrancyStateKey = reservedStateKeyPrefix + "deny_reentrancy"
+
+	// ContractMethodGetCallStackLen sys_call method, put out the length of the call stack json
+	ContractMethodGetCallStackLen = "GetCallStackLen"
+	// ContractMethodGetCallStack sys_call method, get the call stack json, the callers first
+	ContractMethodGetCallStack = "GetCallStack"
+)
+
+// callFrame a contract invocation on the call stack of a transaction
+type callFrame struct {
+	// contract and method invoked
+	ContractName string `json:"contract_name"`
+	Method       string `json:"method"`
+	// cross contract call depth, 0 for the top level call
+	Depth int `json:"depth"`
+
+	// number of buffered state writes when the call started, the writes after it belong to the call
+	writeMark int
+	// sql save point created before the first sql write of the call, empty if none
+	sqlSavePoint string
+
+	// gas limit of the call, lowered by the gas cap given by the caller
+	gasLimit  uint64
+	gasCapped bool
+	// gas cap of the cross contract call being made, 0 for no cap
+	calleeGasCap uint64
+	// gas used by the last cross contract call made
+	callee *calleeGas
+}
+
+// callStack the contract invocations of one transaction, from the top level call
+// to the current cross contract call. all frames of a transaction run in one goroutine
+type callStack struct {
+	txContext protocol.TxSimContext
+	frames    []*callFrame
+
+	// state writes of the cross contract calls, buffered until the outermost call succeeds
+	writes       []*stateWrite
+	savePointSeq int
+}
+
+var (
+	callStacksLock sync.Mutex
+	// running transaction -> its call stack
+	callStacks = make(map[protocol.TxSimContext]*callStack)
+)
+
+// getCallStack return the call stack of the transaction, an empty one for a top level call
+func getCallStack(txContext protocol.TxSimContext) *callStack {
+	if callContext, ok := txContext.(*callTxContext); ok {
+		return callContext.stack
+	}
+	callStacksLock.Lock()
+	defer callStacksLock.Unlock()
+
+	if stack, ok := callStacks[txContext]; ok {
+		return stack
+	}
+	return &callStack{txContext: txContext}
+}
+
+// push a frame when an invocation starts, the call stack is registered with its first frame
+func (s *callStack) push(frame *callFrame) {
+	if len(s.frames) == 0 {
+		callStacksLock.Lock()
+		callStacks[s.txContext] = s
+		callStacksLock.Unlock()
+	}
+	frame.writeMark = len(s.writes)
+	s.frames = append(s.frames, frame)
+}
+
+// pop the frame of the finished invocation, the call stack is released with its last frame
+func (s *callStack) pop() {
+	s.frames = s.frames[:len(s.frames)-1]
+	if len(s.frames) > 0 {
+		return
+	}
+	s.writes = nil
+	callStacksLock.Lock()
+	defer callStacksLock.Unlock()
+	delete(callStacks, s.txContext)
+}
+
+// onStack whether the contract runs a frame of the call stack
+func (s *callStack) onStack(contractName string) bool {
+	for _, frame := range s.frames {
+		if frame.ContractName == contractName {
+			return true
+		}
+	}
+	return false
+}
+
+// checkReentrancy reject the call into a contract already on the call stack if the contract denies reentrancy,
+// must be called before the frame of the call is pushed
+func (s *callStack) checkReentrancy(contractName string) error {
+	if !s.onStack(contractName) {
+		return nil
+	}
+	policy, err := s.txContext.Get(contractName, []byte(denyReentrancyStateKey))
+	if err != nil {
+		return fmt.Errorf("load reentrancy policy of contract [%s] failed, %s", contractName, err.Error())
+	}
+	if string(policy) == "true" {
+		return newContractError(ErrorCodeDenied, "reentrant call into contract [%s] is denied, call stack: %s",
+			contractName, s)
+	}
+	return nil
+}
+
+// marshal the frames as json, the callers first
+func (s *callStack) marshal() ([]byte, error) {
+	return json.Marshal(s.frames)
+}
+
+func (s *callStack) String() string {
+	str := ""
+	for i, frame := range s.frames {
+		if i > 0 {
+			str += " -> "
+		}
+		str += frame.ContractName + "." + frame.Method
+	}
+	return str
+}
+
+// saveReentrancyPolicy validate and save the reentrancy policy declared by the install parameters
+func saveReentrancyPolicy(contractName string, parameters map[string][]byte, txContext protocol.TxSimContext) error {
+	policy, ok := parameters[ContractDenyReentrancyParam]
+	if !ok {
+		return nil
+	}
+	if string(policy) != "true" && string(policy) != "false" {
+		return fmt.Errorf("invalid %s, expect true or false, but got %s", ContractDenyReentrancyParam, policy)
+	}
+	return txContext.Put(contractName, []byte(denyReentrancyStateKey), policy)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"chainmaker.org/chainmaker/common/v2/serialize"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go/wasmertypes"
+)
+
+func TestReentrancyPolicy(t *testing.T) {
+	for policy, denied := range map[string]bool{"true": true, "false": false, "": false} {
+		txContext := newKvTxContext()
+		if policy != "" {
+			parameters := map[string][]byte{ContractDenyReentrancyParam: []byte(policy)}
+			if err := saveReentrancyPolicy("A", parameters, txContext); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// A -> B -> A
+		stack := getCallStack(txContext)
+		stack.push(&callFrame{ContractName: "A", Method: "call"})
+		stack.push(&callFrame{ContractName: "B", Method: "call", Depth: 1})
+		err := stack.checkReentrancy("A")
+		if denied && classifyError(err).Code != ErrorCodeDenied {
+			t.Errorf("policy %q: expected the reentrant call denied, got %v", policy, err)
+		}
+		if !denied && err != nil {
+			t.Errorf("policy %q: expected the reentrant call allowed, got %v", policy, err)
+		}
+		if err = stack.checkReentrancy("C"); err != nil {
+			t.Errorf("policy %q: expected a call of a contract off the stack allowed, got %v", policy, err)
+		}
+		stack.pop()
+		stack.pop()
+	}
+
+	parameters := map[string][]byte{ContractDenyReentrancyParam: []byte("yes")}
+	if err := saveReentrancyPolicy("A", parameters, newKvTxContext()); err == nil {
+		t.Error("expected an invalid reentrancy policy rejected at install")
+	}
+}
+
+func TestGetCallStack(t *testing.T) {
+	sc := NewSimContext("invoke", log, "chain1")
+	defer sc.removeCtxPointer()
+	sc.TxSimContext = newKvTxContext()
+	sc.Contract = &commonPb.Contract{Name: "B"}
+	sc.ContractResult = &commonPb.ContractResult{}
+	stack := getCallStack(sc.TxSimContext)
+	stack.push(&callFrame{ContractName: "A", Method: "call"})
+	defer stack.pop()
+	stack.push(&callFrame{ContractName: "B", Method: "query", Depth: 1})
+	defer stack.pop()
+
+	memory := &growingMemory{data: make([]byte, 256)}
+	request := serialize.NewEasyCodec()
+	request.AddInt32("value_ptr", 16)
+	request.AddInt32(resultHandlePtrKey, 8)
+	s := &WaciInstance{Sc: sc, RequestBody: request.Marshal(), memory: wasmertypes.NewMemoryView(memory)}
+	if s.GetCallStackLen() != protocol.ContractSdkSignalResultSuccess {
+		t.Fatalf("GetCallStackLen failed, %s", sc.ContractResult.Message)
+	}
+	length := binary.LittleEndian.Uint32(memory.data[16:])
+
+	request.AddInt32(resultHandleKey, int32(binary.LittleEndian.Uint32(memory.data[8:])))
+	s.RequestBody = request.Marshal()
+	if s.GetCallStack() != protocol.ContractSdkSignalResultSuccess {
+		t.Fatalf("GetCallStack failed, %s", sc.ContractResult.Message)
+	}
+	var frames []*callFrame
+	if err := json.Unmarshal(memory.data[16:16+length], &frames); err != nil {
+		t.Fatalf("expected the call stack json of %d bytes, %v", length, err)
+	}
+	if len(frames) != 2 || frames[0].ContractName != "A" || frames[0].Method != "call" ||
+		frames[1].ContractName != "B" || frames[1].Depth != 1 {
+		t.Errorf("expected the callers first, got %s", memory.data[16:16+length])
+	}
+}
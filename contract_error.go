@@ -0,0 +1,205 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go/wasmertypes"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmparser"
+)
+
+// ErrorCode the class of a contract invocation failure, saved in ContractResult.Code for the contract sdks
+// from abi version 2. the failures of the sdks before are saved as ErrorCodeContract
+type ErrorCode uint32
+
+const (
+	ErrorCodeSuccess ErrorCode = 0
+	// the contract reported the error by the ErrorResult sys_call, code 1 is kept for the contract sdk
+	ErrorCodeContract ErrorCode = 1
+	// the invocation exceeded its gas limit
+	ErrorCodeOutOfGas ErrorCode = 2
+	// the byte code can not be compiled or instantiated
+	ErrorCodeBytecodeInvalid ErrorCode = 3
+	// the method or a required function is not exported by the contract
+	ErrorCodeExportMissing ErrorCode = 4
+	// the contract sdk is not a wasmer sdk
+	ErrorCodeRuntimeType ErrorCode = 5
+	// the contract trapped, e.g. unreachable, out of bounds memory access
+	ErrorCodeTrap ErrorCode = 6
+	// a sys_call made by the contract failed
+	ErrorCodeSyscall ErrorCode = 7
+	// the invocation is denied, e.g. a reentrant call into a contract denying reentrancy
+	ErrorCodeDenied ErrorCode = 8
+	// the install or upgrade parameters are invalid
+	ErrorCodeInvalidParameter ErrorCode = 9
+	// the runtime panicked
+	ErrorCodePanic ErrorCode = 10
+	// the sys_call abi version of the contract sdk is not supported by the runtime
+	ErrorCodeAbiUnsupported ErrorCode = 11
+	// the contract executed an unreachable instruction, how the contract sdks compile a panic
+	ErrorCodeTrapUnreachable ErrorCode = 12
+	// the contract accessed its memory out of bounds
+	ErrorCodeTrapMemoryOutOfBounds ErrorCode = 13
+	// the contract accessed its table out of bounds
+	ErrorCodeTrapTableOutOfBounds ErrorCode = 14
+	// the contract made an indirect call to a null function or a function of another signature
+	ErrorCodeTrapIndirectCall ErrorCode = 15
+	// the contract divided an integer by zero
+	ErrorCodeTrapDivisionByZero ErrorCode = 16
+	// the contract overflowed an integer or converted a float out of the integer range
+	ErrorCodeTrapIntegerOverflow ErrorCode = 17
+	// the contract exhausted the call stack, e.g. by an infinite recursion
+	ErrorCodeTrapStackOverflow ErrorCode = 18
+)
+
+// ContractResultCodeOutOfGas ContractResult.Code of an invocation exceeding its gas limit.
+// Deprecated: use ErrorCodeOutOfGas, the code is the same
+const ContractResultCodeOutOfGas = uint32(ErrorCodeOutOfGas)
+
+var errorCodeNames = map[ErrorCode]string{
+	ErrorCodeSuccess:          "success",
+	ErrorCodeContract:         "contract_error",
+	ErrorCodeOutOfGas:         "out_of_gas",
+	ErrorCodeBytecodeInvalid:  "bytecode_invalid",
+	ErrorCodeExportMissing:    "export_missing",
+	ErrorCodeRuntimeType:      "runtime_type_mismatch",
+	ErrorCodeTrap:             "trap",
+	ErrorCodeSyscall:          "syscall_error",
+	ErrorCodeDenied:           "denied",
+	ErrorCodeInvalidParameter: "invalid_parameter",
+	ErrorCodePanic:            "panic",
+	ErrorCodeAbiUnsupported:   "abi_unsupported",
+
+	ErrorCodeTrapUnreachable:       "trap_unreachable",
+	ErrorCodeTrapMemoryOutOfBounds: "trap_memory_out_of_bounds",
+	ErrorCodeTrapTableOutOfBounds:  "trap_table_out_of_bounds",
+	ErrorCodeTrapIndirectCall:      "trap_indirect_call",
+	ErrorCodeTrapDivisionByZero:    "trap_division_by_zero",
+	ErrorCodeTrapIntegerOverflow:   "trap_integer_overflow",
+	ErrorCodeTrapStackOverflow:     "trap_stack_overflow",
+}
+
+// trapErrorCodes the error code of every kind of trap, unknown traps are ErrorCodeTrap
+var trapErrorCodes = map[wasmertypes.TrapKind]ErrorCode{
+	wasmertypes.TrapKindUnreachable:           ErrorCodeTrapUnreachable,
+	wasmertypes.TrapKindMemoryOutOfBounds:     ErrorCodeTrapMemoryOutOfBounds,
+	wasmertypes.TrapKindTableOutOfBounds:      ErrorCodeTrapTableOutOfBounds,
+	wasmertypes.TrapKindIndirectCall:          ErrorCodeTrapIndirectCall,
+	wasmertypes.TrapKindIntegerDivisionByZero: ErrorCodeTrapDivisionByZero,
+	wasmertypes.TrapKindIntegerOverflow:       ErrorCodeTrapIntegerOverflow,
+	wasmertypes.TrapKindStackOverflow:         ErrorCodeTrapStackOverflow,
+	wasmertypes.TrapKindOutOfPoints:           ErrorCodeOutOfGas,
+}
+
+func (c ErrorCode) String() string {
+	if name, ok := errorCodeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("error_code_%d", uint32(c))
+}
+
+// ContractError a classified failure of a contract invocation.
+// ContractResult.Message of a failure made by the runtime is ContractError.Error(): "<code name>: <detail>"
+type ContractError struct {
+	Code   ErrorCode
+	Detail string
+	// the error the failure is made of, e.g. the *wasmertypes.CompileError of an invalid byte code
+	cause error
+}
+
+func newContractError(code ErrorCode, format string, args ...interface{}) *ContractError {
+	return &ContractError{Code: code, Detail: fmt.Sprintf(format, args...)}
+}
+
+func (e *ContractError) Error() string {
+	return e.Code.String() + ": " + e.Detail
+}
+
+// Unwrap return the error the failure is made of, nil if none
+func (e *ContractError) Unwrap() error {
+	return e.cause
+}
+
+// ParseContractError return the classified failure of a contract result, nil if the invocation succeeded.
+// the failures of a contract sdk before abi version 2 are all ErrorCodeContract
+func ParseContractError(result *commonPb.ContractResult) *ContractError {
+	if result == nil || result.Code == uint32(ErrorCodeSuccess) {
+		return nil
+	}
+	code := ErrorCode(result.Code)
+	return &ContractError{
+		Code:   code,
+		Detail: strings.TrimPrefix(result.Message, code.String()+": "),
+	}
+}
+
+// classifyError return the contract error of err, the traps of the contract by their kind,
+// errors not classified are traps of the contract
+func classifyError(err error) *ContractError {
+	var contractErr *ContractError
+	if errors.As(err, &contractErr) {
+		return contractErr
+	}
+	var trapErr *wasmertypes.TrapError
+	if errors.As(err, &trapErr) {
+		code, ok := trapErrorCodes[trapErr.Kind]
+		if !ok {
+			code = ErrorCodeTrap
+		}
+		return &ContractError{Code: code, Detail: err.Error(), cause: err}
+	}
+	return &ContractError{Code: ErrorCodeTrap, Detail: err.Error()}
+}
+
+// setError record the failure in the contract result, the first failure keeps its code
+func setError(result *commonPb.ContractResult, abi *abiBehaviour, err *ContractError) {
+	if result.Code == uint32(ErrorCodeSuccess) {
+		result.Code = abi.resultCode(err.Code)
+		result.Message = err.Error()
+		return
+	}
+	result.Message += ". " + err.Detail
+}
+
+// newBytecodeError the failure of a byte code wasmer does not validate or compile,
+// located at the function or section of the offset wasmer reports
+func newBytecodeError(contractId *commonPb.Contract, byteCode []byte, action string, err error) *ContractError {
+	detail := err.Error()
+	var compileErr *wasmertypes.CompileError
+	if errors.As(err, &compileErr) {
+		detail = compileErr.Kind.String() + " error"
+		if compileErr.Offset >= 0 {
+			detail += " " + locateOffset(byteCode, compileErr.Offset)
+		}
+		detail += ": " + compileErr.Message
+	}
+	contractErr := newContractError(ErrorCodeBytecodeInvalid, "[%s_%s], %s, %s",
+		contractId.Name, contractId.Version, action, detail)
+	contractErr.cause = err
+	return contractErr
+}
+
+// locateOffset describe the function or the section of the offset in the byte code
+func locateOffset(byteCode []byte, offset int) string {
+	location := fmt.Sprintf("at offset %d", offset)
+	module, err := wasmparser.Parse(byteCode)
+	if err != nil {
+		return location
+	}
+	if function, ok := module.FunctionAt(byteCode, offset); ok {
+		return fmt.Sprintf("in function %d %s", function, location)
+	}
+	if section, ok := module.SectionAt(offset); ok {
+		return fmt.Sprintf("in %s section %s", wasmparser.SectionName(section.ID), location)
+	}
+	return location
+}
@@ -0,0 +1,79 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go/wasmertypes"
+)
+
+func TestClassifyError(t *testing.T) {
+	trap := func(kind wasmertypes.TrapKind) error {
+		return &wasmertypes.TrapError{FunctionName: "invoke", Kind: kind, Message: "trapped"}
+	}
+	denied := newContractError(ErrorCodeDenied, "denied")
+	cases := []struct {
+		err    error
+		expect ErrorCode
+	}{
+		{denied, ErrorCodeDenied},
+		{fmt.Errorf("call failed, %w", denied), ErrorCodeDenied},
+		{trap(wasmertypes.TrapKindUnreachable), ErrorCodeTrapUnreachable},
+		{trap(wasmertypes.TrapKindMemoryOutOfBounds), ErrorCodeTrapMemoryOutOfBounds},
+		{trap(wasmertypes.TrapKindTableOutOfBounds), ErrorCodeTrapTableOutOfBounds},
+		{trap(wasmertypes.TrapKindIndirectCall), ErrorCodeTrapIndirectCall},
+		{trap(wasmertypes.TrapKindIntegerDivisionByZero), ErrorCodeTrapDivisionByZero},
+		{trap(wasmertypes.TrapKindIntegerOverflow), ErrorCodeTrapIntegerOverflow},
+		{trap(wasmertypes.TrapKindStackOverflow), ErrorCodeTrapStackOverflow},
+		{trap(wasmertypes.TrapKindOutOfPoints), ErrorCodeOutOfGas},
+		{trap(wasmertypes.TrapKindUnknown), ErrorCodeTrap},
+		{fmt.Errorf("call failed, %w", trap(wasmertypes.TrapKindUnreachable)), ErrorCodeTrapUnreachable},
+		{errors.New("failed"), ErrorCodeTrap},
+	}
+	for _, c := range cases {
+		contractErr := classifyError(c.err)
+		if contractErr.Code != c.expect {
+			t.Errorf("%v: expected %s, got %s", c.err, c.expect, contractErr.Code)
+		}
+		var trapErr *wasmertypes.TrapError
+		if errors.As(c.err, &trapErr) && !errors.Is(contractErr, trapErr) {
+			t.Errorf("%v: expected the trap unwrapped from the contract error", c.err)
+		}
+	}
+}
+
+func TestParseContractError(t *testing.T) {
+	if ParseContractError(&commonPb.ContractResult{}) != nil || ParseContractError(nil) != nil {
+		t.Error("expected no error of a succeeded invocation")
+	}
+	for code := range errorCodeNames {
+		if code == ErrorCodeSuccess {
+			continue
+		}
+		result := &commonPb.ContractResult{}
+		setError(result, abiBehaviours[AbiVersion2], newContractError(code, "detail of %d", code))
+		parsed := ParseContractError(result)
+		if parsed == nil || parsed.Code != code || parsed.Detail != fmt.Sprintf("detail of %d", code) {
+			t.Errorf("expected %s parsed back from %d, %s, got %+v", code, result.Code, result.Message, parsed)
+		}
+	}
+
+	// the contract sdks before abi version 2 have no error codes
+	result := &commonPb.ContractResult{}
+	setError(result, abiBehaviours[AbiVersion1], newContractError(ErrorCodeTrapUnreachable, "unreachable"))
+	if result.Code != uint32(ErrorCodeContract) {
+		t.Errorf("expected the code of every failure of abi version 1, got %d", result.Code)
+	}
+	if parsed := ParseContractError(result); parsed == nil || parsed.Code != ErrorCodeContract {
+		t.Errorf("expected a contract error parsed, got %+v", parsed)
+	}
+}
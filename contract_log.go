@@ -0,0 +1,146 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+)
+
+// ContractMethodLogMessageLevel sys_call method of leveled contract logs,
+// the request body carries "level" (int32, see LogLevel) and "msg" (string)
+const ContractMethodLogMessageLevel = "LogMessageLevel"
+
+// LogLevel the level of a contract log
+type LogLevel int32
+
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "DEBUG"
+	case LogLevelInfo:
+		return "INFO"
+	case LogLevelWarn:
+		return "WARN"
+	case LogLevelError:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LEVEL(%d)", int32(l))
+	}
+}
+
+// logRateLimiter token bucket limiting the log lines of one contract, shared by all its transactions
+type logRateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // lines per second, 0 means unlimited
+	tokens float64
+	last   time.Time
+}
+
+func newLogRateLimiter(linesPerSecond int) *logRateLimiter {
+	return &logRateLimiter{
+		rate:   float64(linesPerSecond),
+		tokens: float64(linesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// allow take a token for one log line
+func (l *logRateLimiter) allow() bool {
+	if l == nil || l.rate <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// contractLog write a contract log with the tx id and contract name,
+// logs over the transaction byte budget or the contract rate limit are dropped.
+// once the budget is exhausted, the following logs are dropped even if they are short
+func (sc *SimContext) contractLog(level LogLevel, msg string) {
+	maxLogBytes := sc.config.MaxLogBytes
+	if maxLogBytes > 0 && (sc.logBudgetExhausted || sc.logBytes+len(msg) > maxLogBytes) {
+		if !sc.logBudgetExhausted {
+			sc.logBudgetExhausted = true
+			sc.Log.Warnf("wasmer log>> [%s][%s] log budget of %d bytes exhausted, further logs are dropped",
+				sc.TxSimContext.GetTx().Payload.TxId, sc.Contract.Name, maxLogBytes)
+		}
+		sc.countDropped()
+		return
+	}
+	if !sc.logLimiter.allow() {
+		sc.countDropped()
+		return
+	}
+	sc.logBytes += len(msg)
+
+	txId := sc.TxSimContext.GetTx().Payload.TxId
+	switch level {
+	case LogLevelError:
+		sc.Log.Errorf("wasmer log>> [%s][%s] %s", txId, sc.Contract.Name, msg)
+	case LogLevelWarn:
+		sc.Log.Warnf("wasmer log>> [%s][%s] %s", txId, sc.Contract.Name, msg)
+	case LogLevelInfo:
+		sc.Log.Infof("wasmer log>> [%s][%s] %s", txId, sc.Contract.Name, msg)
+	default:
+		sc.Log.Debugf("wasmer log>> [%s][%s] %s", txId, sc.Contract.Name, msg)
+	}
+
+	if sc.captureLogs() {
+		sc.logs = append(sc.logs, fmt.Sprintf("[%s] %s", level, msg))
+	}
+}
+
+// captureLogs whether the contract logs are returned to the client, only for query transactions
+func (sc *SimContext) captureLogs() bool {
+	return sc.config.ReturnQueryLogs &&
+		sc.TxSimContext.GetTx().Payload.TxType == commonPb.TxType_QUERY_CONTRACT
+}
+
+// countDropped count a dropped log line for the result of query transactions.
+// the rate limit depends on the clock of the node, invoke results must not depend on it
+func (sc *SimContext) countDropped() {
+	if sc.captureLogs() {
+		sc.logDropped++
+	}
+}
+
+// capturedLogs the contract logs returned in the result of query transactions, empty for invoke transactions
+func (sc *SimContext) capturedLogs() string {
+	if !sc.captureLogs() || (len(sc.logs) == 0 && sc.logDropped == 0) {
+		return ""
+	}
+	logs := strings.Join(sc.logs, "\n")
+	if sc.logDropped > 0 {
+		logs += fmt.Sprintf("\n%d log lines dropped by the log limits", sc.logDropped)
+	}
+	return "contract logs:\n" + logs
+}
@@ -0,0 +1,60 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"strings"
+	"testing"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+// txOnlyContext TxSimContext returning the transaction, other methods are not implemented
+type txOnlyContext struct {
+	protocol.TxSimContext
+	tx *commonPb.Transaction
+}
+
+func (c *txOnlyContext) GetTx() *commonPb.Transaction {
+	return c.tx
+}
+
+func newLogSimContext(txType commonPb.TxType) *SimContext {
+	sc := NewSimContext("increase", log, "chain1")
+	sc.removeCtxPointer()
+	sc.Contract = &commonPb.Contract{Name: "counter"}
+	sc.TxSimContext = &txOnlyContext{tx: &commonPb.Transaction{Payload: &commonPb.Payload{TxId: "tx1", TxType: txType}}}
+	config := *defaultRuntimeConfig
+	config.ReturnQueryLogs = true
+	config.MaxLogBytes = 4
+	sc.config = &config
+	return sc
+}
+
+func TestCapturedLogsOfQuery(t *testing.T) {
+	sc := newLogSimContext(commonPb.TxType_QUERY_CONTRACT)
+	sc.contractLog(LogLevelInfo, "abc")
+	sc.contractLog(LogLevelInfo, "def")
+
+	logs := sc.capturedLogs()
+	if !strings.Contains(logs, "[INFO] abc") || !strings.Contains(logs, "1 log lines dropped") {
+		t.Errorf("expected the log and the dropped count, got %q", logs)
+	}
+}
+
+func TestNoCapturedLogsOfInvoke(t *testing.T) {
+	sc := newLogSimContext(commonPb.TxType_INVOKE_CONTRACT)
+	sc.contractLog(LogLevelInfo, "abc")
+	sc.contractLog(LogLevelInfo, "def")
+
+	// the drops depend on the node, they must not change the result of an invoke
+	if logs := sc.capturedLogs(); logs != "" || sc.logDropped != 0 {
+		t.Errorf("expected no logs in the result of an invoke, got %q, %d dropped", logs, sc.logDropped)
+	}
+}
@@ -0,0 +1,45 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go/wasmertypes"
+)
+
+// Engine the wasm engine running the contracts, the vm pool and the bridge only depend on this interface.
+// the traps of the contracts are reported as *wasmertypes.TrapError, whatever the engine, to be classified
+type Engine interface {
+	// Validate check the byte code is a valid wasm module, a *wasmertypes.CompileError locates the failure
+	Validate(byteCode []byte) error
+	// Compile compile the byte code, once per contract version
+	Compile(byteCode []byte) (ModuleHandle, error)
+}
+
+// ModuleHandle a compiled contract
+type ModuleHandle interface {
+	// Instantiate create an instance importing the host functions of the bridge
+	Instantiate() (InstanceHandle, error)
+	Close()
+}
+
+// InstanceHandle an instance of a contract. the contract abi passes and returns i32 values only
+type InstanceHandle interface {
+	// HasExport whether the contract exports the function
+	HasExport(name string) bool
+	// Call call the exported function, 0 is returned by the functions returning nothing.
+	// calling a function which is not exported returns an ErrorCodeExportMissing error
+	Call(name string, args ...int32) (int32, error)
+	// Memory the memory of the instance, resolved on every access
+	Memory() *wasmertypes.MemoryView
+	GetGasUsed() uint64
+	SetGasUsed(gas uint64)
+	SetGasLimit(gas uint64)
+	// SetContextData bind the instance to the SimContext of the invocation, read back by the host functions
+	SetContextData(ctxPtr int32)
+	Close()
+}
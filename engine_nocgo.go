@@ -0,0 +1,38 @@
+// +build !cgo
+
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"errors"
+
+	"chainmaker.org/chainmaker/logger/v2"
+)
+
+// errNoEngine the wasmer-go binding is built with cgo only
+var errNoEngine = errors.New("the wasmer-go engine requires cgo, RuntimeConfig.Engine is not set")
+
+// defaultEngine without cgo, it runs no contract
+var defaultEngine Engine = noEngine{}
+
+// noEngine the Engine of a build without cgo, every byte code is rejected
+type noEngine struct{}
+
+func (noEngine) Validate(byteCode []byte) error {
+	return errNoEngine
+}
+
+func (noEngine) Compile(byteCode []byte) (ModuleHandle, error) {
+	return nil, errNoEngine
+}
+
+// checkLibrary no wasmer library is loaded without cgo
+func checkLibrary(log *logger.CMLogger) error {
+	return nil
+}
@@ -0,0 +1,390 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"chainmaker.org/chainmaker/common/v2/serialize"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go/wasmertypes"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmparser"
+)
+
+// fakeExport a contract function run in process, args and result are i32 like the contract abi
+type fakeExport func(instance *fakeInstance, args ...int32) (int32, error)
+
+// fakeEngine Engine running contracts made of go functions, the byte code is the contract name
+type fakeEngine struct {
+	// the pools instantiate concurrently
+	lock         sync.Mutex
+	contracts    map[string]map[string]fakeExport
+	compiled     int
+	instantiated int
+	instances    []*fakeInstance
+}
+
+func newFakeEngine() *fakeEngine {
+	return &fakeEngine{contracts: make(map[string]map[string]fakeExport)}
+}
+
+// contract add a contract exporting the functions of the wasmer contract sdk and the given ones
+func (e *fakeEngine) contract(name string, exports map[string]fakeExport) []byte {
+	contract := map[string]fakeExport{
+		protocol.ContractRuntimeTypeMethod: func(*fakeInstance, ...int32) (int32, error) {
+			return int32(commonPb.RuntimeType_WASMER), nil
+		},
+		// the subject is written at the start of the memory
+		protocol.ContractAllocateMethod: func(instance *fakeInstance, args ...int32) (int32, error) {
+			if int(args[0]) > len(instance.memory) {
+				instance.memory = make([]byte, args[0])
+			}
+			return 0, nil
+		},
+		protocol.ContractDeallocateMethod: func(*fakeInstance, ...int32) (int32, error) {
+			return 0, nil
+		},
+	}
+	for export, function := range exports {
+		contract[export] = function
+	}
+	e.contracts[name] = contract
+	return []byte(name)
+}
+
+func (e *fakeEngine) Validate(byteCode []byte) error {
+	if _, ok := e.contracts[string(byteCode)]; !ok {
+		return &wasmertypes.CompileError{
+			Kind: wasmertypes.CompileErrorKindValidation, Message: "unknown contract", Offset: -1}
+	}
+	return nil
+}
+
+func (e *fakeEngine) Compile(byteCode []byte) (ModuleHandle, error) {
+	e.compiled++
+	return &fakeModule{engine: e, exports: e.contracts[string(byteCode)]}, nil
+}
+
+type fakeModule struct {
+	engine  *fakeEngine
+	exports map[string]fakeExport
+}
+
+func (m *fakeModule) Instantiate() (InstanceHandle, error) {
+	instance := &fakeInstance{exports: m.exports, memory: make([]byte, 64)}
+	m.engine.lock.Lock()
+	defer m.engine.lock.Unlock()
+	m.engine.instantiated++
+	m.engine.instances = append(m.engine.instances, instance)
+	return instance, nil
+}
+
+func (m *fakeModule) Close() {}
+
+type fakeInstance struct {
+	exports  map[string]fakeExport
+	memory   []byte
+	gasUsed  uint64
+	gasLimit uint64
+	ctxPtr   int32
+	calls    []string
+	closed   bool
+}
+
+func (i *fakeInstance) HasExport(name string) bool {
+	_, ok := i.exports[name]
+	return ok
+}
+
+func (i *fakeInstance) Call(name string, args ...int32) (int32, error) {
+	export, ok := i.exports[name]
+	if !ok {
+		return 0, newContractError(ErrorCodeExportMissing, "method [%s] not export", name)
+	}
+	i.calls = append(i.calls, name)
+	return export(i, args...)
+}
+
+func (i *fakeInstance) Data() []byte {
+	return i.memory
+}
+
+func (i *fakeInstance) Memory() *wasmertypes.MemoryView {
+	return wasmertypes.NewMemoryView(i)
+}
+
+func (i *fakeInstance) GetGasUsed() uint64 {
+	return i.gasUsed
+}
+
+func (i *fakeInstance) SetGasUsed(gas uint64) {
+	i.gasUsed = gas
+}
+
+func (i *fakeInstance) SetGasLimit(gas uint64) {
+	i.gasLimit = gas
+}
+
+func (i *fakeInstance) SetContextData(ctxPtr int32) {
+	i.ctxPtr = ctxPtr
+}
+
+func (i *fakeInstance) Close() {
+	i.closed = true
+}
+
+func TestVmPoolThroughEngine(t *testing.T) {
+	engine := newFakeEngine()
+	byteCode := engine.contract("counter", map[string]fakeExport{
+		ContractAbiVersionMethod: func(*fakeInstance, ...int32) (int32, error) {
+			return int32(AbiVersion2), nil
+		},
+	})
+
+	pool, err := newVmPool(engine, &commonPb.Contract{Name: "counter", Version: "1.0"}, byteCode, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.close()
+	if pool.abi.version != AbiVersion2 {
+		t.Errorf("expected the abi version of the contract export, got %d", pool.abi.version)
+	}
+	if engine.compiled != 1 || engine.instantiated != 1 || !engine.instances[0].closed {
+		t.Errorf("expected one module and a closed instance reading the abi version, compiled %d, instantiated %d",
+			engine.compiled, engine.instantiated)
+	}
+
+	instance, err := pool.newInstanceFromModule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if instance.wasmInstance != engine.instances[1] || engine.compiled != 1 {
+		t.Error("expected the pool to instantiate its module")
+	}
+	if _, err = pool.NewInstanceFromByteCode(); err != nil {
+		t.Fatal(err)
+	}
+	if engine.compiled != 1 || engine.instantiated != 3 {
+		t.Errorf("expected the byte code compiled once, compiled %d, instantiated %d", engine.compiled,
+			engine.instantiated)
+	}
+}
+
+func TestVmPoolInvalidByteCode(t *testing.T) {
+	_, err := newVmPool(newFakeEngine(), &commonPb.Contract{Name: "missing", Version: "1.0"}, []byte("missing"), log)
+	if code := classifyError(err).Code; code != ErrorCodeBytecodeInvalid {
+		t.Fatalf("expected ErrorCodeBytecodeInvalid, got %d, %v", code, err)
+	}
+}
+
+func TestCallMethodThroughEngine(t *testing.T) {
+	engine := newFakeEngine()
+	var subject []byte
+	engine.contract("counter", map[string]fakeExport{
+		"increase": func(instance *fakeInstance, args ...int32) (int32, error) {
+			subject = append([]byte{}, instance.memory...)
+			return 0, nil
+		},
+	})
+	module, _ := engine.Compile([]byte("counter"))
+	instance, _ := module.Instantiate()
+
+	sc := NewSimContext("increase", log, "chain1")
+	defer sc.removeCtxPointer()
+	sc.parameters = map[string][]byte{"key": []byte("value")}
+	if err := sc.CallMethod(instance); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := fmt.Sprint(instance.(*fakeInstance).calls)
+	if expected := fmt.Sprint([]string{protocol.ContractRuntimeTypeMethod, protocol.ContractAllocateMethod,
+		"increase"}); calls != expected {
+		t.Errorf("expected the calls %s, got %s", expected, calls)
+	}
+	expected := serialize.NewEasyCodecWithMap(sc.parameters).Marshal()
+	if !bytes.HasPrefix(subject, expected) {
+		t.Errorf("expected the parameters written in the memory, got %x", subject)
+	}
+}
+
+func TestCallMethodErrorsThroughEngine(t *testing.T) {
+	cases := []struct {
+		name    string
+		method  string
+		exports map[string]fakeExport
+		code    ErrorCode
+	}{
+		{"missing method", "absent", nil, ErrorCodeExportMissing},
+		{"runtime type", "increase", map[string]fakeExport{
+			protocol.ContractRuntimeTypeMethod: func(*fakeInstance, ...int32) (int32, error) {
+				return int32(commonPb.RuntimeType_NATIVE), nil
+			},
+		}, ErrorCodeRuntimeType},
+		{"trap", "increase", map[string]fakeExport{
+			"increase": func(*fakeInstance, ...int32) (int32, error) {
+				return 0, &wasmertypes.TrapError{FunctionName: "increase", Kind: wasmertypes.TrapKindUnreachable,
+					Message: "unreachable"}
+			},
+		}, ErrorCodeTrapUnreachable},
+	}
+	for _, c := range cases {
+		engine := newFakeEngine()
+		engine.contract(c.name, c.exports)
+		module, _ := engine.Compile([]byte(c.name))
+		instance, _ := module.Instantiate()
+
+		sc := NewSimContext(c.method, log, "chain1")
+		sc.parameters = make(map[string][]byte)
+		err := sc.CallMethod(instance)
+		sc.removeCtxPointer()
+		if err == nil {
+			t.Errorf("%s: expected an error", c.name)
+			continue
+		}
+		if code := classifyError(err).Code; code != c.code {
+			t.Errorf("%s: expected the error code %d, got %d, %v", c.name, c.code, code, err)
+		}
+	}
+}
+
+func TestReentrantCallThroughInvoke(t *testing.T) {
+	engine := newFakeEngine()
+	var running []*fakeInstance
+	call := func(instance *fakeInstance, contractName, method string) (int32, error) {
+		running = append(running, instance)
+		txContext := GetVmBridgeManager().get(instance.ctxPtr).TxSimContext
+		result, _, _ := txContext.CallContract(&commonPb.Contract{Name: contractName, Version: "1.0"}, method, nil,
+			map[string][]byte{}, 0, commonPb.TxType_INVOKE_CONTRACT)
+		if result.Code != uint32(ErrorCodeSuccess) {
+			return 0, errors.New(result.Message)
+		}
+		return 0, nil
+	}
+	// A -> B -> A
+	engine.contract("A", map[string]fakeExport{
+		"call": func(instance *fakeInstance, args ...int32) (int32, error) {
+			return call(instance, "B", "call")
+		},
+		"reentered": func(instance *fakeInstance, args ...int32) (int32, error) {
+			running = append(running, instance)
+			return 0, nil
+		},
+	})
+	engine.contract("B", map[string]fakeExport{
+		"call": func(instance *fakeInstance, args ...int32) (int32, error) {
+			return call(instance, "A", "reentered")
+		},
+	})
+
+	txContext := newKvTxContext()
+	for _, name := range []string{"A", "B"} {
+		pool, err := newVmPool(engine, &commonPb.Contract{Name: name, Version: "1.0"}, []byte(name), log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pool.close()
+		pool.grow(1)
+		txContext.runtimes[name] = &RuntimeInstance{pool: pool, log: log, chainId: "chain1", config: defaultRuntimeConfig}
+	}
+
+	result, _ := txContext.runtimes["A"].Invoke(&commonPb.Contract{Name: "A", Version: "1.0"}, "call", nil,
+		map[string][]byte{}, txContext, 0)
+	if result.Code != uint32(ErrorCodeSuccess) {
+		t.Fatalf("expected the reentrant call to succeed, got %d, %s", result.Code, result.Message)
+	}
+	if len(running) != 3 || running[0] == running[2] {
+		t.Fatal("expected the reentrant call run by another instance than the outer call of the contract")
+	}
+	if !running[2].closed {
+		t.Error("expected the instance created for the reentrant call to be closed")
+	}
+	if idle := <-txContext.runtimes["A"].pool.instances; idle.wasmInstance != running[0] || running[0].closed {
+		t.Error("expected the instance of the outer call back in the pool")
+	}
+}
+
+// customModule an empty wasm module with a custom section of the name
+func customModule(name string) []byte {
+	return append([]byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x00, byte(len(name) + 1), byte(len(name))},
+		name...)
+}
+
+func TestAdmissionOnEveryInstall(t *testing.T) {
+	engine := newFakeEngine()
+	good, bad, other := customModule("good"), customModule("bad"), customModule("other")
+	for _, byteCode := range [][]byte{good, bad, other} {
+		engine.contract(string(byteCode), nil)
+	}
+	config := DefaultRuntimeConfig()
+	config.Engine = engine
+	config.Admission = nil
+	manager := NewInstancesManagerWithConfig("chain1", config)
+	manager.AddAdmissionCheck(func(byteCode []byte, module *wasmparser.Module, report *AdmissionReport) {
+		if bytes.Equal(byteCode, bad) {
+			report.Violationf("bad byte code")
+		}
+	})
+	contract := &commonPb.Contract{Name: "counter", Version: "1.0"}
+	defer manager.CloseAVmPool(contract)
+
+	// the pool is left behind when the init_contract method fails
+	if _, err := manager.NewRuntimeInstance(nil, "chain1", protocol.ContractInitMethod, "", contract, good, log); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.NewRuntimeInstance(nil, "chain1", protocol.ContractInitMethod, "", contract, bad, log); err == nil {
+		t.Error("expected the second install of the same name and version to be checked")
+	}
+	runtime, err := manager.NewRuntimeInstance(nil, "chain1", protocol.ContractInitMethod, "", contract, other, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool := runtime.(*RuntimeInstance).pool; !bytes.Equal(pool.byteCode, other) {
+		t.Errorf("expected the pool of the installed byte code, got the pool of %q", pool.byteCode)
+	}
+}
+
+func TestReplacedPoolClosedWithItsLastInstance(t *testing.T) {
+	engine := newFakeEngine()
+	failed, installed := customModule("failed"), customModule("installed")
+	engine.contract(string(failed), nil)
+	engine.contract(string(installed), nil)
+	config := DefaultRuntimeConfig()
+	config.Engine = engine
+	config.Admission = nil
+	manager := NewInstancesManagerWithConfig("chain1", config)
+	contract := &commonPb.Contract{Name: "counter", Version: "1.0"}
+	defer manager.CloseAVmPool(contract)
+
+	retired, err := manager.getVmPool(contract, failed, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	running := retired.GetInstance()
+	if _, err = manager.getVmPool(contract, installed, true); err != nil {
+		t.Fatal(err)
+	}
+	if retired.closed {
+		t.Fatal("expected the replaced pool kept open while its instance runs")
+	}
+	retired.RevertInstance(running)
+	if !retired.closed {
+		t.Fatal("expected the replaced pool closed with its last instance")
+	}
+
+	// a runtime got before the replacement runs on an instance of its own
+	detached := retired.GetInstance()
+	retired.RevertInstance(detached)
+	if !detached.detached || !detached.wasmInstance.(*fakeInstance).closed {
+		t.Error("expected the instance of the closed pool closed once reverted")
+	}
+}
@@ -0,0 +1,121 @@
+// +build cgo
+
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"errors"
+
+	"chainmaker.org/chainmaker/logger/v2"
+	wasmergo "github.com/Ning-Qing/vm-wasmer/v2/wasmer-go"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go/wasmertypes"
+)
+
+// defaultEngine the wasmer-go binding
+var defaultEngine Engine = &wasmerEngine{}
+
+// wasmerEngine the Engine of the wasmer-go binding
+type wasmerEngine struct{}
+
+func (e *wasmerEngine) Validate(byteCode []byte) error {
+	return wasmergo.ValidateWithError(byteCode)
+}
+
+func (e *wasmerEngine) Compile(byteCode []byte) (ModuleHandle, error) {
+	module, err := wasmergo.Compile(byteCode)
+	if err != nil {
+		return nil, err
+	}
+	return &wasmerModule{module: &module}, nil
+}
+
+type wasmerModule struct {
+	module *wasmergo.Module
+}
+
+func (m *wasmerModule) Instantiate() (InstanceHandle, error) {
+	instance, err := m.module.InstantiateWithImports(GetVmBridgeManager().GetImports())
+	if err != nil {
+		return nil, err
+	}
+	return &wasmerInstance{instance: &instance}, nil
+}
+
+func (m *wasmerModule) Close() {
+	m.module.Close()
+}
+
+type wasmerInstance struct {
+	instance *wasmergo.Instance
+}
+
+func (i *wasmerInstance) HasExport(name string) bool {
+	_, ok := i.instance.Exports[name]
+	return ok
+}
+
+func (i *wasmerInstance) Call(name string, args ...int32) (int32, error) {
+	export, ok := i.instance.Exports[name]
+	if !ok {
+		return 0, newContractError(ErrorCodeExportMissing, "method [%s] not export", name)
+	}
+	params := make([]interface{}, len(args))
+	for nth, arg := range args {
+		params[nth] = arg
+	}
+	result, err := export(params...)
+	if err != nil {
+		return 0, err
+	}
+	return result.ToI32(), nil
+}
+
+func (i *wasmerInstance) Memory() *wasmertypes.MemoryView {
+	if i.instance.Memory == nil {
+		// a contract without memory, every access is out of bounds
+		return (&wasmergo.Memory{}).View()
+	}
+	return i.instance.Memory.View()
+}
+
+func (i *wasmerInstance) GetGasUsed() uint64 {
+	return i.instance.GetGasUsed()
+}
+
+func (i *wasmerInstance) SetGasUsed(gas uint64) {
+	i.instance.SetGasUsed(gas)
+}
+
+func (i *wasmerInstance) SetGasLimit(gas uint64) {
+	i.instance.SetGasLimit(gas)
+}
+
+func (i *wasmerInstance) SetContextData(ctxPtr int32) {
+	i.instance.SetContextData(ctxPtr)
+}
+
+func (i *wasmerInstance) Close() {
+	i.instance.Close()
+}
+
+// checkLibrary check the loaded wasmer library, a confirmed version mismatch is an error.
+// a library whose version cannot be detected is only warned about
+func checkLibrary(log *logger.CMLogger) error {
+	library, err := wasmergo.CheckLibrary()
+	if err == nil {
+		log.Infof("wasmer library %s, version %s", library.Path, library.Version)
+		return nil
+	}
+	if library == nil || errors.Is(err, wasmergo.ErrUnknownLibraryVersion) {
+		log.Warnf("wasmer library not checked, %s", err.Error())
+		return nil
+	}
+	log.Errorf("wasmer library check failed, %s", err.Error())
+	return err
+}
@@ -0,0 +1,138 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+const (
+	// ContractEventSchemaParam install parameter declaring the contract event schema,
+	// a json object of topic -> number of event data fields, e.g. {"transfer": 3}
+	ContractEventSchemaParam = "__event_schema__"
+
+	// contract state keys with this prefix are reserved by the runtime
+	reservedStateKeyPrefix = "__wasmer_"
+	// state key of the event schema, saved in the namespace of the contract
+	eventSchemaStateKey = reservedStateKeyPrefix + "event_schema"
+)
+
+// EventSchema the expected number of data fields of every topic a contract may emit
+type EventSchema map[string]int
+
+func parseEventSchema(data []byte) (EventSchema, error) {
+	schema := make(EventSchema)
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid event schema, %s", err.Error())
+	}
+	for topic, fieldCount := range schema {
+		if len(topic) == 0 {
+			return nil, fmt.Errorf("invalid event schema, topic is empty")
+		}
+		if fieldCount < 0 {
+			return nil, fmt.Errorf("invalid event schema, topic [%s] field count %d is negative", topic, fieldCount)
+		}
+	}
+	return schema, nil
+}
+
+// saveInstallDeclarations save the contract declarations of the install or upgrade parameters
+func saveInstallDeclarations(contractName string, parameters map[string][]byte, txContext protocol.TxSimContext) error {
+	if err := saveEventSchema(contractName, parameters, txContext); err != nil {
+		return err
+	}
+	return saveReentrancyPolicy(contractName, parameters, txContext)
+}
+
+// saveEventSchema validate and save the event schema declared by the install parameters
+func saveEventSchema(contractName string, parameters map[string][]byte, txContext protocol.TxSimContext) error {
+	data, ok := parameters[ContractEventSchemaParam]
+	if !ok {
+		return nil
+	}
+	if _, err := parseEventSchema(data); err != nil {
+		return err
+	}
+	return txContext.Put(contractName, []byte(eventSchemaStateKey), data)
+}
+
+// loadEventSchema return the event schema of the contract, nil if the contract did not declare one
+func loadEventSchema(contractName string, txContext protocol.TxSimContext) (EventSchema, error) {
+	data, err := txContext.Get(contractName, []byte(eventSchemaStateKey))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return parseEventSchema(data)
+}
+
+// eventSize the bytes of an event counted against MaxEventBytes
+func eventSize(event *commonPb.ContractEvent) int {
+	size := len(event.Topic)
+	for _, data := range event.EventData {
+		size += len(data)
+	}
+	return size
+}
+
+// checkEventSchema validate an event emitted by the contract against its declared schema
+func (sc *SimContext) checkEventSchema(event *commonPb.ContractEvent) error {
+	if !sc.eventSchemaLoaded {
+		schema, err := loadEventSchema(sc.Contract.Name, sc.TxSimContext)
+		if err != nil {
+			return fmt.Errorf("load event schema failed, %s", err.Error())
+		}
+		sc.eventSchema = schema
+		sc.eventSchemaLoaded = true
+	}
+
+	maxTopicLen := sc.config.MaxEventTopicLen
+	if maxTopicLen > 0 && len(event.Topic) > maxTopicLen {
+		return fmt.Errorf("event topic length %d exceeds the limit %d", len(event.Topic), maxTopicLen)
+	}
+	if sc.eventSchema == nil {
+		return nil
+	}
+	fieldCount, ok := sc.eventSchema[event.Topic]
+	if !ok {
+		return fmt.Errorf("event topic [%s] is not declared in the event schema of contract [%s]",
+			event.Topic, sc.Contract.Name)
+	}
+	if fieldCount != len(event.EventData) {
+		return fmt.Errorf("event topic [%s] expects %d data fields, but got %d",
+			event.Topic, fieldCount, len(event.EventData))
+	}
+	return nil
+}
+
+// addEvents append events to the transaction, the transaction event limits are checked first
+func (sc *SimContext) addEvents(events ...*commonPb.ContractEvent) error {
+	count := len(sc.ContractEvent)
+	size := sc.eventBytes
+	for _, event := range events {
+		count++
+		size += eventSize(event)
+	}
+	if sc.config.MaxEventCount > 0 && count > sc.config.MaxEventCount {
+		return fmt.Errorf("too many events, %d exceeds the limit %d per transaction",
+			count, sc.config.MaxEventCount)
+	}
+	if sc.config.MaxEventBytes > 0 && size > sc.config.MaxEventBytes {
+		return fmt.Errorf("events too large, %d bytes exceeds the limit %d per transaction",
+			size, sc.config.MaxEventBytes)
+	}
+	sc.ContractEvent = append(sc.ContractEvent, events...)
+	sc.eventBytes = size
+	return nil
+}
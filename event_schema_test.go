@@ -0,0 +1,164 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"testing"
+
+	"chainmaker.org/chainmaker/common/v2/serialize"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/vm/v2"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go/wasmertypes"
+)
+
+// stateWacsi Wacsi writing the state sys_calls to the transaction
+type stateWacsi struct {
+	vm.Wacsi
+}
+
+func (w *stateWacsi) PutState(requestBody []byte, contractName string, txSimContext protocol.TxSimContext) error {
+	request := serialize.NewEasyCodecWithBytes(requestBody)
+	key, _ := request.GetString("key")
+	value, _ := request.GetBytes("value")
+	return txSimContext.Put(contractName, []byte(key), value)
+}
+
+func (w *stateWacsi) DeleteState(requestBody []byte, contractName string, txSimContext protocol.TxSimContext) error {
+	key, _ := serialize.NewEasyCodecWithBytes(requestBody).GetString("key")
+	return txSimContext.Del(contractName, []byte(key))
+}
+
+// eventSimContext a SimContext of the contract in a transaction, with the runtime config
+func eventSimContext(config *RuntimeConfig) *SimContext {
+	sc := NewSimContext("invoke", log, "chain1")
+	sc.TxSimContext = newKvTxContext()
+	sc.Contract = &commonPb.Contract{Name: "emitter", Version: "1.0"}
+	sc.ContractResult = &commonPb.ContractResult{}
+	sc.config = config
+	return sc
+}
+
+func event(topic string, data ...string) *commonPb.ContractEvent {
+	return &commonPb.ContractEvent{Topic: topic, EventData: data}
+}
+
+func TestEventLimits(t *testing.T) {
+	sc := eventSimContext(&RuntimeConfig{MaxEventCount: 2, MaxEventBytes: 16})
+	defer sc.removeCtxPointer()
+
+	if err := sc.addEvents(event("t", "1234")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.addEvents(event("t", "1234"), event("t")); err == nil {
+		t.Error("expected the events beyond MaxEventCount to be rejected")
+	}
+	if err := sc.addEvents(event("topic", "12345678901")); err == nil {
+		t.Error("expected the events beyond MaxEventBytes to be rejected")
+	}
+	if len(sc.ContractEvent) != 1 || sc.eventBytes != 5 {
+		t.Errorf("expected the rejected events not added, got %d events of %d bytes", len(sc.ContractEvent),
+			sc.eventBytes)
+	}
+	if err := sc.addEvents(event("topic", "123456")); err != nil {
+		t.Errorf("expected the events up to the limits to be added, got %v", err)
+	}
+
+	unlimited := eventSimContext(&RuntimeConfig{})
+	defer unlimited.removeCtxPointer()
+	for i := 0; i < defaultMaxEventCount+1; i++ {
+		if err := unlimited.addEvents(event("t", "1234")); err != nil {
+			t.Fatalf("expected no limit of 0, got %v", err)
+		}
+	}
+}
+
+func TestEventLimitsOfCallee(t *testing.T) {
+	memory := &growingMemory{data: make([]byte, 64)}
+	defer func(original vm.Wacsi) { wacsi = original }(wacsi)
+	wacsi = &reenteringWacsi{memory: memory, result: []byte("result"),
+		events: []*commonPb.ContractEvent{event("t", "1"), event("t", "2")}}
+
+	sc := eventSimContext(&RuntimeConfig{MaxEventCount: 2})
+	defer sc.removeCtxPointer()
+	sc.Instance = &fakeInstance{}
+	stack := getCallStack(sc.TxSimContext)
+	stack.push(&callFrame{ContractName: "emitter"})
+	defer stack.pop()
+	if err := sc.addEvents(event("t", "0")); err != nil {
+		t.Fatal(err)
+	}
+
+	request := serialize.NewEasyCodec()
+	request.AddString("contract_name", "callee")
+	request.AddInt32("value_ptr", 8)
+	request.AddInt32(resultHandlePtrKey, 16)
+	s := &WaciInstance{Sc: sc, RequestBody: request.Marshal(), memory: wasmertypes.NewMemoryView(memory)}
+	if s.CallContractLen() != protocol.ContractSdkSignalResultFail {
+		t.Error("expected the call to fail on the events of the callee beyond MaxEventCount")
+	}
+	if len(sc.ContractEvent) != 1 {
+		t.Errorf("expected the events of the callee not added, got %d events", len(sc.ContractEvent))
+	}
+}
+
+func TestEventSchema(t *testing.T) {
+	sc := eventSimContext(DefaultRuntimeConfig())
+	defer sc.removeCtxPointer()
+	if err := saveEventSchema(sc.Contract.Name, map[string][]byte{ContractEventSchemaParam: []byte(`{"x":1}`)},
+		sc.TxSimContext); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sc.checkEventSchema(event("x", "1")); err != nil {
+		t.Errorf("expected the declared event to be accepted, got %v", err)
+	}
+	if err := sc.checkEventSchema(event("y", "1")); err == nil {
+		t.Error("expected an undeclared topic to be rejected")
+	}
+	if err := sc.checkEventSchema(event("x", "1", "2")); err == nil {
+		t.Error("expected an event of another number of data fields to be rejected")
+	}
+
+	for _, schema := range []string{`{"x":-1}`, `{"":1}`, `[1]`} {
+		if err := saveEventSchema("other", map[string][]byte{ContractEventSchemaParam: []byte(schema)},
+			sc.TxSimContext); err == nil {
+			t.Errorf("expected the schema %s to be rejected at install", schema)
+		}
+	}
+}
+
+func TestReservedStateKey(t *testing.T) {
+	defer func(original vm.Wacsi) { wacsi = original }(wacsi)
+	wacsi = &stateWacsi{}
+	sc := eventSimContext(DefaultRuntimeConfig())
+	defer sc.removeCtxPointer()
+	txContext := sc.TxSimContext.(*kvTxContext)
+
+	for _, key := range []string{eventSchemaStateKey, reservedStateKeyPrefix + "other"} {
+		request := serialize.NewEasyCodec()
+		request.AddString("key", key)
+		request.AddBytes("value", []byte("{}"))
+		s := &WaciInstance{Sc: sc, RequestBody: request.Marshal()}
+		if s.PutState() != protocol.ContractSdkSignalResultFail || s.DeleteState() != protocol.ContractSdkSignalResultFail {
+			t.Errorf("expected the writes of the reserved key %s to be rejected", key)
+		}
+	}
+	if len(txContext.writes) != 0 {
+		t.Errorf("expected no write of a reserved key, got %v", txContext.writes)
+	}
+
+	request := serialize.NewEasyCodec()
+	request.AddString("key", "k")
+	request.AddBytes("value", []byte("v"))
+	s := &WaciInstance{Sc: sc, RequestBody: request.Marshal()}
+	if s.PutState() != protocol.ContractSdkSignalResultSuccess {
+		t.Fatalf("PutState failed, %s", sc.ContractResult.Message)
+	}
+	expectState(t, txContext, "emitter", "k", "v")
+}
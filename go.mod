@@ -5,7 +5,7 @@ go 1.15
 require (
 	chainmaker.org/chainmaker/common/v2 v2.1.0
 	chainmaker.org/chainmaker/logger/v2 v2.1.0
-	chainmaker.org/chainmaker/pb-go/v2 v2.1.0
+	chainmaker.org/chainmaker/pb-go/v2 v2.2.0
 	chainmaker.org/chainmaker/protocol/v2 v2.1.1
 	chainmaker.org/chainmaker/store/v2 v2.1.0
 	chainmaker.org/chainmaker/utils/v2 v2.1.0
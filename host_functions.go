@@ -0,0 +1,65 @@
+// +build cgo
+
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go/bridge"
+)
+
+// hostFunctions the host functions imported by the contracts, the chainmaker ones and the registered plugins
+var hostFunctions = newHostFunctions()
+
+// wasiFdSignature the signature of the wasi fd functions: (fd, iovs, iovs_len, nwritten) -> errno
+var wasiFdSignature = bridge.Signature{Params: 4, Result: wasmer.TypeI32}
+
+func newHostFunctions() *bridge.Registry {
+	registry := bridge.NewRegistry()
+	mustRegister := func(namespace, name string, signature bridge.Signature, function bridge.Func) {
+		if err := registry.Register(namespace, name, signature, function); err != nil {
+			panic(err)
+		}
+	}
+
+	mustRegister("env", "sys_call", bridge.Signature{Params: 4, Result: wasmer.TypeI32},
+		func(context *wasmer.InstanceContext, args []int32) int64 {
+			return int64(sysCall(context, args[0], args[1], args[2], args[3]))
+		})
+	mustRegister("env", "log_message", bridge.Signature{Params: 2, Result: wasmer.TypeVoid},
+		func(context *wasmer.InstanceContext, args []int32) int64 {
+			logMessage(context, args[0], args[1])
+			return 0
+		})
+
+	// for wacsi empty interface
+	wasiFd := func(fd func(*wasmer.InstanceContext, int32, int32, int32, int32) int32) bridge.Func {
+		return func(context *wasmer.InstanceContext, args []int32) int64 {
+			return int64(fd(context, args[0], args[1], args[2], args[3]))
+		}
+	}
+	mustRegister("wasi_unstable", "fd_write", wasiFdSignature, wasiFd(fdWrite))
+	mustRegister("wasi_unstable", "fd_read", wasiFdSignature, wasiFd(fdRead))
+	mustRegister("wasi_unstable", "fd_close", wasiFdSignature, wasiFd(fdClose))
+	mustRegister("wasi_unstable", "fd_seek", wasiFdSignature, wasiFd(fdSeek))
+
+	mustRegister("wasi_snapshot_preview1", "proc_exit", bridge.Signature{Params: 1, Result: wasmer.TypeVoid},
+		func(context *wasmer.InstanceContext, args []int32) int64 {
+			procExit(context, args[0])
+			return 0
+		})
+	return registry
+}
+
+// RegisterHostFunction add a host function imported by the contracts, e.g. a chain specific plugin.
+// it must be registered before the contracts importing it are instantiated, and be allowed by
+// RuntimeConfig.Admission.AllowedImports for the contracts importing it to be installed
+func RegisterHostFunction(namespace, name string, signature bridge.Signature, function bridge.Func) error {
+	return hostFunctions.Register(namespace, name, signature, function)
+}
@@ -8,12 +8,14 @@ SPDX-License-Identifier: Apache-2.0
 package wasmer
 
 import (
+	"errors"
 	"fmt"
 
 	"chainmaker.org/chainmaker/logger/v2"
 	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/protocol/v2"
 	"chainmaker.org/chainmaker/utils/v2"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go/wasmertypes"
 )
 
 // RuntimeInstance wasm runtime
@@ -21,6 +23,7 @@ type RuntimeInstance struct {
 	pool    *vmPool
 	log     *logger.CMLogger
 	chainId string
+	config  *RuntimeConfig
 }
 
 func (r *RuntimeInstance) Pool() *vmPool {
@@ -49,25 +52,27 @@ func (r *RuntimeInstance) Invoke(contract *commonPb.Contract, method string, byt
 		endTime := utils.CurrentTimeMillisSeconds()
 		logStr = fmt.Sprintf("%s used time %d", logStr, endTime-startTime)
 		r.log.Debugf(logStr)
-		panicErr := recover()
-		if panicErr != nil {
-			contractResult.Code = 1
-			contractResult.Message = fmt.Sprint(panicErr)
-			if instanceInfo != nil {
-				instanceInfo.errCount++
-			}
+		if panicErr := recover(); panicErr != nil {
+			setPanicResult(contractResult, r.abi(), instanceInfo, panicErr)
 			specialTxType = protocol.ExecOrderTxTypeNormal
 		}
 	}()
 
-	// if cross contract call, then new instance
+	stack := getCallStack(txContext)
+
+	// if cross contract call, then borrow an instance which is not on the call stack
 	if txContext.GetDepth() > 0 {
 		var err error
-		instanceInfo, err = r.pool.NewInstance()
-		defer r.pool.CloseInstance(instanceInfo)
+		var pooled bool
+		instanceInfo, pooled, err = r.pool.BorrowInstance()
 		if err != nil {
 			panic(err)
 		}
+		if pooled {
+			defer r.pool.RevertInstance(instanceInfo)
+		} else {
+			defer r.pool.CloseInstance(instanceInfo)
+		}
 	} else {
 		r.log.Debugf("before get instance for tx: %s", txContext.GetTx().Payload.TxId)
 		instanceInfo = r.pool.GetInstance()
@@ -75,20 +80,58 @@ func (r *RuntimeInstance) Invoke(contract *commonPb.Contract, method string, byt
 		defer r.pool.RevertInstance(instanceInfo)
 	}
 
+	reentrancyErr := stack.checkReentrancy(contract.Name)
+	frame := &callFrame{
+		ContractName: contract.Name,
+		Method:       method,
+		Depth:        txContext.GetDepth(),
+	}
+	stack.push(frame)
+	// registered after the instance is released above, so the frame finishes while it still owns the instance
+	defer func() {
+		if panicErr := recover(); panicErr != nil {
+			setPanicResult(contractResult, r.abi(), instanceInfo, panicErr)
+			specialTxType = protocol.ExecOrderTxTypeNormal
+		}
+		// the instance is still owned here, it may be closed or lent to another transaction once released
+		stack.finishGas(frame, instanceInfo.wasmInstance.GetGasUsed())
+		if frame.Depth > 0 {
+			r.finishCall(stack, frame, contractResult, txContext)
+		}
+		stack.pop()
+	}()
+
 	instance := instanceInfo.wasmInstance
+	gasLimit := stack.limitGas(frame, gasUsed, r.config.txGasLimit(txContext.GetTx()))
 	instance.SetGasUsed(gasUsed)
-	instance.SetGasLimit(protocol.GasLimit)
+	instance.SetGasLimit(gasLimit)
 
 	var sc = NewSimContext(method, r.log, r.chainId)
 	defer sc.removeCtxPointer()
 	sc.Contract = contract
 	sc.TxSimContext = txContext
+	if frame.Depth > 0 {
+		// the state writes of a cross contract call are kept only if it succeeds
+		sc.TxSimContext = &callTxContext{TxSimContext: txContext, stack: stack}
+	}
 	sc.ContractResult = contractResult
 	sc.parameters = parameters
 	sc.Instance = instance
 	sc.SpecialTxType = protocol.ExecOrderTxTypeNormal
-
-	err := sc.CallMethod(instance)
+	sc.config = r.config
+	sc.logLimiter = r.pool.logLimiter
+	sc.abi = r.abi()
+	instance.SetContextData(sc.CtxPtr)
+
+	err := reentrancyErr
+	if err == nil && (method == protocol.ContractInitMethod || method == protocol.ContractUpgradeMethod) {
+		if err = saveInstallDeclarations(contract.Name, parameters, sc.TxSimContext); err != nil {
+			err = newContractError(ErrorCodeInvalidParameter, "%s", err)
+		}
+	}
+	if err == nil {
+		err = sc.CallMethod(instance)
+	}
 	r.log.Debugf("contract invoke finished, tx:%s, call method err is %s",
 		txContext.GetTx().Payload.TxId, err)
 	if err != nil {
@@ -98,22 +141,85 @@ func (r *RuntimeInstance) Invoke(contract *commonPb.Contract, method string, byt
 
 	// gas Log
 	gas := instance.GetGasUsed()
-	if gas > protocol.GasLimit {
-		err = fmt.Errorf("contract invoke failed, out of gas %d/%d, tx: %s", gas, int64(protocol.GasLimit),
-			txContext.GetTx().Payload.TxId)
+	if gas > gasLimit {
+		err = newContractError(ErrorCodeOutOfGas, "out of gas %d/%d", gas, gasLimit)
 	}
 	logStr += fmt.Sprintf("used gas %d ", gas)
 	contractResult.GasUsed = gas
 
+	if logs := sc.capturedLogs(); logs != "" {
+		// contract logs of query transactions are returned after the invoke message
+		defer func() {
+			if contractResult.Message != "" {
+				logs = contractResult.Message + "\n" + logs
+			}
+			contractResult.Message = logs
+		}()
+	}
+
 	if err != nil {
-		contractResult.Code = 1
-		msg := fmt.Sprintf("contract invoke failed, %s, tx: %s", err.Error(), txContext.GetTx().Payload.TxId)
-		r.log.Errorf(msg)
-		contractResult.Message = msg
+		contractErr := classifyError(err)
+		contractErr = newContractError(contractErr.Code, "contract invoke failed, %s, tx: %s",
+			contractErr.Detail, txContext.GetTx().Payload.TxId)
+		r.log.Errorf(contractErr.Error())
+		var trapErr *wasmertypes.TrapError
+		if errors.As(err, &trapErr) {
+			backtrace := r.pool.symbols.backtrace(trapErr.Message, trapErr.FunctionName, stack.frames)
+			r.log.Debugf("contract trapped, tx: %s, %s", txContext.GetTx().Payload.TxId, backtrace)
+			if r.config.DebugBacktrace {
+				contractErr.Detail += "\n" + backtrace
+			}
+		}
+		contractResult.Code = sc.abi.resultCode(contractErr.Code)
+		contractResult.Message = contractErr.Error()
 		instanceInfo.errCount++
 		return
 	}
-	contractResult.ContractEvent = sc.ContractEvent
+	// the events of a failing cross contract call are rolled back with its writes
+	if contractResult.Code == uint32(ErrorCodeSuccess) || frame.Depth == 0 {
+		contractResult.ContractEvent = sc.ContractEvent
+	}
 	contractResult.GasUsed = gas
 	return
 }
+
+// abi the sys_call behaviour of the contract sdk, the latest abi version for a pool not reading it
+func (r *RuntimeInstance) abi() *abiBehaviour {
+	if r.pool.abi != nil {
+		return r.pool.abi
+	}
+	return abiBehaviours[maxAbiVersion]
+}
+
+// finishCall keep the writes of a succeeded cross contract call, a failing one leaves no writes
+// and its caller receives the error
+func (r *RuntimeInstance) finishCall(stack *callStack, frame *callFrame, contractResult *commonPb.ContractResult,
+	txContext protocol.TxSimContext) {
+
+	if contractResult.Code == uint32(ErrorCodeSuccess) {
+		err := stack.commit(frame)
+		if err == nil {
+			return
+		}
+		r.log.Errorf("contract invoke commit failed, %s, tx: %s", err.Error(), txContext.GetTx().Payload.TxId)
+		contractErr := newContractError(ErrorCodeSyscall, "%s", err)
+		contractResult.Code = r.abi().resultCode(contractErr.Code)
+		contractResult.Message = contractErr.Error()
+		contractResult.ContractEvent = nil
+	}
+	if err := stack.rollback(frame); err != nil {
+		r.log.Errorf("contract invoke rollback failed, %s, tx: %s", err.Error(), txContext.GetTx().Payload.TxId)
+		contractResult.Message += ". " + err.Error()
+	}
+}
+
+// setPanicResult fail the invocation with the recovered panic
+func setPanicResult(contractResult *commonPb.ContractResult, abi *abiBehaviour, instanceInfo *wrappedInstance,
+	panicErr interface{}) {
+	contractErr := newContractError(ErrorCodePanic, "%v", panicErr)
+	contractResult.Code = abi.resultCode(contractErr.Code)
+	contractResult.Message = contractErr.Error()
+	if instanceInfo != nil {
+		instanceInfo.errCount++
+	}
+}
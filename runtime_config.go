@@ -0,0 +1,100 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+const (
+	// the max number of contract events emitted by one transaction
+	defaultMaxEventCount = 1024
+	// the max total size (topic and data) of contract events emitted by one transaction
+	defaultMaxEventBytes = 1024 * 1024
+	// the max length of a contract event topic
+	defaultMaxEventTopicLen = 255
+	// the max bytes of contract logs of one transaction
+	defaultMaxLogBytes = 64 * 1024
+	// the max contract log lines per second of one contract
+	defaultMaxLogLinesPerSecond = 100
+	// the max gas of an invoke transaction
+	defaultGasLimit = protocol.GasLimit
+	// the max gas of a query transaction, queries are not charged so they may run longer
+	defaultQueryGasLimit = 10 * protocol.GasLimit
+)
+
+// RuntimeConfig configurable limits of the wasmer runtime, every chain has one config
+type RuntimeConfig struct {
+	// max number of contract events per transaction, events of cross contract calls included. 0 is unlimited
+	MaxEventCount int
+	// max total bytes of contract events per transaction, events of cross contract calls included. 0 is unlimited
+	MaxEventBytes int
+	// max length of a contract event topic, 0 is unlimited
+	MaxEventTopicLen int
+	// max bytes of contract logs per transaction, logs beyond are dropped. 0 is unlimited
+	MaxLogBytes int
+	// max contract log lines per second of every contract, lines beyond are dropped. 0 is unlimited
+	MaxLogLinesPerSecond int
+	// return the contract logs of query transactions in ContractResult.Message, for contract developers
+	ReturnQueryLogs bool
+	// max gas of an invoke transaction, the gas limit of the transaction may lower it.
+	// 0 is not unlimited, protocol.GasLimit is used instead
+	GasLimit uint64
+	// max gas of a query transaction, the gas limit of the transaction may lower it.
+	// 0 is not unlimited, protocol.GasLimit is used instead
+	QueryGasLimit uint64
+	// limits of the contract byte code checked at install and upgrade, nil for no limits
+	Admission *AdmissionPolicy
+	// attach the backtrace of a contract trap to ContractResult.Message, for contract developers.
+	// the backtrace is always logged at debug level, the message is part of the transaction result
+	DebugBacktrace bool
+	// the wasm engine running the contracts, the wasmer-go binding if nil. the binding is built with cgo only,
+	// without cgo no contract runs on the nil engine
+	Engine Engine
+}
+
+// DefaultRuntimeConfig return the runtime config used by NewInstancesManager
+func DefaultRuntimeConfig() *RuntimeConfig {
+	return &RuntimeConfig{
+		MaxEventCount:        defaultMaxEventCount,
+		MaxEventBytes:        defaultMaxEventBytes,
+		MaxEventTopicLen:     defaultMaxEventTopicLen,
+		MaxLogBytes:          defaultMaxLogBytes,
+		MaxLogLinesPerSecond: defaultMaxLogLinesPerSecond,
+		GasLimit:             defaultGasLimit,
+		QueryGasLimit:        defaultQueryGasLimit,
+		Admission:            DefaultAdmissionPolicy(),
+	}
+}
+
+var defaultRuntimeConfig = DefaultRuntimeConfig()
+
+// engine return the wasm engine running the contracts
+func (c *RuntimeConfig) engine() Engine {
+	if c.Engine == nil {
+		return defaultEngine
+	}
+	return c.Engine
+}
+
+// txGasLimit return the gas limit of the transaction: the limit field of the transaction if set,
+// no more than the chain limit of its transaction type
+func (c *RuntimeConfig) txGasLimit(tx *commonPb.Transaction) uint64 {
+	chainLimit := c.GasLimit
+	if tx.Payload.GetTxType() == commonPb.TxType_QUERY_CONTRACT {
+		chainLimit = c.QueryGasLimit
+	}
+	if chainLimit == 0 {
+		chainLimit = protocol.GasLimit
+	}
+	if txLimit := tx.Payload.GetLimit().GetGasLimit(); txLimit > 0 && txLimit < chainLimit {
+		return txLimit
+	}
+	return chainLimit
+}
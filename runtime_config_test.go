@@ -0,0 +1,42 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"testing"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+)
+
+func TestTxGasLimitOfPayload(t *testing.T) {
+	config := &RuntimeConfig{GasLimit: 100}
+	limited := func(limit *commonPb.Limit) *commonPb.Transaction {
+		return &commonPb.Transaction{Payload: &commonPb.Payload{TxType: commonPb.TxType_INVOKE_CONTRACT, Limit: limit}}
+	}
+	if gas := config.txGasLimit(limited(&commonPb.Limit{GasLimit: 5})); gas != 5 {
+		t.Errorf("expected the gas limit of the limit field, got %d", gas)
+	}
+	if gas := config.txGasLimit(limited(&commonPb.Limit{GasLimit: 500})); gas != 100 {
+		t.Errorf("expected the limit field no more than the chain limit, got %d", gas)
+	}
+	if gas := config.txGasLimit(limited(nil)); gas != 100 {
+		t.Errorf("expected the chain limit without the limit field set, got %d", gas)
+	}
+}
+
+func TestTxGasLimitOfChain(t *testing.T) {
+	config := &RuntimeConfig{GasLimit: 100, QueryGasLimit: 1000}
+	invoke := &commonPb.Transaction{Payload: &commonPb.Payload{TxType: commonPb.TxType_INVOKE_CONTRACT}}
+	query := &commonPb.Transaction{Payload: &commonPb.Payload{TxType: commonPb.TxType_QUERY_CONTRACT}}
+	if gas := config.txGasLimit(invoke); gas != 100 {
+		t.Errorf("expected the invoke limit, got %d", gas)
+	}
+	if gas := config.txGasLimit(query); gas != 1000 {
+		t.Errorf("expected the query limit, got %d", gas)
+	}
+}
@@ -8,7 +8,6 @@ SPDX-License-Identifier: Apache-2.0
 package wasmer
 
 import (
-	"fmt"
 	"strconv"
 	"sync"
 
@@ -17,7 +16,6 @@ import (
 	"chainmaker.org/chainmaker/common/v2/serialize"
 	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/protocol/v2"
-	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go"
 )
 
 // SimContext record the contract context
@@ -26,15 +24,28 @@ type SimContext struct {
 	Contract       *commonPb.Contract
 	ContractResult *commonPb.ContractResult
 	Log            *logger.CMLogger
-	Instance       *wasmer.Instance
+	Instance       InstanceHandle
 
 	method        string
 	parameters    map[string][]byte
 	CtxPtr        int32
-	GetStateCache []byte // cache call method GetStateLen value result, one cache per transaction
 	ChainId       string
 	ContractEvent []*commonPb.ContractEvent
 	SpecialTxType protocol.ExecOrderTxType
+
+	results *resultStore // results of "Len" syscalls waiting to be fetched, one store per transaction
+	config  *RuntimeConfig
+	abi     *abiBehaviour // sys_call behaviour of the contract sdk
+
+	eventBytes        int         // total bytes of ContractEvent
+	eventSchema       EventSchema // event schema of the contract, nil if not declared
+	eventSchemaLoaded bool
+
+	logLimiter         *logRateLimiter // log rate limit of the contract
+	logBytes           int             // bytes of contract logs written
+	logBudgetExhausted bool
+	logDropped         int      // contract log lines dropped by the limits
+	logs               []string // contract logs returned in the result of query transactions
 }
 
 // NewSimContext for every transaction
@@ -43,6 +54,9 @@ func NewSimContext(method string, log *logger.CMLogger, chainId string) *SimCont
 		method:  method,
 		Log:     log,
 		ChainId: chainId,
+		results: newResultStore(),
+		config:  defaultRuntimeConfig,
+		abi:     abiBehaviours[maxAbiVersion],
 	}
 
 	sc.putCtxPointer()
@@ -51,59 +65,47 @@ func NewSimContext(method string, log *logger.CMLogger, chainId string) *SimCont
 }
 
 // CallMethod will call contract method
-func (sc *SimContext) CallMethod(instance *wasmer.Instance) error {
+func (sc *SimContext) CallMethod(instance InstanceHandle) error {
 	var bytes []byte
 
-	runtimeFn, ok := instance.Exports[protocol.ContractRuntimeTypeMethod]
-	if !ok {
-		return fmt.Errorf("method [%s] not export", protocol.ContractRuntimeTypeMethod)
-	}
-	sdkType, err := runtimeFn()
+	runtimeSdkType, err := instance.Call(protocol.ContractRuntimeTypeMethod)
 	if err != nil {
 		return err
 	}
 
-	runtimeSdkType := sdkType.ToI32()
 	if int32(commonPb.RuntimeType_WASMER) == runtimeSdkType {
 		sc.parameters[protocol.ContractContextPtrParam] = []byte(strconv.Itoa(int(sc.CtxPtr)))
 		ec := serialize.NewEasyCodecWithMap(sc.parameters)
 		bytes = ec.Marshal()
 	} else {
-		return fmt.Errorf("runtime type error, expect rust:[%d], but got %d",
+		return newContractError(ErrorCodeRuntimeType, "runtime type error, expect rust:[%d], but got %d",
 			uint64(commonPb.RuntimeType_WASMER), runtimeSdkType)
 	}
 
 	return sc.callContract(instance, sc.method, bytes)
 }
 
-func (sc *SimContext) callContract(instance *wasmer.Instance, methodName string, bytes []byte) error {
+func (sc *SimContext) callContract(instance InstanceHandle, methodName string, bytes []byte) error {
 
 	lengthOfSubject := len(bytes)
 
-	exports := instance.Exports[protocol.ContractAllocateMethod]
 	// Allocate memory for the subject, and get a pointer to it.
-	allocateResult, err := exports(lengthOfSubject)
+	dataPtr, err := instance.Call(protocol.ContractAllocateMethod, int32(lengthOfSubject))
 	if err != nil {
 		sc.Log.Errorf("contract invoke %s failed, %s", protocol.ContractAllocateMethod, err.Error())
-		return fmt.Errorf("%s invoke failed. There may not be enough memory or CPU", protocol.ContractAllocateMethod)
+		return newContractError(classifyError(err).Code, "%s invoke failed. There may not be enough memory or CPU",
+			protocol.ContractAllocateMethod)
 	}
-	dataPtr := allocateResult.ToI32()
 
-	// Write the subject into the memory.
-	memory := instance.Memory.Data()[dataPtr:]
-
-	//copy(memory, bytes)
-	for nth := 0; nth < lengthOfSubject; nth++ {
-		memory[nth] = bytes[nth]
+	// Write the subject into the memory, allocate may have grown it.
+	if err = instance.Memory().WriteBytes(uint32(dataPtr), bytes); err != nil {
+		sc.Log.Errorf("contract invoke %s failed, %s", protocol.ContractAllocateMethod, err.Error())
+		return newContractError(ErrorCodeTrapMemoryOutOfBounds, "%s returned a pointer %d out of the memory",
+			protocol.ContractAllocateMethod, dataPtr)
 	}
 
 	// Calls the `invoke` exported function. Given the pointer to the subject.
-	export, ok := instance.Exports[methodName]
-	if !ok {
-		return fmt.Errorf("method [%s] not export", methodName)
-	}
-
-	_, err = export()
+	_, err = instance.Call(methodName)
 	if err != nil {
 		return err
 	}
@@ -114,8 +116,8 @@ func (sc *SimContext) callContract(instance *wasmer.Instance, methodName string,
 }
 
 // CallDeallocate deallocate vm memory before closing the instance
-func CallDeallocate(instance *wasmer.Instance) error {
-	_, err := instance.Exports[protocol.ContractDeallocateMethod](0)
+func CallDeallocate(instance InstanceHandle) error {
+	_, err := instance.Call(protocol.ContractDeallocateMethod, 0)
 	return err
 }
 
@@ -0,0 +1,155 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"chainmaker.org/chainmaker/common/v2/serialize"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go/wasmertypes"
+)
+
+const (
+	// request body key, the memory address where a "Len" syscall writes the result handle
+	resultHandlePtrKey = "handle_ptr"
+	// request body key, the result handle presented by a fetch syscall
+	resultHandleKey = "result_handle"
+	// request body keys ending with this suffix are memory addresses, not part of the request identity
+	memoryPtrKeySuffix = "_ptr"
+)
+
+// pendingResult a result produced by a "Len" syscall, waiting for the matching fetch syscall
+type pendingResult struct {
+	handle int32
+	// the syscall method allowed to consume the result
+	fetchMethod string
+	// the request body without memory addresses, a fetch must present the same request
+	identity string
+	data     []byte
+}
+
+// resultStore keeps the results of "Len" syscalls until they are fetched, one store per SimContext
+type resultStore struct {
+	lastHandle int32
+	results    map[int32]*pendingResult
+}
+
+func newResultStore() *resultStore {
+	return &resultStore{
+		results: make(map[int32]*pendingResult),
+	}
+}
+
+// put save data for fetchMethod and return its handle.
+// a pending result of the same request is replaced, its handle becomes stale
+func (rs *resultStore) put(fetchMethod string, identity string, data []byte) int32 {
+	for handle, result := range rs.results {
+		if result.fetchMethod == fetchMethod && result.identity == identity {
+			delete(rs.results, handle)
+		}
+	}
+	rs.lastHandle++
+	rs.results[rs.lastHandle] = &pendingResult{
+		handle:      rs.lastHandle,
+		fetchMethod: fetchMethod,
+		identity:    identity,
+		data:        data,
+	}
+	return rs.lastHandle
+}
+
+// take remove and return the result of the handle, the handle must belong to fetchMethod and identity
+func (rs *resultStore) take(fetchMethod string, identity string, handle int32) ([]byte, error) {
+	result, ok := rs.results[handle]
+	if !ok {
+		return nil, fmt.Errorf("[%s] result handle %d is stale or unknown", fetchMethod, handle)
+	}
+	if result.fetchMethod != fetchMethod {
+		return nil, fmt.Errorf("[%s] result handle %d belongs to %s", fetchMethod, handle, result.fetchMethod)
+	}
+	if result.identity != identity {
+		return nil, fmt.Errorf("[%s] result handle %d was produced by another request", fetchMethod, handle)
+	}
+	delete(rs.results, handle)
+	return result.data, nil
+}
+
+// find return the handle of the pending result of the request
+func (rs *resultStore) find(fetchMethod string, identity string) (int32, error) {
+	pending := false
+	for handle, result := range rs.results {
+		if result.fetchMethod != fetchMethod {
+			continue
+		}
+		if result.identity == identity {
+			return handle, nil
+		}
+		pending = true
+	}
+	if pending {
+		return 0, fmt.Errorf("[%s] the pending result was produced by another request", fetchMethod)
+	}
+	return 0, fmt.Errorf("[%s] no pending result, the length method must be called first", fetchMethod)
+}
+
+// requestIdentity return the request body without memory addresses and handles,
+// a "Len" syscall and its fetch syscall carry the same identity
+func requestIdentity(requestBody []byte) string {
+	items := serialize.NewEasyCodecWithBytes(requestBody).GetItems()
+	fields := make([]string, 0, len(items))
+	for _, item := range items {
+		if item.Key == resultHandleKey || strings.HasSuffix(item.Key, memoryPtrKeySuffix) {
+			continue
+		}
+		fields = append(fields, fmt.Sprintf("%s=%v", item.Key, item.Value))
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, "&")
+}
+
+// putResult save the result of a "Len" syscall and return its handle.
+// sdks with handle support pass handle_ptr, the handle is written to vm memory so that the fetch can present it
+func (sc *SimContext) putResult(fetchMethod string, requestBody []byte, memory *wasmertypes.MemoryView, data []byte) error {
+	if !sc.abi.resultHandles {
+		// sdk without handle support, the fetch is matched by request identity
+		sc.results.put(fetchMethod, requestIdentity(requestBody), data)
+		return nil
+	}
+
+	req := serialize.NewEasyCodecWithBytes(requestBody)
+	handlePtr, err := req.GetInt32(resultHandlePtrKey)
+	if err != nil {
+		return fmt.Errorf("[%s] request body has no %s", fetchMethod, resultHandlePtrKey)
+	}
+	handle := sc.results.put(fetchMethod, requestIdentity(requestBody), data)
+	if handlePtr < 0 || memory.WriteU32(uint32(handlePtr), uint32(handle)) != nil {
+		return fmt.Errorf("[%s] handle_ptr %d out of memory range", fetchMethod, handlePtr)
+	}
+	return nil
+}
+
+// takeResult remove and return the result saved by the "Len" syscall of the same request.
+// sdks with handle support must present the handle, the others are matched by request identity.
+// mismatched or stale handles are rejected instead of returning another request's data
+func (sc *SimContext) takeResult(fetchMethod string, requestBody []byte) ([]byte, error) {
+	identity := requestIdentity(requestBody)
+
+	req := serialize.NewEasyCodecWithBytes(requestBody)
+	handle, err := req.GetInt32(resultHandleKey)
+	if err != nil {
+		if sc.abi.resultHandles {
+			return nil, fmt.Errorf("[%s] request body has no %s", fetchMethod, resultHandleKey)
+		}
+		if handle, err = sc.results.find(fetchMethod, identity); err != nil {
+			return nil, err
+		}
+	}
+	return sc.results.take(fetchMethod, identity, handle)
+}
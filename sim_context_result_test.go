@@ -0,0 +1,115 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"testing"
+
+	"chainmaker.org/chainmaker/common/v2/serialize"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go/wasmertypes"
+)
+
+// getStateRequest the request body of a get state sys_call of the key, with its memory addresses
+func getStateRequest(key string, valuePtr int32, handle ...int32) []byte {
+	request := serialize.NewEasyCodec()
+	request.AddString("key", key)
+	request.AddInt32("value_ptr", valuePtr)
+	request.AddInt32(resultHandlePtrKey, 0)
+	for _, h := range handle {
+		request.AddInt32(resultHandleKey, h)
+	}
+	return request.Marshal()
+}
+
+func TestRequestIdentity(t *testing.T) {
+	if requestIdentity(getStateRequest("k", 8)) != requestIdentity(getStateRequest("k", 64, 3)) {
+		t.Error("expected the memory addresses and the handle out of the identity")
+	}
+	if requestIdentity(getStateRequest("k", 8)) == requestIdentity(getStateRequest("other", 8)) {
+		t.Error("expected requests of other keys to differ")
+	}
+
+	first := serialize.NewEasyCodec()
+	first.AddString("a", "1")
+	first.AddString("b", "2")
+	second := serialize.NewEasyCodec()
+	second.AddString("b", "2")
+	second.AddString("a", "1")
+	if requestIdentity(first.Marshal()) != requestIdentity(second.Marshal()) {
+		t.Error("expected the identity independent of the order of the items")
+	}
+}
+
+func TestResultStoreHandles(t *testing.T) {
+	store := newResultStore()
+	method, identity := protocol.ContractMethodGetStateLen, requestIdentity(getStateRequest("k", 8))
+
+	handle := store.put(method, identity, []byte("v"))
+	if _, err := store.take(protocol.ContractMethodCallContract, identity, handle); err == nil {
+		t.Error("expected the handle of another fetch method to be rejected")
+	}
+	if _, err := store.take(method, requestIdentity(getStateRequest("other", 8)), handle); err == nil {
+		t.Error("expected the handle of another request to be rejected")
+	}
+	if data, err := store.take(method, identity, handle); err != nil || string(data) != "v" {
+		t.Fatalf("expected the result of the handle, got %q, %v", data, err)
+	}
+	if _, err := store.take(method, identity, handle); err == nil {
+		t.Error("expected a handle taken once to be stale")
+	}
+
+	// the length method called twice for the same request replaces the pending result
+	replaced := store.put(method, identity, []byte("old"))
+	pending := store.put(method, identity, []byte("new"))
+	if _, err := store.take(method, identity, replaced); err == nil {
+		t.Error("expected the handle of a replaced result to be stale")
+	}
+	if found, err := store.find(method, identity); err != nil || found != pending {
+		t.Errorf("expected the pending handle %d, got %d, %v", pending, found, err)
+	}
+	if data, err := store.take(method, identity, pending); err != nil || string(data) != "new" {
+		t.Errorf("expected the replacing result, got %q, %v", data, err)
+	}
+
+	store.put(method, identity, []byte("v"))
+	if _, err := store.find(method, requestIdentity(getStateRequest("other", 8))); err == nil {
+		t.Error("expected no pending result for another request")
+	}
+	if _, err := store.find(protocol.ContractMethodCallContract, identity); err == nil {
+		t.Error("expected no pending result for another fetch method")
+	}
+}
+
+func TestTakeResultRequiresTheHandle(t *testing.T) {
+	memory := wasmertypes.NewMemoryView(&growingMemory{data: make([]byte, 64)})
+	method := protocol.ContractMethodGetStateLen
+
+	for _, version := range []AbiVersion{AbiVersion1, AbiVersion2} {
+		sc := &SimContext{results: newResultStore(), abi: abiBehaviours[version]}
+		if err := sc.putResult(method, getStateRequest("k", 8), memory, []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+		data, err := sc.takeResult(method, getStateRequest("k", 8))
+		if version == AbiVersion1 && (err != nil || string(data) != "v") {
+			t.Errorf("abi version 1: expected the result matched by the request, got %q, %v", data, err)
+		}
+		if version == AbiVersion2 && err == nil {
+			t.Error("abi version 2: expected a fetch without handle to be rejected")
+		}
+	}
+
+	sc := &SimContext{results: newResultStore(), abi: abiBehaviours[AbiVersion2]}
+	if err := sc.putResult(method, getStateRequest("k", 8), memory, []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	handle, _ := memory.ReadU32(0)
+	if data, err := sc.takeResult(method, getStateRequest("k", 8, int32(handle))); err != nil || string(data) != "v" {
+		t.Errorf("abi version 2: expected the result of the handle written to memory, got %q, %v", data, err)
+	}
+}
@@ -7,32 +7,21 @@ SPDX-License-Identifier: Apache-2.0
 package wasmer
 
 import (
-	"strconv"
+	"fmt"
 	"sync"
-	"unsafe"
 
 	"chainmaker.org/chainmaker/store/v2/types"
 
 	"chainmaker.org/chainmaker/logger/v2"
 	"chainmaker.org/chainmaker/vm/v2"
 
-	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go/wasmertypes"
 
 	"chainmaker.org/chainmaker/common/v2/serialize"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/protocol/v2"
 )
 
-// #include <stdlib.h>
-
-// extern int sysCall(void *context, int requestHeaderPtr, int requestHeaderLen, int requestBodyPtr, int requestBodyLen);
-// extern void logMessage(void *context, int pointer, int length);
-// extern int fdWrite(void *contextfd,int iovs,int iovsPtr ,int iovsLen,int nwrittenPtr);
-// extern int fdRead(void *contextfd,int iovs,int iovsPtr ,int iovsLen,int nwrittenPtr);
-// extern int fdClose(void *contextfd,int iovs,int iovsPtr ,int iovsLen,int nwrittenPtr);
-// extern int fdSeek(void *contextfd,int iovs,int iovsPtr ,int iovsLen,int nwrittenPtr);
-// extern void procExit(void *contextfd,int exitCode);
-import "C"
-
 var log = logger.GetLogger(logger.MODULE_VM)
 
 // Wacsi WebAssembly chainmaker system interface
@@ -42,29 +31,35 @@ var wacsi = vm.NewWacsi(log, &types.StandardSqlVerify{})
 type WaciInstance struct {
 	Sc          *SimContext
 	RequestBody []byte // sdk request param
-	Memory      []byte // vm memory
 	ChainId     string
+
+	// vm memory, resolved on every access: a syscall re-entering the vm may grow and move it
+	memory *wasmertypes.MemoryView
 }
 
 // LogMessage print log to file
 func (s *WaciInstance) LogMessage() int32 {
-	s.Sc.Log.Debugf("wasmer log>> [%s] %s", s.Sc.TxSimContext.GetTx().Payload.TxId, string(s.RequestBody))
+	s.Sc.contractLog(LogLevelDebug, string(s.RequestBody))
 	return protocol.ContractSdkSignalResultSuccess
 }
 
-// logMessage print log to file
-//export logMessage
-func logMessage(context unsafe.Pointer, pointer int32, length int32) {
-	var instanceContext = wasmer.IntoInstanceContext(context)
-	var memory = instanceContext.Memory().Data()
-
-	gotText := string(memory[pointer : pointer+length])
-	log.Debugf("wasmer log>> " + gotText)
+// LogMessageLevel print log to file with the level given by the contract
+func (s *WaciInstance) LogMessageLevel() int32 {
+	req := serialize.NewEasyCodecWithBytes(s.RequestBody)
+	level, err := req.GetInt32("level")
+	if err != nil {
+		level = int32(LogLevelDebug)
+	}
+	msg, err := req.GetString("msg")
+	if err != nil {
+		return s.recordMsg("LogMessageLevel: request body has no msg")
+	}
+	s.Sc.contractLog(LogLevel(level), msg)
+	return protocol.ContractSdkSignalResultSuccess
 }
 
-// sysCall wasmer vm call chain entry
-//export sysCall
-func sysCall(context unsafe.Pointer,
+// handleSysCall the engine independent part of sys_call, given the memory of the calling instance
+func handleSysCall(view *wasmertypes.MemoryView,
 	requestHeaderPtr int32, requestHeaderLen int32,
 	requestBodyPtr int32, requestBodyLen int32) int32 {
 
@@ -73,15 +68,17 @@ func sysCall(context unsafe.Pointer,
 		return protocol.ContractSdkSignalResultFail
 	}
 
-	// get memory
-	instanceContext := wasmer.IntoInstanceContext(context)
-	memory := instanceContext.Memory().Data()
-
 	// get request header/body from memory
-	requestHeaderBytes := make([]byte, requestHeaderLen)
-	copy(requestHeaderBytes, memory[requestHeaderPtr:requestHeaderPtr+requestHeaderLen])
-	requestBodyBytes := make([]byte, requestBodyLen)
-	copy(requestBodyBytes, memory[requestBodyPtr:requestBodyPtr+requestBodyLen])
+	requestHeaderBytes, err := view.ReadBytes(uint32(requestHeaderPtr), uint32(requestHeaderLen))
+	if err != nil {
+		log.Errorf("wasmer log>> read requestHeader failed, %s", err.Error())
+		return protocol.ContractSdkSignalResultFail
+	}
+	requestBodyBytes, err := view.ReadBytes(uint32(requestBodyPtr), uint32(requestBodyLen))
+	if err != nil {
+		log.Errorf("wasmer log>> read requestBody failed, %s", err.Error())
+		return protocol.ContractSdkSignalResultFail
+	}
 	requestHeader := serialize.NewEasyCodecWithBytes(requestHeaderBytes)
 
 	// get SimContext number from request header
@@ -97,15 +94,19 @@ func sysCall(context unsafe.Pointer,
 			string(requestHeaderBytes), string(requestBodyBytes), err)
 	}
 
-	vbm := GetVmBridgeManager()
-	simContext := vbm.get(ctxPtr.(int32))
+	ctxNum, _ := ctxPtr.(int32)
+	simContext := GetVmBridgeManager().get(ctxNum)
+	if simContext == nil {
+		log.Errorf("wasmer log>> sys_call [%v] with no context of ctx_ptr %v", method, ctxPtr)
+		return protocol.ContractSdkSignalResultFail
+	}
 
 	// create new WaciInstance for operate on blockchain
 	waciInstance := &WaciInstance{
 		Sc:          simContext,
 		RequestBody: requestBodyBytes,
-		Memory:      memory,
 		ChainId:     simContext.ChainId,
+		memory:      view,
 	}
 
 	log.Infof("### enter syscall handling, method = '%v'", method)
@@ -122,10 +123,20 @@ func sysCall(context unsafe.Pointer,
 //nolint
 func (s *WaciInstance) invoke(method interface{}) int32 {
 	log.Infof("sysCall() => '%s' method", method)
+	if s.Sc.TxSimContext == nil {
+		// e.g. the abi_version export, run when the pool is created
+		return s.recordMsg(fmt.Sprintf("sys_call [%s] is not allowed out of a transaction", method))
+	}
+	if !s.Sc.abi.supports(method.(string)) {
+		return s.recordMsg(fmt.Sprintf("sys_call [%s] is not supported by the contract sdk abi version %d",
+			method, s.Sc.abi.version))
+	}
 	switch method.(string) {
 	// common
 	case protocol.ContractMethodLogMessage:
 		return s.LogMessage()
+	case ContractMethodLogMessageLevel:
+		return s.LogMessageLevel()
 	case protocol.ContractMethodSuccessResult:
 		return s.SuccessResult()
 	case protocol.ContractMethodErrorResult:
@@ -136,6 +147,10 @@ func (s *WaciInstance) invoke(method interface{}) int32 {
 		return s.CallContractLen()
 	case protocol.ContractMethodEmitEvent:
 		return s.EmitEvent()
+	case ContractMethodGetCallStackLen:
+		return s.GetCallStackLen()
+	case ContractMethodGetCallStack:
+		return s.GetCallStack()
 		// paillier
 	case protocol.ContractMethodGetPaillierOperationResultLen:
 		return s.GetPaillierResultLen()
@@ -203,28 +218,58 @@ func (s *WaciInstance) ErrorResult() int32 {
 	return wacsi.ErrorResult(s.Sc.ContractResult, s.RequestBody)
 }
 
-//  CallContractLen invoke cross contract calls, save result to cache and putout result length
+//  CallContractLen invoke cross contract calls, save result to result store and putout result length
 func (s *WaciInstance) CallContractLen() int32 {
 	return s.callContractCore(true)
 }
 
-//  CallContractLen get cross contract call result from cache
+//  CallContractLen get cross contract call result from result store
 func (s *WaciInstance) CallContract() int32 {
 	return s.callContractCore(false)
 }
 
 func (s *WaciInstance) callContractCore(isLen bool) int32 {
-	result, gas, specialTxType, err := wacsi.CallContract(s.RequestBody, s.Sc.TxSimContext, s.Memory,
-		s.Sc.GetStateCache, s.Sc.Instance.GetGasUsed(), isLen)
-	if result == nil {
-		s.Sc.GetStateCache = nil // reset data
-		//s.Sc.ContractEvent = nil
-	} else {
-		s.Sc.GetStateCache = result.Result // reset data
-		s.Sc.ContractEvent = append(s.Sc.ContractEvent, result.ContractEvent...)
+	data, err := s.pendingResult(isLen, protocol.ContractMethodCallContract)
+	if err != nil {
+		s.recordMsg(err.Error())
+		return protocol.ContractSdkSignalResultFail
+	}
+	stack := getCallStack(s.Sc.TxSimContext)
+	if isLen && s.Sc.abi.gasCaps {
+		if err = stack.setCalleeGasCap(s.RequestBody); err != nil {
+			s.recordMsg(err.Error())
+			return protocol.ContractSdkSignalResultFail
+		}
+	}
+	var result *commonPb.ContractResult
+	var specialTxType protocol.ExecOrderTxType
+	gas := s.Sc.Instance.GetGasUsed()
+	err = s.scratchValue(isLen, data, func(requestBody []byte, memory []byte) (callErr error) {
+		result, gas, specialTxType, callErr = wacsi.CallContract(requestBody, s.Sc.TxSimContext, memory, data,
+			gas, isLen)
+		return callErr
+	})
+	if callee := stack.takeCalleeGas(); callee != nil {
+		// the callee is charged by the gas it used, the rest of its cap stays with the caller
+		gas = callee.gasUsed
+		if callee.outOfGas {
+			s.Sc.Instance.SetGasUsed(gas)
+			s.Sc.Log.Warnf("wasmer log>> [%s] cross contract call out of gas, %v", s.Sc.Contract.Name, err)
+			return s.calleeOutOfGas(isLen, gas)
+		}
+	}
+	var resultData []byte
+	if result != nil {
+		resultData = result.Result
+		if eventErr := s.Sc.addEvents(result.ContractEvent...); eventErr != nil && err == nil {
+			err = eventErr
+		}
 	}
 	s.Sc.Instance.SetGasUsed(gas)
 	s.Sc.SpecialTxType = specialTxType
+	if err == nil {
+		err = s.saveResult(isLen, protocol.ContractMethodCallContract, resultData)
+	}
 	if err != nil {
 		s.recordMsg(err.Error())
 		return protocol.ContractSdkSignalResultFail
@@ -232,14 +277,111 @@ func (s *WaciInstance) callContractCore(isLen bool) int32 {
 	return protocol.ContractSdkSignalResultSuccess
 }
 
+// calleeOutOfGas fail the cross contract call whose callee ran out of its gas cap, the caller is not failed:
+// the out of gas error is the result of the call, its length put out like the result of a succeeded call
+func (s *WaciInstance) calleeOutOfGas(isLen bool, gas uint64) int32 {
+	callErr := newContractError(ErrorCodeOutOfGas, "cross contract call out of its gas cap, %d gas used", gas)
+	data := []byte(callErr.Error())
+	err := s.writeValue(isLen, data)
+	if err == nil {
+		err = s.saveResult(isLen, protocol.ContractMethodCallContract, data)
+	}
+	if err != nil {
+		s.recordMsg(err.Error())
+	}
+	return protocol.ContractSdkSignalResultFail
+}
+
+// GetCallStackLen put out the length of the call stack of the transaction
+func (s *WaciInstance) GetCallStackLen() int32 {
+	return s.getCallStackCore(true)
+}
+
+// GetCallStack get the call stack of the transaction, the callers first
+func (s *WaciInstance) GetCallStack() int32 {
+	return s.getCallStackCore(false)
+}
+
+func (s *WaciInstance) getCallStackCore(isLen bool) int32 {
+	data, err := s.pendingResult(isLen, ContractMethodGetCallStack)
+	if err == nil && isLen {
+		data, err = getCallStack(s.Sc.TxSimContext).marshal()
+	}
+	if err == nil {
+		err = s.writeValue(isLen, data)
+	}
+	if err == nil {
+		err = s.saveResult(isLen, ContractMethodGetCallStack, data)
+	}
+	if err != nil {
+		s.recordMsg(err.Error())
+		return protocol.ContractSdkSignalResultFail
+	}
+	return protocol.ContractSdkSignalResultSuccess
+}
+
+// writeValue write the value length for a "Len" syscall, otherwise the value, to vm memory at value_ptr
+func (s *WaciInstance) writeValue(isLen bool, value []byte) error {
+	valuePtr, err := serialize.NewEasyCodecWithBytes(s.RequestBody).GetInt32("value_ptr")
+	if err != nil {
+		return fmt.Errorf("request body has no value_ptr")
+	}
+	return s.writeValueAt(valuePtr, isLen, value)
+}
+
+// scratchValue call a wacsi function writing the value length for a "Len" syscall, otherwise the value, at value_ptr.
+// the function writes to a scratch memory at 0 instead of vm memory: a cross contract call may re-enter the vm and
+// grow and move its memory, so the value is copied to vm memory, resolved again, once the function returned
+func (s *WaciInstance) scratchValue(isLen bool, value []byte,
+	call func(requestBody []byte, memory []byte) error) error {
+	req := serialize.NewEasyCodecWithBytes(s.RequestBody)
+	valuePtr, err := req.GetInt32("value_ptr")
+	if err != nil {
+		return fmt.Errorf("request body has no value_ptr")
+	}
+	req.RemoveKey("value_ptr")
+	req.AddInt32("value_ptr", 0)
+
+	scratch := make([]byte, len(value))
+	if isLen {
+		scratch = make([]byte, 4)
+	}
+	if err = call(req.Marshal(), scratch); err != nil {
+		return err
+	}
+	return s.writeValueAt(valuePtr, false, scratch)
+}
+
+// writeValueAt write the value length for a "Len" syscall, otherwise the value, to vm memory at valuePtr
+func (s *WaciInstance) writeValueAt(valuePtr int32, isLen bool, value []byte) error {
+	if valuePtr < 0 {
+		return fmt.Errorf("value_ptr %d out of memory range", valuePtr)
+	}
+	var err error
+	if isLen {
+		err = s.memory.WriteU32(uint32(valuePtr), uint32(len(value)))
+	} else {
+		err = s.memory.WriteBytes(uint32(valuePtr), value)
+	}
+	if err != nil {
+		return fmt.Errorf("value_ptr %d out of memory range, %s", valuePtr, err.Error())
+	}
+	return nil
+}
+
 // EmitEvent emit event to chain
 func (s *WaciInstance) EmitEvent() int32 {
 	contractEvent, err := wacsi.EmitEvent(s.RequestBody, s.Sc.TxSimContext, s.Sc.Contract, s.Sc.Log)
+	if err == nil {
+		err = s.Sc.checkEventSchema(contractEvent)
+	}
+	if err == nil {
+		err = s.Sc.addEvents(contractEvent)
+	}
 	if err != nil {
 		s.recordMsg(err.Error())
 		return protocol.ContractSdkSignalResultFail
 	}
-	s.Sc.ContractEvent = append(s.Sc.ContractEvent, contractEvent)
 	return protocol.ContractSdkSignalResultSuccess
 }
 
@@ -254,8 +396,18 @@ func (s *WaciInstance) GetBulletProofsResult() int32 {
 }
 
 func (s *WaciInstance) getBulletProofsResultCore(isLen bool) int32 {
-	data, err := wacsi.BulletProofsOperation(s.RequestBody, s.Memory, s.Sc.GetStateCache, isLen)
-	s.Sc.GetStateCache = data // reset data
+	data, err := s.pendingResult(isLen, protocol.ContractMethodGetBulletproofsResult)
+	if err != nil {
+		s.recordMsg(err.Error())
+		return protocol.ContractSdkSignalResultFail
+	}
+	err = s.scratchValue(isLen, data, func(requestBody []byte, memory []byte) (opErr error) {
+		data, opErr = wacsi.BulletProofsOperation(requestBody, memory, data, isLen)
+		return opErr
+	})
+	if err == nil {
+		err = s.saveResult(isLen, protocol.ContractMethodGetBulletproofsResult, data)
+	}
 	if err != nil {
 		s.recordMsg(err.Error())
 		return protocol.ContractSdkSignalResultFail
@@ -274,8 +426,18 @@ func (s *WaciInstance) GetPaillierResult() int32 {
 }
 
 func (s *WaciInstance) getPaillierResultCore(isLen bool) int32 {
-	data, err := wacsi.PaillierOperation(s.RequestBody, s.Memory, s.Sc.GetStateCache, isLen)
-	s.Sc.GetStateCache = data // reset data
+	data, err := s.pendingResult(isLen, protocol.ContractMethodGetPaillierOperationResult)
+	if err != nil {
+		s.recordMsg(err.Error())
+		return protocol.ContractSdkSignalResultFail
+	}
+	err = s.scratchValue(isLen, data, func(requestBody []byte, memory []byte) (opErr error) {
+		data, opErr = wacsi.PaillierOperation(requestBody, memory, data, isLen)
+		return opErr
+	})
+	if err == nil {
+		err = s.saveResult(isLen, protocol.ContractMethodGetPaillierOperationResult, data)
+	}
 	if err != nil {
 		s.recordMsg(err.Error())
 		return protocol.ContractSdkSignalResultFail
@@ -283,41 +445,26 @@ func (s *WaciInstance) getPaillierResultCore(isLen bool) int32 {
 	return protocol.ContractSdkSignalResultSuccess
 }
 
-// wasi
-//export fdWrite
-func fdWrite(context unsafe.Pointer, fd int32, iovsPtr int32, iovsLen int32, nwrittenPtr int32) (err int32) {
-	return protocol.ContractSdkSignalResultSuccess
-}
-
-//export fdRead
-func fdRead(context unsafe.Pointer, fd int32, iovsPtr int32, iovsLen int32, nwrittenPtr int32) (err int32) {
-	return protocol.ContractSdkSignalResultSuccess
-}
-
-//export fdClose
-func fdClose(context unsafe.Pointer, fd int32, iovsPtr int32, iovsLen int32, nwrittenPtr int32) (err int32) {
-	return protocol.ContractSdkSignalResultSuccess
-}
-
-//export fdSeek
-func fdSeek(context unsafe.Pointer, fd int32, iovsPtr int32, iovsLen int32, nwrittenPtr int32) (err int32) {
-	return protocol.ContractSdkSignalResultSuccess
+func (s *WaciInstance) recordMsg(msg string) int32 {
+	setError(s.Sc.ContractResult, s.Sc.abi, newContractError(ErrorCodeSyscall, "%s", msg))
+	s.Sc.Log.Errorf("wasmer log>> [%s] %s", s.Sc.Contract.Name, msg)
+	return protocol.ContractSdkSignalResultFail
 }
 
-//export procExit
-func procExit(context unsafe.Pointer, exitCode int32) {
-	panic("exit called by contract, code:" + strconv.Itoa(int(exitCode)))
+// pendingResult return the result saved by the "Len" syscall of the same request, nil for a "Len" syscall
+func (s *WaciInstance) pendingResult(isLen bool, fetchMethod string) ([]byte, error) {
+	if isLen {
+		return nil, nil
+	}
+	return s.Sc.takeResult(fetchMethod, s.RequestBody)
 }
 
-func (s *WaciInstance) recordMsg(msg string) int32 {
-	if len(s.Sc.ContractResult.Message) > 0 {
-		s.Sc.ContractResult.Message += ". error message: " + msg
-	} else {
-		s.Sc.ContractResult.Message += "error message: " + msg
+// saveResult save the result of a "Len" syscall until fetchMethod is called with the same request
+func (s *WaciInstance) saveResult(isLen bool, fetchMethod string, data []byte) error {
+	if !isLen {
+		return nil
 	}
-	s.Sc.ContractResult.Code = 1
-	s.Sc.Log.Errorf("wasmer log>> [%s] %s", s.Sc.Contract.Name, msg)
-	return protocol.ContractSdkSignalResultFail
+	return s.Sc.putResult(fetchMethod, s.RequestBody, s.memory, data)
 }
 
 var (
@@ -326,7 +473,6 @@ var (
 )
 
 type vmBridgeManager struct {
-	//wasmImports *wasm.Imports
 	pointerLock     sync.Mutex
 	simContextCache map[int32]*SimContext
 }
@@ -340,7 +486,6 @@ func GetVmBridgeManager() *vmBridgeManager {
 			log.Debugf("init vmBridgeManager")
 			bridgeSingleton = &vmBridgeManager{}
 			bridgeSingleton.simContextCache = make(map[int32]*SimContext)
-			//bridgeSingleton.wasmImports = bridgeSingleton.GetImports()
 		}
 	}
 	return bridgeSingleton
@@ -366,50 +511,3 @@ func (b *vmBridgeManager) remove(k int32) {
 	defer b.pointerLock.Unlock()
 	delete(b.simContextCache, k)
 }
-
-// NewWasmInstance new wasm instance. Apply for new memory.
-func (b *vmBridgeManager) NewWasmInstance(byteCode []byte) (wasmer.Instance, error) {
-	return wasmer.NewInstanceWithImports(byteCode, b.GetImports())
-}
-
-// GetImports return export interface to cgo
-func (b *vmBridgeManager) GetImports() *wasmer.Imports {
-	var err error
-	imports := wasmer.NewImports().Namespace("env")
-	if _, err = imports.Append("sys_call", sysCall, C.sysCall); err != nil {
-		panic("add 'sys_call' into Imports error")
-	}
-	// parameter explain:
-	// 	1、["log_message"]: rust extern "C" method name
-	//	2、[logMessage] go method ptr
-	//	3、[C.logMessage] cgo function pointer.
-	if _, err = imports.Append("log_message", logMessage, C.logMessage); err != nil {
-		panic("add 'log_message' into Imports error")
-	}
-	// for wacsi empty interface
-	imports.Namespace("wasi_unstable")
-
-	if _, err = imports.Append("fd_write", fdWrite, C.fdWrite); err != nil {
-		panic("add 'fd_write' into Imports error")
-	}
-	if _, err = imports.Append("fd_read", fdRead, C.fdRead); err != nil {
-		panic("add 'fd_read' into Imports error")
-	}
-	if _, err = imports.Append("fd_close", fdClose, C.fdClose); err != nil {
-		panic("add 'fd_close' into Imports error")
-	}
-	if _, err = imports.Append("fd_seek", fdSeek, C.fdSeek); err != nil {
-		panic("add 'fd_seek' into Imports error")
-	}
-
-	imports.Namespace("wasi_snapshot_preview1")
-	if _, err = imports.Append("proc_exit", procExit, C.procExit); err != nil {
-		panic("add 'proc_exit' into Imports error")
-	}
-	//imports.Append("fd_write", fdWrite2, C.fdWrite2)
-	//imports.Append("environ_sizes_get", fdWrite, C.fdWrite)
-	//imports.Append("proc_exit", fdWrite, C.fdWrite)
-	//imports.Append("environ_get", fdWrite, C.fdWrite)
-
-	return imports
-}
@@ -8,6 +8,10 @@ SPDX-License-Identifier: Apache-2.0
 package wasmer
 
 import (
+	"fmt"
+	"strings"
+
+	"chainmaker.org/chainmaker/common/v2/serialize"
 	"chainmaker.org/chainmaker/protocol/v2"
 )
 
@@ -22,8 +26,15 @@ func (s *WaciInstance) GetState() int32 {
 }
 
 func (s *WaciInstance) getStateCore(isLen bool) int32 {
-	data, err := wacsi.GetState(s.RequestBody, s.Sc.Contract.Name, s.Sc.TxSimContext, s.Memory, s.Sc.GetStateCache, isLen)
-	s.Sc.GetStateCache = data // reset _data
+	data, err := s.pendingResult(isLen, protocol.ContractMethodGetState)
+	if err != nil {
+		s.recordMsg(err.Error())
+		return protocol.ContractSdkSignalResultFail
+	}
+	data, err = wacsi.GetState(s.RequestBody, s.Sc.Contract.Name, s.Sc.TxSimContext, s.memory.Data(), data, isLen)
+	if err == nil {
+		err = s.saveResult(isLen, protocol.ContractMethodGetState, data)
+	}
 	if err != nil {
 		s.recordMsg(err.Error())
 		return protocol.ContractSdkSignalResultFail
@@ -33,7 +44,10 @@ func (s *WaciInstance) getStateCore(isLen bool) int32 {
 
 // PutState put state to chain
 func (s *WaciInstance) PutState() int32 {
-	err := wacsi.PutState(s.RequestBody, s.Sc.Contract.Name, s.Sc.TxSimContext)
+	err := s.checkStateKey()
+	if err == nil {
+		err = wacsi.PutState(s.RequestBody, s.Sc.Contract.Name, s.Sc.TxSimContext)
+	}
 	if err != nil {
 		s.recordMsg(err.Error())
 		return protocol.ContractSdkSignalResultFail
@@ -43,7 +57,10 @@ func (s *WaciInstance) PutState() int32 {
 
 // DeleteState delete state from chain
 func (s *WaciInstance) DeleteState() int32 {
-	err := wacsi.DeleteState(s.RequestBody, s.Sc.Contract.Name, s.Sc.TxSimContext)
+	err := s.checkStateKey()
+	if err == nil {
+		err = wacsi.DeleteState(s.RequestBody, s.Sc.Contract.Name, s.Sc.TxSimContext)
+	}
 	if err != nil {
 		s.recordMsg(err.Error())
 		return protocol.ContractSdkSignalResultFail
@@ -53,7 +70,7 @@ func (s *WaciInstance) DeleteState() int32 {
 
 // KvIterator Select kv statement
 func (s *WaciInstance) KvIterator() int32 {
-	err := wacsi.KvIterator(s.RequestBody, s.Sc.Contract.Name, s.Sc.TxSimContext, s.Memory)
+	err := wacsi.KvIterator(s.RequestBody, s.Sc.Contract.Name, s.Sc.TxSimContext, s.memory.Data())
 	if err != nil {
 		s.recordMsg(err.Error())
 		return protocol.ContractSdkSignalResultFail
@@ -61,7 +78,7 @@ func (s *WaciInstance) KvIterator() int32 {
 	return protocol.ContractSdkSignalResultSuccess
 }
 func (s *WaciInstance) KvPreIterator() int32 {
-	err := wacsi.KvPreIterator(s.RequestBody, s.Sc.Contract.Name, s.Sc.TxSimContext, s.Memory)
+	err := wacsi.KvPreIterator(s.RequestBody, s.Sc.Contract.Name, s.Sc.TxSimContext, s.memory.Data())
 	if err != nil {
 		s.recordMsg(err.Error())
 		return protocol.ContractSdkSignalResultFail
@@ -71,7 +88,7 @@ func (s *WaciInstance) KvPreIterator() int32 {
 
 //KvIteratorHasNext to determine whether db has next statement
 func (s *WaciInstance) KvIteratorHasNext() int32 {
-	err := wacsi.KvIteratorHasNext(s.RequestBody, s.Sc.TxSimContext, s.Memory)
+	err := wacsi.KvIteratorHasNext(s.RequestBody, s.Sc.TxSimContext, s.memory.Data())
 	if err != nil {
 		s.recordMsg(err.Error())
 		return protocol.ContractSdkSignalResultFail
@@ -89,9 +106,16 @@ func (s *WaciInstance) KvIteratorNext() int32 {
 }
 
 func (s *WaciInstance) kvIteratorNextCore(isLen bool) int32 {
-	data, err := wacsi.KvIteratorNext(s.RequestBody, s.Sc.TxSimContext,
-		s.Memory, s.Sc.GetStateCache, s.Sc.Contract.Name, isLen)
-	s.Sc.GetStateCache = data // reset _data
+	data, err := s.pendingResult(isLen, protocol.ContractMethodKvIteratorNext)
+	if err != nil {
+		s.recordMsg(err.Error())
+		return protocol.ContractSdkSignalResultFail
+	}
+	data, err = wacsi.KvIteratorNext(s.RequestBody, s.Sc.TxSimContext,
+		s.memory.Data(), data, s.Sc.Contract.Name, isLen)
+	if err == nil {
+		err = s.saveResult(isLen, protocol.ContractMethodKvIteratorNext, data)
+	}
 	if err != nil {
 		s.recordMsg(err.Error())
 		return protocol.ContractSdkSignalResultFail
@@ -101,10 +125,19 @@ func (s *WaciInstance) kvIteratorNextCore(isLen bool) int32 {
 
 // KvIteratorClose Close kv statement
 func (s *WaciInstance) KvIteratorClose() int32 {
-	err := wacsi.KvIteratorClose(s.RequestBody, s.Sc.Contract.Name, s.Sc.TxSimContext, s.Memory)
+	err := wacsi.KvIteratorClose(s.RequestBody, s.Sc.Contract.Name, s.Sc.TxSimContext, s.memory.Data())
 	if err != nil {
 		s.recordMsg(err.Error())
 		return protocol.ContractSdkSignalResultFail
 	}
 	return protocol.ContractSdkSignalResultSuccess
 }
+
+// checkStateKey reject contract writes to the state keys reserved by the runtime
+func (s *WaciInstance) checkStateKey() error {
+	key, _ := serialize.NewEasyCodecWithBytes(s.RequestBody).GetString("key")
+	if strings.HasPrefix(key, reservedStateKeyPrefix) {
+		return fmt.Errorf("state key [%s] is reserved by the runtime", key)
+	}
+	return nil
+}
@@ -16,7 +16,7 @@ import (
 
 // ExecuteQuery execute query sql, return result set index
 func (s *WaciInstance) ExecuteQuery() int32 {
-	err := wacsi.ExecuteQuery(s.RequestBody, s.Sc.Contract.Name, s.Sc.TxSimContext, s.Memory, s.ChainId)
+	err := wacsi.ExecuteQuery(s.RequestBody, s.Sc.Contract.Name, s.Sc.TxSimContext, s.memory.Data(), s.ChainId)
 	if err != nil {
 		s.recordMsg(err.Error())
 		return protocol.ContractSdkSignalResultFail
@@ -35,9 +35,16 @@ func (s *WaciInstance) ExecuteQueryOne() int32 {
 }
 
 func (s *WaciInstance) executeQueryOneCore(isLen bool) int32 {
-	data, err := wacsi.ExecuteQueryOne(s.RequestBody, s.Sc.Contract.Name,
-		s.Sc.TxSimContext, s.Memory, s.Sc.GetStateCache, s.ChainId, isLen)
-	s.Sc.GetStateCache = data // reset _data
+	data, err := s.pendingResult(isLen, protocol.ContractMethodExecuteQueryOne)
+	if err != nil {
+		s.recordMsg(err.Error())
+		return protocol.ContractSdkSignalResultFail
+	}
+	data, err = wacsi.ExecuteQueryOne(s.RequestBody, s.Sc.Contract.Name,
+		s.Sc.TxSimContext, s.memory.Data(), data, s.ChainId, isLen)
+	if err == nil {
+		err = s.saveResult(isLen, protocol.ContractMethodExecuteQueryOne, data)
+	}
 	if err != nil {
 		s.recordMsg(err.Error())
 		return protocol.ContractSdkSignalResultFail
@@ -47,7 +54,7 @@ func (s *WaciInstance) executeQueryOneCore(isLen bool) int32 {
 
 // RSHasNext return is there a next line, 1 is has next row, 0 is no next row
 func (s *WaciInstance) RSHasNext() int32 {
-	err := wacsi.RSHasNext(s.RequestBody, s.Sc.TxSimContext, s.Memory)
+	err := wacsi.RSHasNext(s.RequestBody, s.Sc.TxSimContext, s.memory.Data())
 	if err != nil {
 		s.recordMsg(err.Error())
 		return protocol.ContractSdkSignalResultFail
@@ -66,8 +73,15 @@ func (s *WaciInstance) RSNext() int32 {
 }
 
 func (s *WaciInstance) rsNextCore(isLen bool) int32 {
-	data, err := wacsi.RSNext(s.RequestBody, s.Sc.TxSimContext, s.Memory, s.Sc.GetStateCache, isLen)
-	s.Sc.GetStateCache = data // reset _data
+	data, err := s.pendingResult(isLen, protocol.ContractMethodRSNext)
+	if err != nil {
+		s.recordMsg(err.Error())
+		return protocol.ContractSdkSignalResultFail
+	}
+	data, err = wacsi.RSNext(s.RequestBody, s.Sc.TxSimContext, s.memory.Data(), data, isLen)
+	if err == nil {
+		err = s.saveResult(isLen, protocol.ContractMethodRSNext, data)
+	}
 	if err != nil {
 		s.recordMsg(err.Error())
 		return protocol.ContractSdkSignalResultFail
@@ -77,7 +91,7 @@ func (s *WaciInstance) rsNextCore(isLen bool) int32 {
 
 // RSClose close sql statement
 func (s *WaciInstance) RSClose() int32 {
-	err := wacsi.RSClose(s.RequestBody, s.Sc.TxSimContext, s.Memory)
+	err := wacsi.RSClose(s.RequestBody, s.Sc.TxSimContext, s.memory.Data())
 	if err != nil {
 		s.recordMsg(err.Error())
 		return protocol.ContractSdkSignalResultFail
@@ -88,7 +102,11 @@ func (s *WaciInstance) RSClose() int32 {
 // ExecuteUpdate execute update and insert sql, allow single row change
 // as: update table set name = 'Tom' where uniqueKey='xxx'
 func (s *WaciInstance) ExecuteUpdate() int32 {
-	err := wacsi.ExecuteUpdate(s.RequestBody, s.Sc.Contract.Name, s.Sc.method, s.Sc.TxSimContext, s.Memory, s.ChainId)
+	// save point to roll back the update if the cross contract call fails
+	err := getCallStack(s.Sc.TxSimContext).beginSqlSavePoints()
+	if err == nil {
+		err = wacsi.ExecuteUpdate(s.RequestBody, s.Sc.Contract.Name, s.Sc.method, s.Sc.TxSimContext, s.memory.Data(), s.ChainId)
+	}
 	if err != nil {
 		s.recordMsg(err.Error())
 		return protocol.ContractSdkSignalResultFail
@@ -106,7 +124,7 @@ func (s *WaciInstance) ExecuteUpdate() int32 {
 //
 // You must have a primary key to create a table
 func (s *WaciInstance) ExecuteDDL() int32 {
-	err := wacsi.ExecuteDDL(s.RequestBody, s.Sc.Contract.Name, s.Sc.TxSimContext, s.Memory, s.Sc.method)
+	err := wacsi.ExecuteDDL(s.RequestBody, s.Sc.Contract.Name, s.Sc.TxSimContext, s.memory.Data(), s.Sc.method)
 	if err != nil {
 		s.recordMsg(err.Error())
 		return protocol.ContractSdkSignalResultFail
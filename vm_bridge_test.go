@@ -0,0 +1,168 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"chainmaker.org/chainmaker/common/v2/serialize"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/vm/v2"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go/wasmertypes"
+)
+
+// growingMemory a guest memory moved by every growth, the bytes of the previous location are poisoned
+type growingMemory struct {
+	data []byte
+}
+
+func (m *growingMemory) Data() []byte {
+	return m.data
+}
+
+// grow move the memory to a larger location, as a syscall re-entering the vm may do
+func (m *growingMemory) grow(size int) {
+	data := make([]byte, len(m.data)+size)
+	copy(data, m.data)
+	for i := range m.data {
+		m.data[i] = 0xee
+	}
+	m.data = data
+}
+
+func TestWriteValueAfterMemoryGrowth(t *testing.T) {
+	memory := &growingMemory{data: make([]byte, 64)}
+	s := &WaciInstance{memory: wasmertypes.NewMemoryView(memory)}
+	stale := memory.Data()
+
+	memory.grow(64)
+	if err := s.writeValueAt(80, false, []byte("value")); err != nil {
+		t.Fatalf("write beyond the memory length before growth: %v", err)
+	}
+	if got := string(memory.data[80:85]); got != "value" {
+		t.Fatalf("expected the value in the grown memory, got %q", got)
+	}
+
+	if err := s.writeValueAt(8, true, []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if got := binary.LittleEndian.Uint32(memory.data[8:]); got != 5 {
+		t.Fatalf("expected the value length 5 in the grown memory, got %d", got)
+	}
+	for i, b := range stale {
+		if b != 0xee {
+			t.Fatalf("stale memory written at %d", i)
+		}
+	}
+}
+
+func TestReadAfterMemoryGrowth(t *testing.T) {
+	memory := &growingMemory{data: make([]byte, 64)}
+	s := &WaciInstance{memory: wasmertypes.NewMemoryView(memory)}
+
+	copy(memory.data[16:], "request")
+	memory.grow(64)
+	copy(memory.data[100:], "grown")
+
+	if got := string(s.memory.Data()[16:23]); got != "request" {
+		t.Fatalf("expected the bytes moved with the memory, got %q", got)
+	}
+	if got, err := s.memory.ReadBytes(100, 5); err != nil || string(got) != "grown" {
+		t.Fatalf("expected the bytes written after growth, got %q, %v", got, err)
+	}
+}
+
+func TestWriteValueOutOfMemory(t *testing.T) {
+	memory := &growingMemory{data: make([]byte, 64)}
+	s := &WaciInstance{memory: wasmertypes.NewMemoryView(memory)}
+
+	for _, ptr := range []int32{-1, 62, 64} {
+		if err := s.writeValueAt(ptr, true, nil); err == nil {
+			t.Errorf("expected value_ptr %d out of memory range", ptr)
+		}
+	}
+	if err := s.writeValueAt(60, false, []byte("value")); err == nil {
+		t.Error("expected the value overflowing the memory to be rejected")
+	}
+	for i, b := range memory.data {
+		if b != 0 {
+			t.Fatalf("memory written at %d by a rejected write", i)
+		}
+	}
+}
+
+// reenteringWacsi Wacsi whose cross contract calls re-enter the vm of the caller and grow its memory
+type reenteringWacsi struct {
+	vm.Wacsi
+	memory *growingMemory
+	result []byte
+	// the events emitted by the callee
+	events []*commonPb.ContractEvent
+}
+
+func (w *reenteringWacsi) CallContract(requestBody []byte, txSimContext protocol.TxSimContext, memory []byte,
+	data []byte, gasUsed uint64, isLen bool) (*commonPb.ContractResult, uint64, protocol.ExecOrderTxType, error) {
+	valuePtr, err := serialize.NewEasyCodecWithBytes(requestBody).GetInt32("value_ptr")
+	if err != nil {
+		return nil, gasUsed, protocol.ExecOrderTxTypeNormal, err
+	}
+	if !isLen {
+		copy(memory[valuePtr:], data)
+		return nil, gasUsed, protocol.ExecOrderTxTypeNormal, nil
+	}
+	// the length is written once the callee returned, as chainmaker's wacsi does
+	w.memory.grow(64)
+	binary.LittleEndian.PutUint32(memory[valuePtr:], uint32(len(w.result)))
+	return &commonPb.ContractResult{Result: w.result, ContractEvent: w.events}, gasUsed + 10,
+		protocol.ExecOrderTxTypeNormal, nil
+}
+
+func TestCallContractGrowingMemory(t *testing.T) {
+	memory := &growingMemory{data: make([]byte, 64)}
+	defer func(original vm.Wacsi) { wacsi = original }(wacsi)
+	wacsi = &reenteringWacsi{memory: memory, result: []byte("result")}
+
+	sc := NewSimContext("invoke", log, "chain1")
+	defer sc.removeCtxPointer()
+	sc.TxSimContext = newKvTxContext()
+	sc.Contract = &commonPb.Contract{Name: "caller"}
+	sc.ContractResult = &commonPb.ContractResult{}
+	sc.Instance = &fakeInstance{}
+	stack := getCallStack(sc.TxSimContext)
+	stack.push(&callFrame{ContractName: "caller"})
+	defer stack.pop()
+
+	request := serialize.NewEasyCodec()
+	request.AddString("contract_name", "callee")
+	request.AddString("method", "get")
+	request.AddInt32("value_ptr", 8)
+	request.AddInt32(resultHandlePtrKey, 16)
+	s := &WaciInstance{Sc: sc, RequestBody: request.Marshal(), memory: wasmertypes.NewMemoryView(memory)}
+
+	if s.CallContractLen() != protocol.ContractSdkSignalResultSuccess {
+		t.Fatalf("CallContractLen failed, %s", sc.ContractResult.Message)
+	}
+	if length := binary.LittleEndian.Uint32(memory.data[8:]); length != 6 {
+		t.Fatalf("expected the result length in the grown memory, got %d", length)
+	}
+	if gas := sc.Instance.GetGasUsed(); gas != 10 {
+		t.Errorf("expected the gas of the call, got %d", gas)
+	}
+
+	memory.grow(64)
+	request.AddInt32(resultHandleKey, int32(binary.LittleEndian.Uint32(memory.data[16:])))
+	s.RequestBody = request.Marshal()
+	if s.CallContract() != protocol.ContractSdkSignalResultSuccess {
+		t.Fatalf("CallContract failed, %s", sc.ContractResult.Message)
+	}
+	if got := string(memory.data[8:14]); got != "result" {
+		t.Errorf("expected the result in the grown memory, got %q", got)
+	}
+}
@@ -0,0 +1,98 @@
+// +build cgo
+
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"strconv"
+	"sync"
+
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go"
+)
+
+// sharedImports the imports shared by all instances, rebuilt when a host function is registered
+var sharedImports struct {
+	lock       sync.Mutex
+	imports    *wasmer.Imports
+	generation uint64
+}
+
+// logMessage print log to file
+func logMessage(instanceContext *wasmer.InstanceContext, pointer int32, length int32) {
+	text, err := instanceContext.Memory().View().ReadBytes(uint32(pointer), uint32(length))
+	if err != nil {
+		log.Errorf("wasmer log>> log_message failed, %s", err.Error())
+		return
+	}
+	gotText := string(text)
+	if ctxPtr, ok := instanceContext.Data().(int32); ok {
+		if simContext := GetVmBridgeManager().get(ctxPtr); simContext != nil {
+			simContext.contractLog(LogLevelDebug, gotText)
+			return
+		}
+	}
+	log.Debugf("wasmer log>> " + gotText)
+}
+
+// sysCall wasmer vm call chain entry
+func sysCall(instanceContext *wasmer.InstanceContext,
+	requestHeaderPtr int32, requestHeaderLen int32,
+	requestBodyPtr int32, requestBodyLen int32) int32 {
+	return handleSysCall(instanceContext.Memory().View(),
+		requestHeaderPtr, requestHeaderLen, requestBodyPtr, requestBodyLen)
+}
+
+// wasi
+func fdWrite(context *wasmer.InstanceContext, fd int32, iovsPtr int32, iovsLen int32, nwrittenPtr int32) (err int32) {
+	return protocol.ContractSdkSignalResultSuccess
+}
+
+func fdRead(context *wasmer.InstanceContext, fd int32, iovsPtr int32, iovsLen int32, nwrittenPtr int32) (err int32) {
+	return protocol.ContractSdkSignalResultSuccess
+}
+
+func fdClose(context *wasmer.InstanceContext, fd int32, iovsPtr int32, iovsLen int32, nwrittenPtr int32) (err int32) {
+	return protocol.ContractSdkSignalResultSuccess
+}
+
+func fdSeek(context *wasmer.InstanceContext, fd int32, iovsPtr int32, iovsLen int32, nwrittenPtr int32) (err int32) {
+	return protocol.ContractSdkSignalResultSuccess
+}
+
+func procExit(context *wasmer.InstanceContext, exitCode int32) {
+	panic("exit called by contract, code:" + strconv.Itoa(int(exitCode)))
+}
+
+// NewWasmInstance new wasm instance. Apply for new memory.
+func (b *vmBridgeManager) NewWasmInstance(byteCode []byte) (wasmer.Instance, error) {
+	return wasmer.NewInstanceWithImports(byteCode, b.GetImports())
+}
+
+// GetImports return the host functions imported by the contracts, built once and shared by all instances.
+// every instance holds a reference to the imports, released when the instance is closed
+func (b *vmBridgeManager) GetImports() *wasmer.Imports {
+	sharedImports.lock.Lock()
+	defer sharedImports.lock.Unlock()
+
+	generation := hostFunctions.Generation()
+	if sharedImports.imports == nil || sharedImports.generation != generation {
+		imports, err := hostFunctions.Imports()
+		if err != nil {
+			panic("add host functions into Imports error, " + err.Error())
+		}
+		if sharedImports.imports != nil {
+			// the instances of the previous imports keep them until they are closed
+			sharedImports.imports.Close()
+		}
+		sharedImports.imports = imports.Share()
+		sharedImports.generation = generation
+	}
+	return sharedImports.imports
+}
@@ -0,0 +1,78 @@
+// +build cgo
+
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmer
+
+import (
+	"testing"
+
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go"
+)
+
+// importingModule a module importing the chainmaker host functions:
+//
+//	(module
+//	  (import "env" "sys_call" (func (param i32 i32 i32 i32) (result i32)))
+//	  (import "env" "log_message" (func (param i32 i32))))
+var importingModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// type section
+	0x01, 0x0e, 0x02,
+	0x60, 0x04, 0x7f, 0x7f, 0x7f, 0x7f, 0x01, 0x7f,
+	0x60, 0x02, 0x7f, 0x7f, 0x00,
+	// import section
+	0x02, 0x22, 0x02,
+	0x03, 'e', 'n', 'v', 0x08, 's', 'y', 's', '_', 'c', 'a', 'l', 'l', 0x00, 0x00,
+	0x03, 'e', 'n', 'v', 0x0b, 'l', 'o', 'g', '_', 'm', 'e', 's', 's', 'a', 'g', 'e', 0x00, 0x01,
+}
+
+func compileImportingModule(b *testing.B) wasmer.Module {
+	module, err := wasmer.Compile(importingModule)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return module
+}
+
+// BenchmarkInstantiateWithFreshImports the imports built for every instance, as before they were shared
+func BenchmarkInstantiateWithFreshImports(b *testing.B) {
+	module := compileImportingModule(b)
+	defer module.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		imports, err := hostFunctions.Imports()
+		if err != nil {
+			b.Fatal(err)
+		}
+		instance, err := module.InstantiateWithImports(imports)
+		if err != nil {
+			b.Fatal(err)
+		}
+		instance.Close()
+	}
+}
+
+// BenchmarkInstantiateWithSharedImports the imports of the bridge, built once and shared by the instances
+func BenchmarkInstantiateWithSharedImports(b *testing.B) {
+	module := compileImportingModule(b)
+	defer module.Close()
+	bridge := GetVmBridgeManager()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		instance, err := module.InstantiateWithImports(bridge.GetImports())
+		if err != nil {
+			b.Fatal(err)
+		}
+		instance.Close()
+	}
+}
@@ -8,6 +8,7 @@ SPDX-License-Identifier: Apache-2.0
 package wasmer
 
 import (
+	"bytes"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -18,7 +19,6 @@ import (
 	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/protocol/v2"
 	"chainmaker.org/chainmaker/utils/v2"
-	wasmergo "github.com/Ning-Qing/vm-wasmer/v2/wasmer-go"
 )
 
 const (
@@ -42,12 +42,18 @@ const (
 type InstancesManager struct {
 	// chain identifier
 	chainId string
-	// control map operations
-	m sync.Mutex
+	// control map and admission pipeline operations
+	m sync.RWMutex
 	// contractName_contractVersion -> vm pool
 	instanceMap map[string]*vmPool
 	// module log
 	log *logger.CMLogger
+	// runtime limits of the chain
+	config *RuntimeConfig
+	// checks of the byte code of installed and upgraded contracts
+	admission *AdmissionPipeline
+	// the loaded wasmer library is not the version of the wasmer-go binding, no contract is run
+	libraryErr error
 }
 
 // vmPool, each contract has a vm pool providing multiple vm instances to call
@@ -56,9 +62,11 @@ type vmPool struct {
 	// the corresponding contract info
 	contractId *commonPb.Contract
 	byteCode   []byte
-	// byteCode wasmergo module
-	module *wasmergo.Module
-	// wasmergo instance pool
+	// the wasm engine running the contract
+	engine Engine
+	// byteCode compiled by the engine
+	module ModuleHandle
+	// instance pool
 	instances chan *wrappedInstance
 	// current instance size in pool
 	currentSize int32
@@ -76,36 +84,82 @@ type vmPool struct {
 	removeInstanceC chan struct{}
 	addInstanceC    chan struct{}
 	log             *logger.CMLogger
+	// log rate limit of the contract
+	logLimiter *logRateLimiter
+	// debug info symbolizing the traps of the contract, nil if the byte code can not be parsed
+	symbols *symbols
+	// sys_call behaviour of the abi version of the contract sdk
+	abi *abiBehaviour
+
+	// guard the instances in use and the close of the pool
+	usersLock sync.Mutex
+	// the instances taken out of the pool and not reverted yet
+	inUse int32
+	// the pool is no longer in the manager, it is closed once its last instance is reverted
+	retired bool
+	closed  bool
 }
 
 // wrappedInstance wraps instance with id and other info
 type wrappedInstance struct {
 	// id
 	id string
-	// wasmergo instance provided by wasmer
-	wasmInstance *wasmergo.Instance
+	// instance provided by the engine
+	wasmInstance InstanceHandle
 	// lastUseTime, unix timestamp in ms
 	lastUseTime int64
 	// createTime, unix timestamp in ms
 	createTime int64
 	// errCount, current instance invoke method error count
 	errCount int32
+	// created for a closed pool, closed once reverted
+	detached bool
 }
 
 // NewInstancesManager return InstancesManager for every chain
 func NewInstancesManager(chainId string) *InstancesManager {
+	return NewInstancesManagerWithConfig(chainId, DefaultRuntimeConfig())
+}
+
+// NewInstancesManagerWithConfig return InstancesManager for every chain, with the runtime limits of the chain
+func NewInstancesManagerWithConfig(chainId string, config *RuntimeConfig) *InstancesManager {
 	vmPoolManager := &InstancesManager{
 		instanceMap: make(map[string]*vmPool),
 		log:         logger.GetLoggerByChain(logger.MODULE_VM, chainId),
 		chainId:     chainId,
+		config:      config,
+		admission:   NewAdmissionPipeline(),
+	}
+	if config.Admission != nil {
+		vmPoolManager.admission.Use(config.Admission.Checks()...)
+	}
+	if config.engine() == defaultEngine {
+		vmPoolManager.libraryErr = checkLibrary(vmPoolManager.log)
 	}
 	return vmPoolManager
 }
 
+// AddAdmissionCheck append checks run on the byte code of installed and upgraded contracts
+func (m *InstancesManager) AddAdmissionCheck(checks ...AdmissionCheck) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	m.admission.Use(checks...)
+}
+
+// CheckByteCode run the admission checks on the byte code, return the report of every violation
+func (m *InstancesManager) CheckByteCode(byteCode []byte) *AdmissionReport {
+	m.m.RLock()
+	defer m.m.RUnlock()
+	return m.admission.Run(byteCode)
+}
+
 // NewRuntimeInstance init vm pool and check byteCode correctness
 func (m *InstancesManager) NewRuntimeInstance(txSimContext protocol.TxSimContext, chainId, method, codePath string,
 	contract *commonPb.Contract, byteCode []byte, log protocol.Logger) (protocol.RuntimeInstance, error) {
 	var err error
+	if m.libraryErr != nil {
+		return nil, m.libraryErr
+	}
 	if contract == nil || contract.Name == "" || contract.Version == "" {
 		err = fmt.Errorf("contract id is nil")
 		m.log.Warn(err)
@@ -118,51 +172,92 @@ func (m *InstancesManager) NewRuntimeInstance(txSimContext protocol.TxSimContext
 		return nil, err
 	}
 
-	pool, err := m.getVmPool(contract, byteCode)
-	if err != nil || pool == nil {
+	// installed contracts are not checked again, a stricter policy does not break them
+	admit := method == protocol.ContractInitMethod || method == protocol.ContractUpgradeMethod
+	pool, err := m.getVmPool(contract, byteCode, admit)
+	if _, ok := err.(*ContractError); ok {
 		return nil, err
 	}
+	if err != nil {
+		return nil, newContractError(ErrorCodeBytecodeInvalid, "[%s_%s], %s", contract.Name, contract.Version, err)
+	}
+	if pool == nil {
+		return nil, nil
+	}
 
 	runtime := &RuntimeInstance{
 		pool:    pool,
 		log:     m.log,
 		chainId: m.chainId,
+		config:  m.config,
 	}
 
 	return runtime, nil
 }
 
-func (m *InstancesManager) getVmPool(contractId *commonPb.Contract, byteCode []byte) (*vmPool, error) {
-	var err error
+func (m *InstancesManager) getVmPool(contractId *commonPb.Contract, byteCode []byte, admit bool) (*vmPool, error) {
 	key := contractId.Name + "_" + contractId.Version
 
+	// every install and upgrade is checked, a pool left by a failed install does not skip the checks
+	if admit {
+		report := m.CheckByteCode(byteCode)
+		for _, warning := range report.Warnings {
+			m.log.Warnf("[%s] admission warning, %s", key, warning)
+		}
+		if err := report.Err(); err != nil {
+			m.log.Warnf("[%s] %s", key, err.Error())
+			return nil, err
+		}
+	}
+
+	m.m.RLock()
 	pool, ok := m.instanceMap[key]
-	if !ok {
-		m.m.Lock()
-		defer m.m.Unlock()
-
-		pool, ok = m.instanceMap[key]
-		if !ok {
-			start := utils.CurrentTimeMillisSeconds()
-			m.log.Infof("[%s] init vm pool start", key)
-
-			pool, err = newVmPool(contractId, byteCode, m.log)
-			if err != nil {
-				return nil, err
-			}
+	m.m.RUnlock()
+	if ok && (!admit || bytes.Equal(pool.byteCode, byteCode)) {
+		return pool, nil
+	}
+	m.m.Lock()
+	defer m.m.Unlock()
 
-			pool.grow(defaultMinSize)
-			m.instanceMap[key] = pool
-			end := utils.CurrentTimeMillisSeconds()
-			m.log.Infof("[%s] init vmPool done, currentSize=%d, spend %dms", key, pool.currentSize, end-start)
-		}
+	pool, ok = m.instanceMap[key]
+	if ok && (!admit || bytes.Equal(pool.byteCode, byteCode)) {
+		return pool, nil
+	}
+	if ok {
+		// the pool of a failed install of another byte code with the same name and version
+		// its instances may still run transactions, the pool is closed once they are reverted
+		m.log.Infof("[%s] byte code changed, retire the vm pool of the previous byte code", key)
+		delete(m.instanceMap, key)
+		pool.retire()
+	}
+
+	start := utils.CurrentTimeMillisSeconds()
+	m.log.Infof("[%s] init vm pool start", key)
+	pool, err := newVmPool(m.config.engine(), contractId, byteCode, m.log)
+	if err != nil {
+		return nil, err
 	}
-	return pool, err
+
+	pool.logLimiter = newLogRateLimiter(m.config.MaxLogLinesPerSecond)
+	pool.grow(defaultMinSize)
+	m.instanceMap[key] = pool
+	end := utils.CurrentTimeMillisSeconds()
+	m.log.Infof("[%s] init vmPool done, currentSize=%d, spend %dms", key, pool.currentSize, end-start)
+	return pool, nil
 }
 
 // GetInstance get a vm instance to run contract
 // should be followed by defer resetInstance
 func (p *vmPool) GetInstance() *wrappedInstance {
+	if !p.acquire() {
+		// the pool was closed after the runtime got it
+		instance, err := p.newInstanceFromModule()
+		if err != nil {
+			panic(err)
+		}
+		instance.detached = true
+		return instance
+	}
 	atomic.AddInt32(&p.useCount, 1)
 
 	// get instance from vm pool
@@ -196,6 +291,25 @@ func (p *vmPool) NewInstance() (*wrappedInstance, error) {
 	return p.newInstanceFromModule()
 }
 
+// BorrowInstance get a vm instance for a cross contract call without waiting: the instances running the outer
+// frames of the call stack are checked out of the pool, waiting for them may dead lock. the idle instances of the
+// pool never run a frame, a reentrant call gets one of them or a fresh instance.
+// if pooled, the instance should be followed by defer RevertInstance, otherwise by defer CloseInstance
+func (p *vmPool) BorrowInstance() (instance *wrappedInstance, pooled bool, err error) {
+	if p.acquire() {
+		select {
+		case instance = <-p.instances:
+			atomic.AddInt32(&p.useCount, 1)
+			instance.lastUseTime = utils.CurrentTimeMillisSeconds()
+			return instance, true, nil
+		default:
+			p.release()
+		}
+	}
+	instance, err = p.NewInstance()
+	return instance, false, err
+}
+
 // CloseInstance close a wasmer instance directly, for cross contract call
 func (p *vmPool) CloseInstance(instance *wrappedInstance) {
 	if instance != nil {
@@ -209,31 +323,70 @@ func (p *vmPool) CloseInstance(instance *wrappedInstance) {
 
 // RevertInstance revert instance to pool
 func (p *vmPool) RevertInstance(instance *wrappedInstance) {
+	if instance.detached {
+		p.CloseInstance(instance)
+		return
+	}
 	if p.shouldDiscard(instance) {
 		go func() {
+			// still in use until replaced, the refreshing loop runs until the pool is closed
+			defer p.release()
 			p.removeInstanceC <- struct{}{}
 			p.addInstanceC <- struct{}{}
 			p.CloseInstance(instance)
 		}()
 	} else {
 		p.instances <- instance
+		p.release()
+	}
+}
+
+// acquire count an instance taken out of the pool, false if the pool is closed
+func (p *vmPool) acquire() bool {
+	p.usersLock.Lock()
+	defer p.usersLock.Unlock()
+	if p.closed {
+		return false
 	}
+	p.inUse++
+	return true
 }
 
-func newVmPool(contractId *commonPb.Contract, byteCode []byte, log *logger.CMLogger) (*vmPool, error) {
-	if ok := wasmergo.Validate(byteCode); !ok {
-		return nil, fmt.Errorf("[%s_%s], byte code validation failed", contractId.Name, contractId.Version)
+// release count an instance reverted to the pool, a retired pool is closed with its last instance
+func (p *vmPool) release() {
+	p.usersLock.Lock()
+	defer p.usersLock.Unlock()
+	p.inUse--
+	if p.retired && p.inUse == 0 {
+		p.closeLocked()
 	}
+}
+
+// retire close the pool once none of its instances is in use
+func (p *vmPool) retire() {
+	p.usersLock.Lock()
+	defer p.usersLock.Unlock()
+	p.retired = true
+	if p.inUse == 0 {
+		p.closeLocked()
+	}
+}
 
-	module, err := wasmergo.Compile(byteCode)
+func newVmPool(engine Engine, contractId *commonPb.Contract, byteCode []byte, log *logger.CMLogger) (*vmPool, error) {
+	if err := engine.Validate(byteCode); err != nil {
+		return nil, newBytecodeError(contractId, byteCode, "byte code validation failed", err)
+	}
+
+	module, err := engine.Compile(byteCode)
 	if err != nil {
-		return nil, fmt.Errorf("[%s_%s], byte code compile failed", contractId.Name, contractId.Version)
+		return nil, newBytecodeError(contractId, byteCode, "byte code compile failed", err)
 	}
 
 	vmPool := &vmPool{
 		contractId:      contractId,
 		byteCode:        byteCode,
-		module:          &module,
+		engine:          engine,
+		module:          module,
 		instances:       make(chan *wrappedInstance, defaultMaxSize),
 		currentSize:     0,
 		useCount:        0,
@@ -252,8 +405,21 @@ func newVmPool(contractId *commonPb.Contract, byteCode []byte, log *logger.CMLog
 		return nil, fmt.Errorf("[%s_%s], byte code compile failed, %s", contractId.Name, contractId.Version, err.Error())
 	}
 
+	version, err := readAbiVersion(instance.wasmInstance, byteCode)
 	instance.wasmInstance.Close()
-	log.Infof("vm pool verify byteCode finish.")
+	if err == nil {
+		vmPool.abi, err = selectAbi(version)
+	}
+	if err != nil {
+		contractErr := classifyError(err)
+		return nil, newContractError(contractErr.Code, "[%s_%s], %s", contractId.Name, contractId.Version, contractErr.Detail)
+	}
+	log.Infof("vm pool verify byteCode finish, abi version %d.", version)
+
+	if vmPool.symbols, err = newSymbols(byteCode); err != nil {
+		log.Warnf("[%s_%s], read debug info failed, traps are not symbolized, %s",
+			contractId.Name, contractId.Version, err.Error())
+	}
 
 	go vmPool.startRefreshingLoop()
 	log.Infof("vm pool startRefreshingLoop...")
@@ -403,27 +569,13 @@ func (p *vmPool) shouldDiscard(instance *wrappedInstance) bool {
 	return instance.errCount > defaultDiscardCount
 }
 
+// NewInstanceFromByteCode create an instance of the contract, from the module compiled once by the pool
 func (p *vmPool) NewInstanceFromByteCode() (*wrappedInstance, error) {
-	vb := GetVmBridgeManager()
-	wasmInstance, err := vb.NewWasmInstance(p.byteCode)
-	if err != nil {
-		p.log.Errorf("newInstanceFromByteCode fail: %s", err.Error())
-		return nil, err
-	}
-
-	instance := &wrappedInstance{
-		id:           uuid.GetUUID(),
-		wasmInstance: &wasmInstance,
-		lastUseTime:  utils.CurrentTimeMillisSeconds(),
-		createTime:   utils.CurrentTimeMillisSeconds(),
-		errCount:     0,
-	}
-	return instance, nil
+	return p.newInstanceFromModule()
 }
 
 func (p *vmPool) newInstanceFromModule() (*wrappedInstance, error) {
-	vb := GetVmBridgeManager()
-	wasmInstance, err := p.module.InstantiateWithImports(vb.GetImports())
+	wasmInstance, err := p.module.Instantiate()
 	if err != nil {
 		p.log.Errorf("newInstanceFromModule fail: %s", err.Error())
 		return nil, err
@@ -431,7 +583,7 @@ func (p *vmPool) newInstanceFromModule() (*wrappedInstance, error) {
 
 	instance := &wrappedInstance{
 		id:           uuid.GetUUID(),
-		wasmInstance: &wasmInstance,
+		wasmInstance: wasmInstance,
 		lastUseTime:  utils.CurrentTimeMillisSeconds(),
 		createTime:   utils.CurrentTimeMillisSeconds(),
 		errCount:     0,
@@ -457,33 +609,50 @@ func (p *vmPool) reset() {
 
 // close the pool
 func (p *vmPool) close() {
-	close(p.closeC)
+	p.usersLock.Lock()
+	defer p.usersLock.Unlock()
+	p.closeLocked()
+}
+
+// closeLocked close the pool once, the caller holds usersLock
+func (p *vmPool) closeLocked() {
+	if !p.closed {
+		p.closed = true
+		close(p.closeC)
+	}
 }
 
-// close the contract vm pool
+// close the contract vm pool, once its instances in use are reverted
 func (m *InstancesManager) CloseAVmPool(contractId *commonPb.Contract) {
+	m.m.Lock()
+	defer m.m.Unlock()
 	key := contractId.Name + "_" + contractId.Version
 	pool, ok := m.instanceMap[key]
 	if ok {
 		m.log.Infof("close pool %s", key)
-		pool.close()
+		delete(m.instanceMap, key)
+		pool.retire()
 	}
 }
 
-// close all contract vm pool
+// close all contract vm pool, once their instances in use are reverted
 func (m *InstancesManager) CloseAllVmPool() {
+	m.m.Lock()
+	defer m.m.Unlock()
 	for key, pool := range m.instanceMap {
 		m.log.Infof("close pool %s", key)
-		pool.close()
+		delete(m.instanceMap, key)
+		pool.retire()
 	}
 }
 
 // FIXME: 确认函数名是否多了字符A？@taifu
 // reset a contract vm pool install
 func (m *InstancesManager) ResetAVmPool(contractId *commonPb.Contract) {
-
 	key := contractId.Name + "_" + contractId.Version
+	m.m.RLock()
 	pool, ok := m.instanceMap[key]
+	m.m.RUnlock()
 	if ok {
 		m.log.Infof("reset pool %s", key)
 		pool.reset()
@@ -492,7 +661,13 @@ func (m *InstancesManager) ResetAVmPool(contractId *commonPb.Contract) {
 
 // reset all contract pool instance
 func (m *InstancesManager) ResetAllPool() {
+	m.m.RLock()
+	pools := make(map[string]*vmPool, len(m.instanceMap))
 	for key, pool := range m.instanceMap {
+		pools[key] = pool
+	}
+	m.m.RUnlock()
+	for key, pool := range pools {
 		m.log.Infof("reset pool %s", key)
 		pool.reset()
 	}
@@ -0,0 +1,372 @@
+// Package bridge registers Go host functions for WebAssembly
+// instances without any cgo code: the functions are dispatched by a
+// fixed set of C trampolines, keyed by their number of parameters.
+package bridge
+
+// #include "trampolines.h"
+import "C"
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go"
+)
+
+const (
+	// MaxParams is the maximum number of parameters of a host
+	// function.
+	MaxParams = C.BRIDGE_MAX_PARAMS
+
+	// SlotsPerArity is the maximum number of host functions of the
+	// same number of parameters and the same result registered at the
+	// same time, by all the registries of the process.
+	SlotsPerArity = C.BRIDGE_SLOTS
+)
+
+// Func represents a host function implemented in Go, of `i32`
+// parameters. `args` are the arguments given by the WebAssembly
+// instance, only valid during the call. The result is ignored if the
+// function has no result, and truncated to 32 bits if the result is an
+// `i32`.
+type Func func(context *wasmer.InstanceContext, args []int32) int64
+
+// WideFunc represents a host function implemented in Go, of `i32` and
+// `i64` parameters, registered with `RegisterWide`. The `i32`
+// arguments are sign-extended. `args` are only valid during the call.
+type WideFunc func(context *wasmer.InstanceContext, args []int64) int64
+
+// Signature represents the WebAssembly signature of a host function:
+// `Params` `i32` parameters, or the `ParamTypes` if any, and a
+// `Result` of type `TypeI32`, `TypeI64`, or `TypeVoid` for no result.
+type Signature struct {
+	Params int
+	Result wasmer.ValueType
+
+	// The types of the parameters, `TypeI32` or `TypeI64`. If nil,
+	// the function has `Params` `i32` parameters. The trampolines
+	// receive the parameters in the integer registers, the floats
+	// are not supported.
+	ParamTypes []wasmer.ValueType
+}
+
+// params returns the types of the parameters.
+func (signature Signature) params() []wasmer.ValueType {
+	if signature.ParamTypes != nil {
+		return signature.ParamTypes
+	}
+
+	if signature.Params < 0 {
+		return nil
+	}
+
+	var params = make([]wasmer.ValueType, signature.Params)
+
+	for nth := range params {
+		params[nth] = wasmer.TypeI32
+	}
+
+	return params
+}
+
+// String formats the signature, e.g. `(i32, i64) -> i32`.
+func (signature Signature) String() string {
+	var params = ""
+
+	for nth, param := range signature.params() {
+		if nth > 0 {
+			params += ", "
+		}
+		params += param.String()
+	}
+
+	return fmt.Sprintf("(%s) -> %s", params, signature.Result)
+}
+
+// RegistryError represents any kind of errors related to a host
+// function registration. It is returned by `Registry` functions only.
+type RegistryError struct {
+	// Error message.
+	message string
+}
+
+// NewRegistryError constructs a new `RegistryError`.
+func NewRegistryError(message string) *RegistryError {
+	return &RegistryError{message}
+}
+
+// `RegistryError` is an actual error. The `Error` function returns
+// the error message.
+func (error *RegistryError) Error() string {
+	return error.message
+}
+
+// Function represents a host function registered in a `Registry`.
+type Function struct {
+	Namespace string
+	Name      string
+	Signature Signature
+
+	// The trampoline slot of the function, of its arity and result.
+	slot int
+}
+
+// hostFunction represents the Go function of a trampoline, either
+// `narrow` or `wide`.
+type hostFunction struct {
+	narrow Func
+	wide   WideFunc
+	params []wasmer.ValueType
+}
+
+var (
+	// The host functions of the trampolines, indexed by result,
+	// arity and slot.
+	slots     [C.BRIDGE_RESULTS][MaxParams + 1][SlotsPerArity]hostFunction
+	slotsLock sync.RWMutex
+)
+
+// resultKind returns the index of the trampolines of the result.
+func resultKind(result wasmer.ValueType) int {
+	switch result {
+	case wasmer.TypeI32:
+		return C.BRIDGE_RESULT_I32
+	case wasmer.TypeI64:
+		return C.BRIDGE_RESULT_I64
+	default:
+		return C.BRIDGE_RESULT_VOID
+	}
+}
+
+// Registry represents a set of host functions, bound to the imports
+// of the WebAssembly instances with `Imports` or `AppendTo`.
+type Registry struct {
+	functions []*Function
+	lock      sync.Mutex
+
+	// Changed by every registration, see `Generation`.
+	generation uint64
+}
+
+// NewRegistry constructs a new empty `Registry`.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds the host function `namespace.name` of `i32`
+// parameters to the registry, and assigns it a trampoline. Since
+// `wasmer.Imports` indexes the imports by name, a name is registered
+// once across the namespaces.
+func (registry *Registry) Register(namespace string, name string, signature Signature, function Func) error {
+	if function == nil {
+		return NewRegistryError(fmt.Sprintf("The `%s` host function has no implementation.", name))
+	}
+
+	for nth, param := range signature.params() {
+		if param != wasmer.TypeI32 {
+			return NewRegistryError(fmt.Sprintf("Invalid type of the parameter #%d of the `%s` host function; given `%s`; only accept `i32`, register it with `RegisterWide` for `i64`.", nth+1, name, param))
+		}
+	}
+
+	return registry.register(namespace, name, signature, hostFunction{narrow: function})
+}
+
+// RegisterWide adds the host function `namespace.name` of `i32` and
+// `i64` parameters to the registry, like `Register`.
+func (registry *Registry) RegisterWide(namespace string, name string, signature Signature, function WideFunc) error {
+	if function == nil {
+		return NewRegistryError(fmt.Sprintf("The `%s` host function has no implementation.", name))
+	}
+
+	return registry.register(namespace, name, signature, hostFunction{wide: function})
+}
+
+func (registry *Registry) register(namespace string, name string, signature Signature, function hostFunction) error {
+	if signature.Params < 0 || signature.Params > MaxParams {
+		return NewRegistryError(fmt.Sprintf("The `%s` host function has %d parameters; only accept %d parameters at most.", name, signature.Params, MaxParams))
+	}
+
+	if signature.ParamTypes != nil && signature.Params != 0 && signature.Params != len(signature.ParamTypes) {
+		return NewRegistryError(fmt.Sprintf("The `%s` host function has %d parameters and %d parameter types.", name, signature.Params, len(signature.ParamTypes)))
+	}
+
+	var params = signature.params()
+
+	if len(params) > MaxParams {
+		return NewRegistryError(fmt.Sprintf("The `%s` host function has %d parameters; only accept %d parameters at most.", name, len(params), MaxParams))
+	}
+
+	for nth, param := range params {
+		switch param {
+		case wasmer.TypeI32, wasmer.TypeI64:
+		default:
+			return NewRegistryError(fmt.Sprintf("Invalid type of the parameter #%d of the `%s` host function; given `%s`; only accept `i32` and `i64`.", nth+1, name, param))
+		}
+	}
+
+	switch signature.Result {
+	case wasmer.TypeVoid, wasmer.TypeI32, wasmer.TypeI64:
+	default:
+		return NewRegistryError(fmt.Sprintf("Invalid result type for the `%s` host function; given `%s`; only accept `i32`, `i64` and no result.", name, signature.Result))
+	}
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	for _, registered := range registry.functions {
+		if registered.Name == name {
+			return NewRegistryError(fmt.Sprintf("The `%s` host function is already registered in the `%s` namespace.", name, registered.Namespace))
+		}
+	}
+
+	function.params = params
+
+	slotsLock.Lock()
+	defer slotsLock.Unlock()
+
+	var trampolines = &slots[resultKind(signature.Result)][len(params)]
+
+	for slot := range trampolines {
+		if trampolines[slot].narrow == nil && trampolines[slot].wide == nil {
+			trampolines[slot] = function
+			registry.functions = append(registry.functions, &Function{namespace, name, signature, slot})
+			registry.generation++
+
+			return nil
+		}
+	}
+
+	return NewRegistryError(fmt.Sprintf("No trampoline left for the `%s` host function; only accept %d host functions of the signature `%s`.", name, SlotsPerArity, signature))
+}
+
+// Unregister removes the host function `name` from the registry and
+// frees its trampoline. The instances importing the function must be
+// closed before.
+func (registry *Registry) Unregister(name string) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	for nth, registered := range registry.functions {
+		if registered.Name != name {
+			continue
+		}
+
+		slotsLock.Lock()
+		slots[resultKind(registered.Signature.Result)][len(registered.Signature.params())][registered.slot] = hostFunction{}
+		slotsLock.Unlock()
+
+		registry.functions = append(registry.functions[:nth], registry.functions[nth+1:]...)
+		registry.generation++
+
+		return
+	}
+}
+
+// Generation returns a number changed by every registration and
+// unregistration, so that imports built from the registry can be
+// cached until it changes.
+func (registry *Registry) Generation() uint64 {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	return registry.generation
+}
+
+// Functions returns the host functions of the registry, in their
+// registration order.
+func (registry *Registry) Functions() []Function {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	var functions = make([]Function, len(registry.functions))
+
+	for nth, registered := range registry.functions {
+		functions[nth] = *registered
+	}
+
+	return functions
+}
+
+// Imports constructs new `wasmer.Imports` of the host functions of
+// the registry.
+func (registry *Registry) Imports() (*wasmer.Imports, error) {
+	return registry.AppendTo(wasmer.NewImports())
+}
+
+// AppendTo adds the host functions of the registry to `imports`. The
+// current namespace of `imports` is changed.
+func (registry *Registry) AppendTo(imports *wasmer.Imports) (*wasmer.Imports, error) {
+	for _, function := range registry.Functions() {
+		var params = function.Signature.params()
+
+		var results []wasmer.ValueType
+
+		if function.Signature.Result != wasmer.TypeVoid {
+			results = []wasmer.ValueType{function.Signature.Result}
+		}
+
+		var trampoline = C.bridge_trampoline(C.int(resultKind(function.Signature.Result)), C.int(len(params)), C.int(function.slot))
+
+		if _, err := imports.Namespace(function.Namespace).AppendFunctionWithSignature(function.Name, params, results, trampoline); err != nil {
+			return nil, err
+		}
+	}
+
+	return imports, nil
+}
+
+func init() {
+	C.bridge_set_trap(wasmer.TrapFunction())
+}
+
+// bridgeDispatch calls the host function of the trampoline of the
+// `slot` of the `arity` and `result`, and writes its result to
+// `value`. It returns 0 if the slot is empty, the trampoline then
+// traps.
+//
+//export bridgeDispatch
+func bridgeDispatch(result C.int, arity C.int, slot C.int, context unsafe.Pointer, args32 *C.int32_t, args64 *C.int64_t, value *C.int64_t) C.int {
+	var narrowArgs = (*[MaxParams + 1]int32)(unsafe.Pointer(args32))[:arity:arity]
+	var wideArgs = (*[MaxParams + 1]int64)(unsafe.Pointer(args64))[:arity:arity]
+
+	var function, ok = lookup(int(result), int(arity), int(slot))
+
+	if !ok {
+		return 0
+	}
+
+	var instanceContext = wasmer.IntoInstanceContext(context)
+	var returned = function.call(&instanceContext, narrowArgs, wideArgs)
+
+	*value = C.int64_t(returned)
+
+	return 1
+}
+
+// lookup returns the host function of the slot, false if the slot is
+// empty.
+func lookup(result int, arity int, slot int) (hostFunction, bool) {
+	slotsLock.RLock()
+	defer slotsLock.RUnlock()
+
+	var function = slots[result][arity][slot]
+
+	return function, function.narrow != nil || function.wide != nil
+}
+
+// call calls the host function with the arguments of its kind.
+func (function hostFunction) call(instanceContext *wasmer.InstanceContext, narrowArgs []int32, wideArgs []int64) int64 {
+	if function.wide == nil {
+		return function.narrow(instanceContext, narrowArgs)
+	}
+
+	// the upper bits of the `i32` arguments are not set by the caller
+	for nth, param := range function.params {
+		if param == wasmer.TypeI32 {
+			wideArgs[nth] = int64(int32(wideArgs[nth]))
+		}
+	}
+
+	return function.wide(instanceContext, wideArgs)
+}
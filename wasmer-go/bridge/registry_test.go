@@ -0,0 +1,141 @@
+package bridge
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go"
+)
+
+func nop(context *wasmer.InstanceContext, args []int32) int64 {
+	return 0
+}
+
+func TestRegisterRejectsInvalidSignatures(t *testing.T) {
+	var registry = NewRegistry()
+	defer registry.Unregister("valid")
+
+	if err := registry.Register("env", "valid", Signature{Params: 2, Result: wasmer.TypeI32}, nop); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, signature := range map[string]Signature{
+		"negative": {Params: -1, Result: wasmer.TypeI32},
+		"too_many": {Params: MaxParams + 1, Result: wasmer.TypeI32},
+		"float":    {ParamTypes: []wasmer.ValueType{wasmer.TypeF64}, Result: wasmer.TypeI32},
+		"wide":     {ParamTypes: []wasmer.ValueType{wasmer.TypeI64}, Result: wasmer.TypeI32},
+		"mismatch": {Params: 2, ParamTypes: []wasmer.ValueType{wasmer.TypeI32}, Result: wasmer.TypeI32},
+		"result":   {Params: 1, Result: wasmer.TypeF32},
+	} {
+		if err := registry.Register("env", name, signature, nop); err == nil {
+			registry.Unregister(name)
+			t.Errorf("%s: expected the signature `%s` to be rejected", name, signature)
+		}
+	}
+
+	if err := registry.Register("env", "nil", Signature{Params: 1, Result: wasmer.TypeI32}, nil); err == nil {
+		t.Error("expected a host function without implementation to be rejected")
+	}
+	if err := registry.Register("other", "valid", Signature{Params: 2, Result: wasmer.TypeI32}, nop); err == nil {
+		t.Error("expected a name registered twice to be rejected")
+	}
+	if err := registry.RegisterWide("env", "float", Signature{ParamTypes: []wasmer.ValueType{wasmer.TypeF32}}, nil); err == nil {
+		t.Error("expected a wide host function without implementation to be rejected")
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	var registry = NewRegistry()
+	defer registry.Unregister("sum")
+	defer registry.Unregister("wide_sum")
+
+	var sum = func(context *wasmer.InstanceContext, args []int32) int64 {
+		return int64(args[0]) + int64(args[1])
+	}
+	if err := registry.Register("env", "sum", Signature{Params: 2, Result: wasmer.TypeI64}, sum); err != nil {
+		t.Fatal(err)
+	}
+	var wideSum = func(context *wasmer.InstanceContext, args []int64) int64 {
+		return args[0] + args[1]
+	}
+	var signature = Signature{ParamTypes: []wasmer.ValueType{wasmer.TypeI32, wasmer.TypeI64}, Result: wasmer.TypeI64}
+	if err := registry.RegisterWide("env", "wide_sum", signature, wideSum); err != nil {
+		t.Fatal(err)
+	}
+	if signature.String() != "(i32, i64) -> i64" {
+		t.Errorf("unexpected signature %s", signature)
+	}
+
+	var functions = registry.Functions()
+	if len(functions) != 2 || functions[0].Name != "sum" || functions[1].Name != "wide_sum" {
+		t.Fatalf("unexpected functions %v", functions)
+	}
+
+	function, ok := lookup(resultKind(wasmer.TypeI64), 2, functions[0].slot)
+	if !ok {
+		t.Fatal("expected the host function in its slot")
+	}
+	if result := function.call(nil, []int32{-3, 5}, []int64{0, 0}); result != 2 {
+		t.Errorf("expected the i32 arguments, got %d", result)
+	}
+
+	function, ok = lookup(resultKind(wasmer.TypeI64), 2, functions[1].slot)
+	if !ok {
+		t.Fatal("expected the wide host function in its slot")
+	}
+	// the upper bits of an i32 argument are garbage
+	if result := function.call(nil, []int32{0, 0}, []int64{0x7fffffff00000000 | 0xfffffffd, 1 << 40}); result != 1<<40-3 {
+		t.Errorf("expected the i32 argument sign-extended, got %d", result)
+	}
+}
+
+func TestUnregisterFreesTheSlot(t *testing.T) {
+	var registry = NewRegistry()
+	var signature = Signature{Params: 3, Result: wasmer.TypeVoid}
+	var generation = registry.Generation()
+
+	for nth := 0; nth < SlotsPerArity; nth++ {
+		if err := registry.Register("env", fmt.Sprintf("f%d", nth), signature, nop); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := registry.Register("env", "exhausted", signature, nop); err == nil {
+		t.Fatal("expected no trampoline left")
+	}
+	// another result has its own trampolines
+	if err := registry.Register("env", "i32", Signature{Params: 3, Result: wasmer.TypeI32}, nop); err != nil {
+		t.Fatal(err)
+	}
+	registry.Unregister("i32")
+
+	var slot = registry.Functions()[0].slot
+	registry.Unregister("f0")
+	if _, ok := lookup(resultKind(wasmer.TypeVoid), 3, slot); ok {
+		t.Error("expected the slot of an unregistered function to be empty")
+	}
+	if err := registry.Register("env", "reused", signature, nop); err != nil {
+		t.Fatal(err)
+	}
+	if registry.Generation() == generation {
+		t.Error("expected the generation to change")
+	}
+
+	for _, function := range registry.Functions() {
+		registry.Unregister(function.Name)
+	}
+	if len(registry.Functions()) != 0 {
+		t.Errorf("expected an empty registry, got %v", registry.Functions())
+	}
+}
+
+func TestAppendTo(t *testing.T) {
+	var registry = NewRegistry()
+	defer registry.Unregister("log")
+
+	if err := registry.Register("env", "log", Signature{Params: 2, Result: wasmer.TypeVoid}, nop); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Imports(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,159 @@
+// The trampolines are the C functions given to wasmer as host
+// functions. wasmer gives no user data to a host function, so each
+// registered Go function has its own trampoline, which forwards its
+// result, its arity, its slot and its arguments to the Go dispatcher.
+//
+// The parameters are declared `int64_t`: `i32` and `i64` arguments are
+// both passed in the integer registers, or in 8 bytes stack slots, so
+// a trampoline receives either type and truncates the `i32` ones.
+// `f32` and `f64` arguments are passed in the float registers, they
+// are not supported.
+
+#include <stddef.h>
+#include <stdint.h>
+
+#include "_cgo_export.h"
+#include "trampolines.h"
+
+typedef int (*trap_function)(const void *context, const char *error_message);
+
+static trap_function bridge_trap;
+
+// Read by wasmer once the trampoline has trapped, so it is static.
+static const char *unregistered = "No host function is registered for the trampoline.";
+
+void bridge_set_trap(void *trap) {
+    bridge_trap = (trap_function)trap;
+}
+
+// Calls the Go dispatcher. When the slot is empty, traps from C: the
+// trap unwinds the trampoline and never the Go frames.
+static int64_t bridge_call(int result, int arity, int slot, void *context, int32_t *args32, int64_t *args64) {
+    int64_t value = 0;
+
+    if (!bridgeDispatch(result, arity, slot, context, args32, args64, &value) && bridge_trap != NULL) {
+        bridge_trap(context, unregistered);
+    }
+
+    return value;
+}
+
+// Parameters of the trampolines of each arity.
+#define PARAMS_0 void *context
+#define PARAMS_1 PARAMS_0, int64_t a0
+#define PARAMS_2 PARAMS_1, int64_t a1
+#define PARAMS_3 PARAMS_2, int64_t a2
+#define PARAMS_4 PARAMS_3, int64_t a3
+#define PARAMS_5 PARAMS_4, int64_t a4
+#define PARAMS_6 PARAMS_5, int64_t a5
+#define PARAMS_7 PARAMS_6, int64_t a6
+#define PARAMS_8 PARAMS_7, int64_t a7
+
+// Arguments given to the dispatcher as `i32` and as `i64`, arrays of
+// one element at least.
+#define ARGS32_0 0
+#define ARGS32_1 (int32_t)a0
+#define ARGS32_2 ARGS32_1, (int32_t)a1
+#define ARGS32_3 ARGS32_2, (int32_t)a2
+#define ARGS32_4 ARGS32_3, (int32_t)a3
+#define ARGS32_5 ARGS32_4, (int32_t)a4
+#define ARGS32_6 ARGS32_5, (int32_t)a5
+#define ARGS32_7 ARGS32_6, (int32_t)a6
+#define ARGS32_8 ARGS32_7, (int32_t)a7
+
+#define ARGS64_0 0
+#define ARGS64_1 a0
+#define ARGS64_2 ARGS64_1, a1
+#define ARGS64_3 ARGS64_2, a2
+#define ARGS64_4 ARGS64_3, a3
+#define ARGS64_5 ARGS64_4, a4
+#define ARGS64_6 ARGS64_5, a5
+#define ARGS64_7 ARGS64_6, a6
+#define ARGS64_8 ARGS64_7, a7
+
+#define ARRAYS(arity)                 \
+    int32_t args32[] = {ARGS32_##arity}; \
+    int64_t args64[] = {ARGS64_##arity}
+
+#define TRAMPOLINE(arity, slot)                                                                \
+    static void trampoline_void_##arity##_##slot(PARAMS_##arity) {                             \
+        ARRAYS(arity);                                                                         \
+        bridge_call(BRIDGE_RESULT_VOID, arity, slot, context, args32, args64);                 \
+    }                                                                                          \
+    static int32_t trampoline_i32_##arity##_##slot(PARAMS_##arity) {                           \
+        ARRAYS(arity);                                                                         \
+        return (int32_t)bridge_call(BRIDGE_RESULT_I32, arity, slot, context, args32, args64);  \
+    }                                                                                          \
+    static int64_t trampoline_i64_##arity##_##slot(PARAMS_##arity) {                           \
+        ARRAYS(arity);                                                                         \
+        return bridge_call(BRIDGE_RESULT_I64, arity, slot, context, args32, args64);           \
+    }
+
+#define TRAMPOLINES(arity) \
+    TRAMPOLINE(arity, 0) \
+    TRAMPOLINE(arity, 1) \
+    TRAMPOLINE(arity, 2) \
+    TRAMPOLINE(arity, 3) \
+    TRAMPOLINE(arity, 4) \
+    TRAMPOLINE(arity, 5) \
+    TRAMPOLINE(arity, 6) \
+    TRAMPOLINE(arity, 7) \
+    TRAMPOLINE(arity, 8) \
+    TRAMPOLINE(arity, 9) \
+    TRAMPOLINE(arity, 10) \
+    TRAMPOLINE(arity, 11) \
+    TRAMPOLINE(arity, 12) \
+    TRAMPOLINE(arity, 13) \
+    TRAMPOLINE(arity, 14) \
+    TRAMPOLINE(arity, 15)
+
+#define TABLE(result, arity) { \
+    (void *)trampoline_##result##_##arity##_0, \
+    (void *)trampoline_##result##_##arity##_1, \
+    (void *)trampoline_##result##_##arity##_2, \
+    (void *)trampoline_##result##_##arity##_3, \
+    (void *)trampoline_##result##_##arity##_4, \
+    (void *)trampoline_##result##_##arity##_5, \
+    (void *)trampoline_##result##_##arity##_6, \
+    (void *)trampoline_##result##_##arity##_7, \
+    (void *)trampoline_##result##_##arity##_8, \
+    (void *)trampoline_##result##_##arity##_9, \
+    (void *)trampoline_##result##_##arity##_10, \
+    (void *)trampoline_##result##_##arity##_11, \
+    (void *)trampoline_##result##_##arity##_12, \
+    (void *)trampoline_##result##_##arity##_13, \
+    (void *)trampoline_##result##_##arity##_14, \
+    (void *)trampoline_##result##_##arity##_15 \
+}
+
+#define TABLES(result) { \
+    TABLE(result, 0), \
+    TABLE(result, 1), \
+    TABLE(result, 2), \
+    TABLE(result, 3), \
+    TABLE(result, 4), \
+    TABLE(result, 5), \
+    TABLE(result, 6), \
+    TABLE(result, 7), \
+    TABLE(result, 8) \
+}
+
+TRAMPOLINES(0)
+TRAMPOLINES(1)
+TRAMPOLINES(2)
+TRAMPOLINES(3)
+TRAMPOLINES(4)
+TRAMPOLINES(5)
+TRAMPOLINES(6)
+TRAMPOLINES(7)
+TRAMPOLINES(8)
+
+static void *trampolines[BRIDGE_RESULTS][BRIDGE_MAX_PARAMS + 1][BRIDGE_SLOTS] = {
+    TABLES(void),
+    TABLES(i32),
+    TABLES(i64),
+};
+
+void *bridge_trampoline(int result, int arity, int slot) {
+    return trampolines[result][arity][slot];
+}
@@ -0,0 +1,29 @@
+#ifndef WASMER_GO_BRIDGE_TRAMPOLINES_H
+#define WASMER_GO_BRIDGE_TRAMPOLINES_H
+
+#include <stdint.h>
+
+// The maximum number of integer parameters of a host function.
+#define BRIDGE_MAX_PARAMS 8
+
+// The number of trampolines of each arity and result, i.e. the
+// maximum number of host functions of the same arity and result
+// registered at the same time.
+#define BRIDGE_SLOTS 16
+
+// The results of the trampolines.
+#define BRIDGE_RESULT_VOID 0
+#define BRIDGE_RESULT_I32 1
+#define BRIDGE_RESULT_I64 2
+#define BRIDGE_RESULTS 3
+
+// Returns the trampoline of the `slot` of the `arity` and `result`, a
+// C function `void|int32_t|int64_t (void *context, int64_t ...)`
+// calling the Go host function registered in the slot.
+void *bridge_trampoline(int result, int arity, int slot);
+
+// Sets the function called by the trampolines to trap when no Go host
+// function is registered in their slot, i.e. `wasmer_trap`.
+void bridge_set_trap(void *trap);
+
+#endif
@@ -2,7 +2,6 @@
 
 package wasmer
 
-// #cgo LDFLAGS: -Wl,-rpath,${SRCDIR} -L${SRCDIR} -lwasmer
 // #include "./wasmer.h"
 //
 import "C"
@@ -98,6 +97,8 @@ type cWasmerExportDescriptorsT C.wasmer_export_descriptors_t
 type cWasmerExportFuncT C.wasmer_export_func_t
 type cWasmerExportT C.wasmer_export_t
 type cWasmerExportsT C.wasmer_exports_t
+type cWasmerGlobalDescriptorT C.wasmer_global_descriptor_t
+type cWasmerGlobalT C.wasmer_global_t
 type cWasmerImportDescriptorT C.wasmer_import_descriptor_t
 type cWasmerImportDescriptorsT C.wasmer_import_descriptors_t
 type cWasmerImportExportKind C.wasmer_import_export_kind
@@ -111,6 +112,7 @@ type cWasmerMemoryT C.wasmer_memory_t
 type cWasmerModuleT C.wasmer_module_t
 type cWasmerResultT C.wasmer_result_t
 type cWasmerSerializedModuleT C.wasmer_serialized_module_t
+type cWasmerTableT C.wasmer_table_t
 type cWasmerValueT C.wasmer_value_t
 type cWasmerValueTag C.wasmer_value_tag
 type cWasmerWasiMapDirEntryT C.wasmer_wasi_map_dir_entry_t
@@ -215,6 +217,38 @@ func cNewWasmerImportTMemory(
 	return (cWasmerImportT)(importedMemory)
 }
 
+func cNewWasmerImportTGlobal(
+	moduleName string,
+	importName string,
+	global *cWasmerGlobalT,
+) cWasmerImportT {
+	var importedGlobal C.wasmer_import_t
+	importedGlobal.module_name = (C.wasmer_byte_array)(cGoStringToWasmerByteArray(moduleName))
+	importedGlobal.import_name = (C.wasmer_byte_array)(cGoStringToWasmerByteArray(importName))
+	importedGlobal.tag = cWasmGlobal
+
+	var pointer = (**C.wasmer_global_t)(unsafe.Pointer(&importedGlobal.value))
+	*pointer = (*C.wasmer_global_t)(global)
+
+	return (cWasmerImportT)(importedGlobal)
+}
+
+func cNewWasmerImportTTable(
+	moduleName string,
+	importName string,
+	table *cWasmerTableT,
+) cWasmerImportT {
+	var importedTable C.wasmer_import_t
+	importedTable.module_name = (C.wasmer_byte_array)(cGoStringToWasmerByteArray(moduleName))
+	importedTable.import_name = (C.wasmer_byte_array)(cGoStringToWasmerByteArray(importName))
+	importedTable.tag = cWasmTable
+
+	var pointer = (**C.wasmer_table_t)(unsafe.Pointer(&importedTable.value))
+	*pointer = (*C.wasmer_table_t)(table)
+
+	return (cWasmerImportT)(importedTable)
+}
+
 func cNewWasmerWasiImportObject(
 	arguments *cWasmerByteArray,
 	argumentsLength uint,
@@ -385,6 +419,14 @@ func cWasmerExportFuncResultsArity(function *cWasmerExportFuncT, result *cUint32
 	))
 }
 
+func cWasmerExportFuncResults(function *cWasmerExportFuncT, results *cWasmerValueTag, resultsLength cUint32T) cWasmerResultT {
+	return (cWasmerResultT)(C.wasmer_export_func_returns(
+		(*C.wasmer_export_func_t)(function),
+		(*C.wasmer_value_tag)(results),
+		(C.uint32_t)(resultsLength),
+	))
+}
+
 func cWasmerExportKind(export *cWasmerExportT) cWasmerImportExportKind {
 	return (cWasmerImportExportKind)(C.wasmer_export_kind(
 		(*C.wasmer_export_t)(export),
@@ -429,6 +471,38 @@ func cWasmerExportsLen(exports *cWasmerExportsT) cInt {
 	))
 }
 
+func cWasmerGlobalDestroy(global *cWasmerGlobalT) {
+	C.wasmer_global_destroy(
+		(*C.wasmer_global_t)(global),
+	)
+}
+
+func cWasmerGlobalGet(global *cWasmerGlobalT) cWasmerValueT {
+	return (cWasmerValueT)(C.wasmer_global_get(
+		(*C.wasmer_global_t)(global),
+	))
+}
+
+func cWasmerGlobalGetDescriptor(global *cWasmerGlobalT) cWasmerGlobalDescriptorT {
+	return (cWasmerGlobalDescriptorT)(C.wasmer_global_get_descriptor(
+		(*C.wasmer_global_t)(global),
+	))
+}
+
+func cWasmerGlobalNew(value cWasmerValueT, mutable bool) *cWasmerGlobalT {
+	return (*cWasmerGlobalT)(C.wasmer_global_new(
+		(C.wasmer_value_t)(value),
+		(C.bool)(mutable),
+	))
+}
+
+func cWasmerGlobalSet(global *cWasmerGlobalT, value cWasmerValueT) {
+	C.wasmer_global_set(
+		(*C.wasmer_global_t)(global),
+		(C.wasmer_value_t)(value),
+	)
+}
+
 func cWasmerImportDescriptorKind(importDescriptor *cWasmerImportDescriptorT) cWasmerImportExportKind {
 	return (cWasmerImportExportKind)(C.wasmer_import_descriptor_kind(
 		(*C.wasmer_import_descriptor_t)(importDescriptor),
@@ -689,6 +763,46 @@ func cWasmerSerializedModuleFromBytes(
 	))
 }
 
+func cWasmerTableDestroy(table *cWasmerTableT) {
+	C.wasmer_table_destroy(
+		(*C.wasmer_table_t)(table),
+	)
+}
+
+func cWasmerTableGrow(table *cWasmerTableT, delta cUint32T) cWasmerResultT {
+	return (cWasmerResultT)(C.wasmer_table_grow(
+		(*C.wasmer_table_t)(table),
+		(C.uint32_t)(delta),
+	))
+}
+
+func cWasmerTableLength(table *cWasmerTableT) cUint32T {
+	return (cUint32T)(C.wasmer_table_length(
+		(*C.wasmer_table_t)(table),
+	))
+}
+
+func cWasmerTableNew(table **cWasmerTableT, min, max cUint32T) cWasmerResultT {
+	limits := C.wasmer_limits_t{
+		min: C.uint32_t(min),
+		max: C.wasmer_limit_option_t{
+			has_some: false,
+		},
+	}
+
+	if max > 0 {
+		limits.max = C.wasmer_limit_option_t{
+			has_some: true,
+			some:     C.uint32_t(max),
+		}
+	}
+
+	return (cWasmerResultT)(C.wasmer_table_new(
+		(**C.wasmer_table_t)(unsafe.Pointer(table)),
+		limits,
+	))
+}
+
 func cWasmerValidate(wasmBytes *cUchar, wasmBytesLength cUint) cBool {
 	return (cBool)(C.wasmer_validate(
 		(*C.uchar)(wasmBytes),
@@ -760,6 +874,10 @@ func cGetFunctionFromImport(inner *cWasmerImportT) *cWasmerImportFuncT {
 
 // @by taifu
 // Stop executing the current instance
+func cWasmerTrapFunction() unsafe.Pointer {
+	return unsafe.Pointer(C.wasmer_trap)
+}
+
 func cWasmerTrap(
 	instanceContext *cWasmerInstanceContextT,
 	errorMessage string,
@@ -6,6 +6,8 @@ import (
 )
 
 // GetLastError returns the last error message if any, otherwise returns an error.
+// The last error is thread-local: the goroutine must stay locked to its OS
+// thread with `runtime.LockOSThread` from the failing call to this read.
 func GetLastError() (string, error) {
 	var errorLength = cWasmerLastErrorLength()
 
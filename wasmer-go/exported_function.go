@@ -0,0 +1,194 @@
+package wasmer
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"unsafe"
+)
+
+// ExportedFunction represents a function exported by a WebAssembly
+// instance, with its full signature. Unlike the closures of
+// `Instance.Exports`, it gives access to every result of a
+// multi-value function, and its calls are prepared once with
+// `Prepare` instead of converting untyped arguments at every call.
+type ExportedFunction struct {
+	name     *cStringHolder
+	instance *cWasmerInstanceT
+	handle   *instanceHandle
+	params   []ValueType
+	results  []ValueType
+}
+
+// Name returns the export name of the function.
+func (function *ExportedFunction) Name() string {
+	return function.name.value
+}
+
+// Params returns the parameter types of the function.
+func (function *ExportedFunction) Params() []ValueType {
+	return function.params
+}
+
+// Results returns the result types of the function, empty if the
+// function returns nothing.
+func (function *ExportedFunction) Results() []ValueType {
+	return function.results
+}
+
+// String formats the signature of the function, e.g.
+// `allocate(i32) -> (i32)`.
+func (function *ExportedFunction) String() string {
+	return fmt.Sprintf("%s(%s) -> (%s)", function.Name(), joinTypes(function.params), joinTypes(function.results))
+}
+
+// Prepare validates the argument types the caller is going to pass
+// against the signature of the function, and returns a call whose
+// argument and result buffers are allocated once and reused by every
+// `Call`.
+func (function *ExportedFunction) Prepare(params ...ValueType) (*PreparedCall, error) {
+	if len(params) != len(function.params) {
+		return nil, NewExportedFunctionError(function.Name(), fmt.Sprintf("The `%%s` exported function expects %d argument(s), prepared with %d.", len(function.params), len(params)))
+	}
+	for nth, param := range params {
+		if param != function.params[nth] {
+			return nil, NewExportedFunctionError(function.Name(), fmt.Sprintf("Argument #%d of the `%%s` exported function must be of type `%s`, prepared with `%s`.", nth+1, function.params[nth], param))
+		}
+	}
+
+	call := &PreparedCall{
+		function: function,
+		// one more value of capacity, so that an empty buffer still has an address to give to wasmer
+		inputs:  make([]cWasmerValueT, len(function.params), len(function.params)+1),
+		outputs: make([]cWasmerValueT, len(function.results), len(function.results)+1),
+		results: make([]Value, len(function.results)),
+	}
+	for nth, param := range function.params {
+		switch param {
+		case TypeI32:
+			call.inputs[nth].tag = cWasmI32
+		case TypeI64:
+			call.inputs[nth].tag = cWasmI64
+		case TypeF32:
+			call.inputs[nth].tag = cWasmF32
+		case TypeF64:
+			call.inputs[nth].tag = cWasmF64
+		}
+	}
+	return call, nil
+}
+
+// PreparedCall represents a call of an exported function whose
+// argument types are validated by `ExportedFunction.Prepare`. The
+// setters write the arguments without conversion, they must be used
+// with the types the call is prepared with. A prepared call is not
+// safe for concurrent use.
+type PreparedCall struct {
+	function *ExportedFunction
+	inputs   []cWasmerValueT
+	outputs  []cWasmerValueT
+	results  []Value
+}
+
+// SetI32 sets the `nth` argument, of type `i32`.
+func (call *PreparedCall) SetI32(nth int, value int32) {
+	*(*int32)(unsafe.Pointer(&call.inputs[nth].value)) = value
+}
+
+// SetI64 sets the `nth` argument, of type `i64`.
+func (call *PreparedCall) SetI64(nth int, value int64) {
+	*(*int64)(unsafe.Pointer(&call.inputs[nth].value)) = value
+}
+
+// SetF32 sets the `nth` argument, of type `f32`.
+func (call *PreparedCall) SetF32(nth int, value float32) {
+	*(*float32)(unsafe.Pointer(&call.inputs[nth].value)) = value
+}
+
+// SetF64 sets the `nth` argument, of type `f64`.
+func (call *PreparedCall) SetF64(nth int, value float64) {
+	*(*float64)(unsafe.Pointer(&call.inputs[nth].value)) = value
+}
+
+// Call calls the function with the arguments set, and returns all its
+// results. The returned slice is reused by the next call.
+func (call *PreparedCall) Call() ([]Value, error) {
+	if call.function.handle.closed {
+		return nil, NewExportedFunctionError(call.function.Name(), "The `%s` exported function is called after its instance is closed.")
+	}
+
+	// the trap is read from the thread-local last error of the call
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var callResult = cWasmerInstanceCall(
+		call.function.instance,
+		call.function.name.CPointer,
+		&call.inputs[:1][0],
+		cUint32T(len(call.inputs)),
+		&call.outputs[:1][0],
+		cUint32T(len(call.outputs)),
+	)
+
+	if callResult != cWasmerOk {
+		return nil, newTrapError(call.function.Name())
+	}
+
+	for nth := range call.outputs {
+		result, err := tagToValue(&call.outputs[nth])
+
+		if err != nil {
+			return nil, NewExportedFunctionError(call.function.Name(), fmt.Sprintf("Result #%d of the `%%s` exported function: %s", nth+1, err))
+		}
+
+		call.results[nth] = result
+	}
+	return call.results, nil
+}
+
+// cStringHolder holds a C copy of a Go string, freed when the holder
+// is garbage-collected.
+type cStringHolder struct {
+	value    string
+	CPointer *cChar
+}
+
+// tagToValueType converts a wasmer value tag, it fails on a tag of a
+// type this binding does not support (e.g. `v128` or `funcref`).
+func tagToValueType(tag cWasmerValueTag) (ValueType, error) {
+	switch tag {
+	case cWasmI32:
+		return TypeI32, nil
+	case cWasmI64:
+		return TypeI64, nil
+	case cWasmF32:
+		return TypeF32, nil
+	case cWasmF64:
+		return TypeF64, nil
+	default:
+		return TypeVoid, fmt.Errorf("unsupported value type tag %d", tag)
+	}
+}
+
+func tagToValue(value *cWasmerValueT) (Value, error) {
+	switch value.tag {
+	case cWasmI32:
+		return I32(*(*int32)(unsafe.Pointer(&value.value))), nil
+	case cWasmI64:
+		return I64(*(*int64)(unsafe.Pointer(&value.value))), nil
+	case cWasmF32:
+		return F32(*(*float32)(unsafe.Pointer(&value.value))), nil
+	case cWasmF64:
+		return F64(*(*float64)(unsafe.Pointer(&value.value))), nil
+	default:
+		return void(), fmt.Errorf("unsupported value type tag %d", value.tag)
+	}
+}
+
+func joinTypes(types []ValueType) string {
+	names := make([]string, len(types))
+	for nth, valueType := range types {
+		names[nth] = valueType.String()
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,79 @@
+package wasmer
+
+import (
+	"runtime"
+	"testing"
+	"unsafe"
+)
+
+func newExportedFunction(name string, params []ValueType, results []ValueType) *ExportedFunction {
+	holder := &cStringHolder{value: name, CPointer: cCString(name)}
+	runtime.SetFinalizer(holder, func(h *cStringHolder) {
+		cFree(unsafe.Pointer(h.CPointer))
+	})
+	return &ExportedFunction{name: holder, handle: &instanceHandle{}, params: params, results: results}
+}
+
+func TestTagToValueType(t *testing.T) {
+	for tag, expected := range map[cWasmerValueTag]ValueType{
+		cWasmI32: TypeI32,
+		cWasmI64: TypeI64,
+		cWasmF32: TypeF32,
+		cWasmF64: TypeF64,
+	} {
+		if valueType, err := tagToValueType(tag); err != nil || valueType != expected {
+			t.Errorf("tag %d expected `%s`, got `%s`, %v", tag, expected, valueType, err)
+		}
+	}
+
+	if _, err := tagToValueType(cWasmerValueTag(0x7b)); err == nil {
+		t.Error("expected an error for an unsupported tag")
+	}
+	var value cWasmerValueT
+	*(*cWasmerValueTag)(unsafe.Pointer(&value.tag)) = 0x7b
+	if _, err := tagToValue(&value); err == nil {
+		t.Error("expected an error for a value of an unsupported tag")
+	}
+}
+
+func TestPrepareChecksTheSignature(t *testing.T) {
+	function := newExportedFunction("sum", []ValueType{TypeI32, TypeI64}, []ValueType{TypeI64})
+
+	if function.String() != "sum(i32, i64) -> (i64)" {
+		t.Errorf("unexpected signature %s", function)
+	}
+	if _, err := function.Prepare(TypeI32); err == nil {
+		t.Error("expected an error for a missing argument")
+	}
+	if _, err := function.Prepare(TypeI32, TypeF64); err == nil {
+		t.Error("expected an error for an argument of another type")
+	}
+
+	call, err := function.Prepare(TypeI32, TypeI64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call.SetI32(0, 7)
+	call.SetI64(1, 8)
+	if call.inputs[0].tag != cWasmI32 || call.inputs[1].tag != cWasmI64 {
+		t.Errorf("unexpected argument tags %d, %d", call.inputs[0].tag, call.inputs[1].tag)
+	}
+}
+
+func TestCallAfterClose(t *testing.T) {
+	function := newExportedFunction("sum", []ValueType{TypeI32}, nil)
+	instance := Instance{Functions: map[string]*ExportedFunction{"sum": function}, handle: function.handle}
+	call, err := function.Prepare(TypeI32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a copy shares the state of the instance, closing both is harmless
+	copied := instance
+	instance.Close()
+	copied.Close()
+
+	if _, err := call.Call(); err == nil {
+		t.Error("expected an error when calling a function of a closed instance")
+	}
+}
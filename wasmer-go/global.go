@@ -0,0 +1,165 @@
+package wasmer
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+// ErrModuleGlobal is the cause of the `GlobalError` returned by
+// `Instance.Global` for a global defined and exported by the module:
+// the wasmer C API has no accessor of the exported globals, only the
+// globals created by the host can be read or written.
+var ErrModuleGlobal = errors.New("the global is defined by the module, the wasmer C API gives no access to it")
+
+// GlobalError represents any kind of errors related to a WebAssembly
+// global. It is returned by `Global` functions only.
+type GlobalError struct {
+	// Error message.
+	message string
+	// Cause of the error, if any.
+	cause error
+}
+
+// NewGlobalError constructs a new `GlobalError`.
+func NewGlobalError(message string) *GlobalError {
+	return &GlobalError{message: message}
+}
+
+// `GlobalError` is an actual error. The `Error` function returns
+// the error message.
+func (error *GlobalError) Error() string {
+	return error.message
+}
+
+// Unwrap returns the cause of the error, e.g. `ErrModuleGlobal`.
+func (error *GlobalError) Unwrap() error {
+	return error.cause
+}
+
+// Global represents a WebAssembly global created by the host. It is
+// bound to an imported global with `Imports.AppendGlobal`; the
+// instances importing it share the same value, so a mutable global
+// set by the host is seen by the instances and conversely.
+type Global struct {
+	global    *cWasmerGlobalT
+	valueType ValueType
+	mutable   bool
+}
+
+// NewGlobal instantiates a new WebAssembly global, of the type of
+// its initial value. An immutable global is a constant of the
+// instances importing it.
+func NewGlobal(value Value, mutable bool) (*Global, error) {
+	cValue, err := valueToCValue(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var global = cWasmerGlobalNew(cValue, mutable)
+
+	if global == nil {
+		var lastError, err = GetLastError()
+		var errorMessage = "Failed to allocate the global:\n    %s"
+
+		if err != nil {
+			errorMessage = fmt.Sprintf(errorMessage, "(unknown details)")
+		} else {
+			errorMessage = fmt.Sprintf(errorMessage, lastError)
+		}
+
+		return nil, NewGlobalError(errorMessage)
+	}
+
+	return &Global{global, value.GetType(), mutable}, nil
+}
+
+// Type returns the type of the global value.
+func (global *Global) Type() ValueType {
+	return global.valueType
+}
+
+// IsMutable checks whether the global can be set.
+func (global *Global) IsMutable() bool {
+	return global.mutable
+}
+
+// Get reads the current value of the global.
+func (global *Global) Get() (Value, error) {
+	if global.global == nil {
+		return void(), NewGlobalError("Failed to get the global: the global is closed.")
+	}
+
+	var value = cWasmerGlobalGet(global.global)
+
+	result, err := tagToValue(&value)
+
+	if err != nil {
+		return result, NewGlobalError(fmt.Sprintf("Failed to get the global: %s", err))
+	}
+
+	return result, nil
+}
+
+// Set writes the value of a mutable global. The value must be of the
+// type of the global.
+func (global *Global) Set(value Value) error {
+	if global.global == nil {
+		return NewGlobalError("Failed to set the global: the global is closed.")
+	}
+
+	if !global.IsMutable() {
+		return NewGlobalError("Failed to set the global: the global is immutable.")
+	}
+
+	if valueType := global.Type(); value.GetType() != valueType {
+		return NewGlobalError(fmt.Sprintf("Failed to set the global: the global is of type `%s`, given `%s`.", valueType, value.GetType()))
+	}
+
+	cValue, err := valueToCValue(value)
+
+	if err != nil {
+		return err
+	}
+
+	cWasmerGlobalSet(global.global, cValue)
+
+	return nil
+}
+
+// Close closes/frees the global. It must not be closed while an
+// instance importing it is alive.
+func (global *Global) Close() {
+	if global.global != nil {
+		cWasmerGlobalDestroy(global.global)
+		global.global = nil
+	}
+}
+
+func valueToCValue(value Value) (cWasmerValueT, error) {
+	var cValue cWasmerValueT
+
+	switch value.GetType() {
+	case TypeI32:
+		cValue.tag = cWasmI32
+		*(*int32)(unsafe.Pointer(&cValue.value)) = value.ToI32()
+	case TypeI64:
+		cValue.tag = cWasmI64
+		*(*int64)(unsafe.Pointer(&cValue.value)) = value.ToI64()
+	case TypeF32:
+		cValue.tag = cWasmF32
+		*(*float32)(unsafe.Pointer(&cValue.value)) = value.ToF32()
+	case TypeF64:
+		cValue.tag = cWasmF64
+		*(*float64)(unsafe.Pointer(&cValue.value)) = value.ToF64()
+	default:
+		return cValue, NewGlobalError(fmt.Sprintf("A global can not be of type `%s`.", value.GetType()))
+	}
+
+	return cValue, nil
+}
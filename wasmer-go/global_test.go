@@ -0,0 +1,69 @@
+package wasmer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValueToCValue(t *testing.T) {
+	for _, value := range []Value{I32(-7), I64(1 << 40), F32(1.5), F64(-2.25)} {
+		cValue, err := valueToCValue(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		converted, err := tagToValue(&cValue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if converted.GetType() != value.GetType() || converted.String() != value.String() {
+			t.Errorf("expected %s of type `%s`, got %s of type `%s`", value, value.GetType(), converted, converted.GetType())
+		}
+	}
+
+	if _, err := valueToCValue(void()); err == nil {
+		t.Error("expected an error for a void global")
+	}
+}
+
+func TestSetGlobalChecksMutabilityAndType(t *testing.T) {
+	// the checks fail before the global is touched, a dangling pointer is never read
+	var global = &Global{global: &cWasmerGlobalT{}, valueType: TypeI32}
+
+	if err := global.Set(I32(1)); err == nil {
+		t.Error("expected an error when setting an immutable global")
+	}
+
+	global.mutable = true
+	if err := global.Set(I64(1)); err == nil {
+		t.Error("expected an error when setting a global with a value of another type")
+	}
+
+	var closed = &Global{valueType: TypeI32, mutable: true}
+	if err := closed.Set(I32(1)); err == nil {
+		t.Error("expected an error when setting a closed global")
+	}
+	if _, err := closed.Get(); err == nil {
+		t.Error("expected an error when getting a closed global")
+	}
+}
+
+func TestInstanceGlobal(t *testing.T) {
+	var global = &Global{global: &cWasmerGlobalT{}, valueType: TypeI64}
+	imports, err := NewImports().Namespace("env").AppendGlobal("counter", global)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = imports.AppendGlobal("closed", &Global{valueType: TypeI64}); err == nil {
+		t.Error("expected an error when importing a closed global")
+	}
+
+	var instance = Instance{imports: imports, handle: &instanceHandle{}}
+	if found, err := instance.Global("counter"); err != nil || found != global {
+		t.Errorf("expected the imported global, got %v, %v", found, err)
+	}
+
+	_, err = instance.Global("absent")
+	if err == nil || errors.Is(err, ErrModuleGlobal) {
+		t.Errorf("expected a missing global, got %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package wasmer
 import (
 	"fmt"
 	"reflect"
+	"sync"
 	"unsafe"
 )
 
@@ -121,8 +122,9 @@ func (error *ImportedFunctionError) Error() string {
 	return fmt.Sprintf(error.message, error.functionName)
 }
 
-// Import represents a WebAssembly instance imported function or
-// memory. Imagine it is an union of `ImportFunction` and `ImportMemory`.
+// Import represents a WebAssembly instance imported function,
+// memory, global or table. Imagine it is an union of
+// `ImportFunction`, `ImportMemory`, `ImportGlobal` and `ImportTable`.
 type Import interface{}
 
 // ImportFunction represents a WebAssembly instance imported function.
@@ -158,6 +160,24 @@ type ImportMemory struct {
 	namespace string
 }
 
+// ImportGlobal represents a WebAssembly instance imported global.
+type ImportGlobal struct {
+	// Global to import.
+	global *Global
+
+	// The namespace of the imported global.
+	namespace string
+}
+
+// ImportTable represents a WebAssembly instance imported table.
+type ImportTable struct {
+	// Table to import.
+	table *Table
+
+	// The namespace of the imported table.
+	namespace string
+}
+
 // Imports represents a set of imported functions for a WebAssembly instance.
 type Imports struct {
 	// All imports.
@@ -165,6 +185,21 @@ type Imports struct {
 
 	// Current namespace where to register the import.
 	currentNamespace string
+
+	// The C imports, built by the first instantiation and reused by
+	// the next ones until the imports are closed.
+	cImports []cWasmerImportT
+
+	// Whether the imports are shared by several instances, see
+	// `Share`.
+	shared bool
+
+	// The number of references to shared imports: the owner's and
+	// one per instance.
+	references int
+
+	// A pointer, since `ImportObject.Extend` takes the imports by value.
+	lock *sync.Mutex
 }
 
 // NewImports constructs a new empty `Imports`.
@@ -172,7 +207,54 @@ func NewImports() *Imports {
 	var imports = make(map[string]Import)
 	var currentNamespace = "env"
 
-	return &Imports{imports, currentNamespace}
+	return &Imports{imports: imports, currentNamespace: currentNamespace, lock: &sync.Mutex{}}
+}
+
+// Share marks the imports as shared by all the instances instantiated
+// with them, instead of being owned by a single instance. The C
+// imports are built once, each instance holds a reference released by
+// `Instance.Close`, and the owner releases its reference with `Close`:
+// the imports are freed when the last reference is released. Shared
+// imports must not be changed.
+func (imports *Imports) Share() *Imports {
+	imports.lock.Lock()
+	defer imports.lock.Unlock()
+
+	if !imports.shared {
+		imports.shared = true
+		imports.references = 1
+	}
+
+	return imports
+}
+
+// acquire returns the C imports, built if needed, and takes a
+// reference to shared imports for a new instance.
+func (imports *Imports) acquire() []cWasmerImportT {
+	imports.lock.Lock()
+	defer imports.lock.Unlock()
+
+	if imports.cImports == nil {
+		imports.cImports = make([]cWasmerImportT, 0, len(imports.imports))
+
+		for importName, importImport := range imports.imports {
+			// 构建临时对象 cWasmImport
+			cWasmImport := *getCWasmerImport(importName, importImport)
+			imports.cImports = append(imports.cImports, cWasmImport)
+			if importFunc, ok := importImport.(ImportFunction); ok {
+				// 登记 cWasmImport.value 地址，用于instance 销毁时候的释放
+				importedFunctionPointer := (**cWasmerImportFuncT)((unsafe.Pointer)(&cWasmImport.value))
+				importFunc.importedFunctionPointer = *importedFunctionPointer
+				imports.imports[importName] = importFunc
+			}
+		}
+	}
+
+	if imports.shared {
+		imports.references++
+	}
+
+	return imports.cImports
 }
 
 // Namespace changes the current namespace of the next imported functions.
@@ -259,6 +341,63 @@ func (imports *Imports) AppendFunction(importName string, implementation interfa
 	return imports, nil
 }
 
+// AppendFunctionWithSignature adds a new imported function to the
+// current set, with its WebAssembly signature given explicitly instead
+// of being inferred from a Go implementation. `cgoPointer` must be a C
+// function of the signature, taking the instance context first.
+func (imports *Imports) AppendFunctionWithSignature(importName string, params []ValueType, results []ValueType, cgoPointer unsafe.Pointer) (*Imports, error) {
+	if len(results) > 1 {
+		return nil, NewImportedFunctionError(importName, "The `%s` imported function must have at most one output value.")
+	}
+
+	wasmInputs, err := valueTypesToTags(importName, params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	wasmOutputs, err := valueTypesToTags(importName, results)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var importedFunctionPointer *cWasmerImportFuncT
+	var namespace = imports.currentNamespace
+
+	imports.imports[importName] = ImportFunction{
+		nil,
+		cgoPointer,
+		importedFunctionPointer,
+		wasmInputs,
+		wasmOutputs,
+		namespace,
+	}
+
+	return imports, nil
+}
+
+func valueTypesToTags(importName string, valueTypes []ValueType) ([]cWasmerValueTag, error) {
+	var tags = make([]cWasmerValueTag, len(valueTypes))
+
+	for nth, valueType := range valueTypes {
+		switch valueType {
+		case TypeI32:
+			tags[nth] = cWasmI32
+		case TypeI64:
+			tags[nth] = cWasmI64
+		case TypeF32:
+			tags[nth] = cWasmF32
+		case TypeF64:
+			tags[nth] = cWasmF64
+		default:
+			return nil, NewImportedFunctionError(importName, fmt.Sprintf("Invalid type for the `%%s` imported function; given `%s`; only accept `i32`, `i64`, `f32`, and `f64`.", valueType))
+		}
+	}
+
+	return tags, nil
+}
+
 // AppendMemory adds a new imported memory to the current set.
 func (imports *Imports) AppendMemory(importName string, memory *Memory) (*Imports, error) {
 	var namespace = imports.currentNamespace
@@ -271,6 +410,38 @@ func (imports *Imports) AppendMemory(importName string, memory *Memory) (*Import
 	return imports, nil
 }
 
+// AppendGlobal adds a new imported global to the current set.
+func (imports *Imports) AppendGlobal(importName string, global *Global) (*Imports, error) {
+	if global == nil || global.global == nil {
+		return imports, NewGlobalError(fmt.Sprintf("Could not import the `%s` global: the global is nil or closed.", importName))
+	}
+
+	var namespace = imports.currentNamespace
+
+	imports.imports[importName] = ImportGlobal{
+		global,
+		namespace,
+	}
+
+	return imports, nil
+}
+
+// AppendTable adds a new imported table to the current set.
+func (imports *Imports) AppendTable(importName string, table *Table) (*Imports, error) {
+	if table == nil || table.table == nil {
+		return imports, NewTableError(fmt.Sprintf("Could not import the `%s` table: the table is nil or closed.", importName))
+	}
+
+	var namespace = imports.currentNamespace
+
+	imports.imports[importName] = ImportTable{
+		table,
+		namespace,
+	}
+
+	return imports, nil
+}
+
 // Like Append but not for Go imports.
 func (imports *Imports) appendRaw(
 	namespace string,
@@ -301,17 +472,51 @@ func (imports *Imports) appendRaw(
 	return imports, nil
 }
 
+// release releases the reference taken by `acquire` for an instance
+// which failed to be instantiated. Imports which are not shared stay
+// owned by the caller.
+func (imports *Imports) release() {
+	imports.lock.Lock()
+	var shared = imports.shared
+	imports.lock.Unlock()
+
+	if shared {
+		imports.Close()
+	}
+}
+
 // Close closes/frees all imports. For the moment, only imported
-// functions must be freed. Imported memory must be freed manually by the
-// owner.
+// functions must be freed. Imported memories, globals and tables must
+// be freed manually by the owner. Shared imports are freed by the
+// release of their last reference.
 func (imports *Imports) Close() {
-	for _, importImport := range imports.imports {
+	imports.lock.Lock()
+	defer imports.lock.Unlock()
+
+	if imports.shared {
+		imports.references--
+
+		if imports.references > 0 {
+			return
+		}
+	}
+
+	for importName, importImport := range imports.imports {
 		if importFunction, ok := importImport.(ImportFunction); ok {
 			if nil != importFunction.importedFunctionPointer {
 				cWasmerImportFuncDestroy(importFunction.importedFunctionPointer)
+				importFunction.importedFunctionPointer = nil
+				imports.imports[importName] = importFunction
 			}
 		}
 	}
+
+	for _, cImport := range imports.cImports {
+		cFree(unsafe.Pointer(cImport.module_name.bytes))
+		cFree(unsafe.Pointer(cImport.import_name.bytes))
+	}
+
+	imports.cImports = nil
 }
 
 // Helper function: Get a C import for a given import
@@ -359,6 +564,28 @@ func getCWasmerImport(importName string, importImport Import) *cWasmerImportT {
 		return &newImport
 	}
 
+	// Imported global.
+	if importGlobal, ok := importImport.(ImportGlobal); ok {
+		var newImport = cNewWasmerImportTGlobal(
+			importGlobal.namespace,
+			importName,
+			importGlobal.global.global,
+		)
+
+		return &newImport
+	}
+
+	// Imported table.
+	if importTable, ok := importImport.(ImportTable); ok {
+		var newImport = cNewWasmerImportTTable(
+			importTable.namespace,
+			importName,
+			importTable.table.table,
+		)
+
+		return &newImport
+	}
+
 	return nil
 }
 
@@ -384,9 +611,13 @@ func (instanceContext *InstanceContext) Memory() *Memory {
 }
 
 // Data returns the instance context _data as an `interface{}`. It's up to the
-// user to assert the proper type.
+// user to assert the proper type. It returns `nil` if no _data has been set.
 func (instanceContext *InstanceContext) Data() interface{} {
-	contextDataIndex := *(*int)(cWasmerInstanceContextDataGet(instanceContext.context))
+	contextDataPointer := cWasmerInstanceContextDataGet(instanceContext.context)
+	if contextDataPointer == nil {
+		return nil
+	}
+	contextDataIndex := *(*int)(contextDataPointer)
 
 	instancesContextDataMutex.RLock()
 	defer instancesContextDataMutex.RUnlock()
@@ -401,3 +632,10 @@ func Trap(instanceContext *InstanceContext, errorMessage string) bool {
 
 	return result == cWasmerOk
 }
+
+// TrapFunction returns the C function `wasmer_trap`, for the host
+// functions implemented in C: the trap never returns, it unwinds the
+// frames of the host function, which must not be Go frames.
+func TrapFunction() unsafe.Pointer {
+	return cWasmerTrapFunction()
+}
@@ -71,9 +71,17 @@ type Instance struct {
 	// standard Go type.
 	Exports map[string]func(...interface{}) (Value, error)
 
+	// All functions exported by the WebAssembly instance with their
+	// signature, indexed by their name. See `ExportedFunction`.
+	Functions map[string]*ExportedFunction
+
 	// The exported memory of a WebAssembly instance.
 	Memory *Memory
 
+	// The state shared by the copies of the instance and its
+	// exported functions.
+	handle *instanceHandle
+
 	contextDataIndex *int
 }
 
@@ -89,6 +97,9 @@ func NewInstanceWithImports(bytes []byte, imports *Imports) (Instance, error) {
 		func(wasmImportsCPointer *cWasmerImportT, numberOfImports int) (*cWasmerInstanceT, error) {
 			var instance *cWasmerInstanceT
 
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+
 			var compileResult = cWasmerInstantiate(
 				&instance,
 				(*cUchar)(unsafe.Pointer(&bytes[0])),
@@ -119,28 +130,8 @@ func newInstanceWithImports(
 	imports *Imports,
 	instanceBuilder func(*cWasmerImportT, int) (*cWasmerInstanceT, error),
 ) (Instance, error) {
-	var numberOfImports = len(imports.imports)
-	var wasmImports = make([]cWasmerImportT, numberOfImports)
-	var importNth = 0
-
-	for importName, importImport := range imports.imports {
-		// 构建临时对象 cWasmImport
-		cWasmImport := *getCWasmerImport(importName, importImport)
-		wasmImports[importNth] = cWasmImport
-		if importFunc, ok := importImport.(ImportFunction); ok {
-			// 登记 cWasmImport.value 地址，用于instance 销毁时候的释放
-			importedFunctionPointer := (**cWasmerImportFuncT)((unsafe.Pointer)(&cWasmImport.value))
-			imports.imports[importName] = ImportFunction{
-				importFunc.implementation,
-				importFunc.cgoPointer,
-				*importedFunctionPointer,
-				importFunc.wasmInputs,
-				importFunc.wasmOutputs,
-				importFunc.namespace,
-			}
-		}
-		importNth++
-	}
+	var wasmImports = imports.acquire()
+	var numberOfImports = len(wasmImports)
 
 	var wasmImportsCPointer *cWasmerImportT
 
@@ -153,27 +144,41 @@ func newInstanceWithImports(
 	var emptyInstance = Instance{instance: nil, imports: nil, Exports: nil, Memory: nil}
 
 	if err != nil {
+		imports.release()
 		return emptyInstance, err
 	}
 
-	exports, memoryPointer, err := getExportsFromInstance(instance)
+	var handle = &instanceHandle{}
+	exports, functions, memoryPointer, err := getExportsFromInstance(instance, handle)
 
 	if err != nil {
+		imports.release()
+		cWasmerInstanceDestroy(instance)
 		return emptyInstance, err
 	}
 
-	return Instance{instance: instance, imports: imports, Exports: exports, Memory: memoryPointer}, nil
+	return Instance{instance: instance, imports: imports, Exports: exports, Functions: functions, Memory: memoryPointer, handle: handle}, nil
+}
+
+// instanceHandle is the state of an instance shared by the copies of
+// the `Instance` and its exported functions, so that none of them
+// calls the instance once it is closed.
+type instanceHandle struct {
+	closed bool
 }
 
 // Returns the exports, whether it has memory or an error
 func getExportsFromInstance(
 	instance *cWasmerInstanceT,
+	handle *instanceHandle,
 ) (
 	map[string]func(...interface{}) (Value, error),
+	map[string]*ExportedFunction,
 	*Memory,
 	error,
 ) {
 	var exports = make(map[string]func(...interface{}) (Value, error))
+	var functions = make(map[string]*ExportedFunction)
 	var wasmExports *cWasmerExportsT
 	var memoryPointer *Memory
 	cWasmerInstanceExports(instance, &wasmExports)
@@ -190,7 +195,7 @@ func getExportsFromInstance(
 			var wasmMemory *cWasmerMemoryT
 
 			if cWasmerExportToMemory(wasmExport, &wasmMemory) != cWasmerOk {
-				return nil, nil, NewInstanceError("Failed to extract the exported memory.")
+				return nil, nil, nil, NewInstanceError("Failed to extract the exported memory.")
 			}
 
 			var memory = newBorrowedMemory(wasmMemory)
@@ -203,7 +208,7 @@ func getExportsFromInstance(
 			var wasmFunctionInputsArity cUint32T
 
 			if cWasmerExportFuncParamsArity(wasmFunction, &wasmFunctionInputsArity) != cWasmerOk {
-				return nil, nil, NewExportedFunctionError(exportedFunctionName, "Failed to read the input arity of the `%s` exported function.")
+				return nil, nil, nil, NewExportedFunctionError(exportedFunctionName, "Failed to read the input arity of the `%s` exported function.")
 			}
 
 			var wasmFunctionInputSignatures = make([]cWasmerValueTag, int(wasmFunctionInputsArity))
@@ -212,14 +217,24 @@ func getExportsFromInstance(
 				var wasmFunctionInputSignaturesCPointer = (*cWasmerValueTag)(unsafe.Pointer(&wasmFunctionInputSignatures[0]))
 
 				if cWasmerExportFuncParams(wasmFunction, wasmFunctionInputSignaturesCPointer, wasmFunctionInputsArity) != cWasmerOk {
-					return nil, nil, NewExportedFunctionError(exportedFunctionName, "Failed to read the signature of the `%s` exported function.")
+					return nil, nil, nil, NewExportedFunctionError(exportedFunctionName, "Failed to read the signature of the `%s` exported function.")
 				}
 			}
 
 			var wasmFunctionOutputsArity cUint32T
 
 			if cWasmerExportFuncResultsArity(wasmFunction, &wasmFunctionOutputsArity) != cWasmerOk {
-				return nil, nil, NewExportedFunctionError(exportedFunctionName, "Failed to read the output arity of the `%s` exported function.")
+				return nil, nil, nil, NewExportedFunctionError(exportedFunctionName, "Failed to read the output arity of the `%s` exported function.")
+			}
+
+			var wasmFunctionOutputSignatures = make([]cWasmerValueTag, int(wasmFunctionOutputsArity))
+
+			if wasmFunctionOutputsArity > 0 {
+				var wasmFunctionOutputSignaturesCPointer = (*cWasmerValueTag)(unsafe.Pointer(&wasmFunctionOutputSignatures[0]))
+
+				if cWasmerExportFuncResults(wasmFunction, wasmFunctionOutputSignaturesCPointer, wasmFunctionOutputsArity) != cWasmerOk {
+					return nil, nil, nil, NewExportedFunctionError(exportedFunctionName, "Failed to read the result signature of the `%s` exported function.")
+				}
 			}
 
 			var numberOfExpectedArguments = int(wasmFunctionInputsArity)
@@ -227,19 +242,43 @@ func getExportsFromInstance(
 			var wasmInputs = make([]cWasmerValueT, wasmFunctionInputsArity)
 			var wasmOutputs = make([]cWasmerValueT, wasmFunctionOutputsArity)
 
-			type wasmFunctionNameHolder struct {
-				CPointer *cChar
-			}
-
-			wasmFunctionName := &wasmFunctionNameHolder{
+			wasmFunctionName := &cStringHolder{
+				value:    exportedFunctionName,
 				CPointer: cCString(exportedFunctionName),
 			}
 
-			runtime.SetFinalizer(wasmFunctionName, func(h *wasmFunctionNameHolder) {
+			runtime.SetFinalizer(wasmFunctionName, func(h *cStringHolder) {
 				cFree(unsafe.Pointer(h.CPointer))
 			})
 
+			var exportedFunction = &ExportedFunction{
+				name:     wasmFunctionName,
+				instance: instance,
+				handle:   handle,
+				params:   make([]ValueType, len(wasmFunctionInputSignatures)),
+				results:  make([]ValueType, len(wasmFunctionOutputSignatures)),
+			}
+			for nth, tag := range wasmFunctionInputSignatures {
+				valueType, err := tagToValueType(tag)
+				if err != nil {
+					return nil, nil, nil, NewExportedFunctionError(exportedFunctionName, fmt.Sprintf("Argument #%d of the `%%s` exported function: %s", nth+1, err))
+				}
+				exportedFunction.params[nth] = valueType
+			}
+			for nth, tag := range wasmFunctionOutputSignatures {
+				valueType, err := tagToValueType(tag)
+				if err != nil {
+					return nil, nil, nil, NewExportedFunctionError(exportedFunctionName, fmt.Sprintf("Result #%d of the `%%s` exported function: %s", nth+1, err))
+				}
+				exportedFunction.results[nth] = valueType
+			}
+			functions[exportedFunctionName] = exportedFunction
+
 			exports[exportedFunctionName] = func(arguments ...interface{}) (Value, error) {
+				if handle.closed {
+					return I32(0), NewExportedFunctionError(exportedFunctionName, "The `%s` exported function is called after its instance is closed.")
+				}
+
 				var numberOfGivenArguments = len(arguments)
 				var diff = numberOfExpectedArguments - numberOfGivenArguments
 
@@ -376,6 +415,10 @@ func getExportsFromInstance(
 					wasmOutputsCPointer = (*cWasmerValueT)(unsafe.Pointer(&wasmOutputs))
 				}
 
+				// the trap is read from the thread-local last error of the call
+				runtime.LockOSThread()
+				defer runtime.UnlockOSThread()
+
 				var callResult = cWasmerInstanceCall(
 					instance,
 					wasmFunctionName.CPointer,
@@ -386,11 +429,7 @@ func getExportsFromInstance(
 				)
 
 				if callResult != cWasmerOk {
-					var lastError, err = GetLastError()
-					if err == nil {
-						return I32(0), NewExportedFunctionError(exportedFunctionName, "Failed to call the `%s` exported function. instance call error: "+lastError)
-					}
-					return I32(0), NewExportedFunctionError(exportedFunctionName, "Failed to call the `%s` exported function.")
+					return I32(0), newTrapError(exportedFunctionName)
 				}
 
 				if wasmFunctionOutputsArity > 0 {
@@ -422,7 +461,7 @@ func getExportsFromInstance(
 			}
 		}
 	}
-	return exports, memoryPointer, nil
+	return exports, functions, memoryPointer, nil
 }
 
 // HasMemory checks whether the instance has at least one exported memory.
@@ -430,6 +469,56 @@ func (instance *Instance) HasMemory() bool {
 	return nil != instance.Memory
 }
 
+// Global returns the global of the instance named `name`, to read
+// or write it. The global must be created by the host and imported
+// with `Imports.AppendGlobal` under this name; a module exporting
+// its imported global under the same name exports this global too.
+// The wasmer C API does not give access to the globals defined by
+// the module, the lookup of such an exported global fails with an
+// error whose cause is `ErrModuleGlobal`.
+func (instance *Instance) Global(name string) (*Global, error) {
+	if instance.imports != nil {
+		if importGlobal, ok := instance.imports.imports[name].(ImportGlobal); ok {
+			return importGlobal.global, nil
+		}
+	}
+
+	if instance.instance != nil && !instance.handle.closed && instance.exportsGlobal(name) {
+		return nil, &GlobalError{
+			message: fmt.Sprintf("The `%s` exported global is defined by the module, only the globals imported from the host can be accessed.", name),
+			cause:   ErrModuleGlobal,
+		}
+	}
+
+	return nil, NewGlobalError(fmt.Sprintf("The `%s` global does not exist.", name))
+}
+
+// exportsGlobal checks whether the instance exports a global named
+// `name`.
+func (instance *Instance) exportsGlobal(name string) bool {
+	var wasmExports *cWasmerExportsT
+	cWasmerInstanceExports(instance.instance, &wasmExports)
+	defer cWasmerExportsDestroy(wasmExports)
+
+	var numberOfExports = int(cWasmerExportsLen(wasmExports))
+
+	for nth := 0; nth < numberOfExports; nth++ {
+		var wasmExport = cWasmerExportsGet(wasmExports, cInt(nth))
+
+		if cWasmerExportKind(wasmExport) != cWasmGlobal {
+			continue
+		}
+
+		var wasmExportName = cWasmerExportName(wasmExport)
+
+		if cGoStringN((*cChar)(unsafe.Pointer(wasmExportName.bytes)), (cInt)(wasmExportName.bytes_len)) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
 var (
 
 	// In order to avoid passing illegal Go pointers across the
@@ -482,8 +571,15 @@ func (instance *Instance) SetContextData(data interface{}) {
 	)
 }
 
-// Close closes/frees an `Instance`.
+// Close closes/frees an `Instance`. Closing it again, or closing a
+// copy of it, does nothing.
 func (instance *Instance) Close() {
+	if instance.handle != nil {
+		if instance.handle.closed {
+			return
+		}
+		instance.handle.closed = true
+	}
 	if instance.imports != nil {
 		instance.imports.Close()
 	}
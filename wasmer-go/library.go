@@ -0,0 +1,183 @@
+package wasmer
+
+import (
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// ExpectedVersion is the version of Wasmer this package is written
+// for: the one of the runtime C API described by `wasmer.h`, and of the
+// shared libraries shipped next to the sources.
+const ExpectedVersion = "0.17.1"
+
+// ErrUnknownLibraryVersion is the cause of the `LibraryError` returned
+// by `CheckLibrary` when the version of the loaded library cannot be
+// detected, e.g. a library built without the `make libwasmer` recipe.
+// The library may or may not be supported.
+var ErrUnknownLibraryVersion = errors.New("The Wasmer library version cannot be detected")
+
+// LibraryError represents an error related to the Wasmer shared
+// library loaded by the process. It is returned by `LoadedLibrary` and
+// `CheckLibrary` only.
+type LibraryError struct {
+	// Error message.
+	message string
+
+	// Error cause, if any, e.g. `ErrUnknownLibraryVersion`.
+	cause error
+}
+
+// NewLibraryError constructs a new `LibraryError`.
+func NewLibraryError(message string) *LibraryError {
+	return &LibraryError{message: message}
+}
+
+// `LibraryError` is an actual error. The `Error` function returns
+// the error message.
+func (error *LibraryError) Error() string {
+	return error.message
+}
+
+// Unwrap returns the cause of the error, if any.
+func (error *LibraryError) Unwrap() error {
+	return error.cause
+}
+
+// Library describes the Wasmer shared library loaded by the process.
+type Library struct {
+	// Path of the shared library file.
+	Path string
+
+	// Version of Wasmer the library has been built from, empty if it
+	// cannot be detected.
+	Version string
+}
+
+// LibraryVersionSection is the name of the ELF section holding the
+// Wasmer version of a library built by the `make libwasmer` recipe,
+// added with `objcopy --add-section`.
+const LibraryVersionSection = ".wasmer_version"
+
+// The SHA-256 checksums of the shared libraries shipped next to the
+// sources, and their Wasmer version.
+var knownLibraries = map[string]string{
+	// libwasmer.dylib
+	"a33569a319519e7ae64afc9b253a3216044f5a4ac3e86c59d9604e4fbfe04849": "0.17.1",
+	// wasmer.dll
+	"05d5547bebcafbebdd90b71596b845df476e389ab296dd20a1ebce02bb555b61": "0.17.1",
+}
+
+var (
+	loadedLibrary      *Library
+	loadedLibraryError error
+	loadedLibraryOnce  sync.Once
+)
+
+// LoadedLibrary returns the Wasmer shared library loaded by the
+// process. It is resolved once, the result is cached.
+func LoadedLibrary() (*Library, error) {
+	loadedLibraryOnce.Do(func() {
+		var path, err = libraryPath()
+
+		if err != nil {
+			loadedLibraryError = err
+
+			return
+		}
+
+		library := &Library{Path: path}
+		library.Version, loadedLibraryError = libraryVersion(path)
+		loadedLibrary = library
+	})
+
+	return loadedLibrary, loadedLibraryError
+}
+
+// CheckLibrary returns the Wasmer shared library loaded by the
+// process, or a `LibraryError` if it is not the `ExpectedVersion`. The
+// error of a library whose version cannot be detected wraps
+// `ErrUnknownLibraryVersion`, to be told apart from a confirmed
+// mismatch.
+func CheckLibrary() (*Library, error) {
+	var library, err = LoadedLibrary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return library, library.check()
+}
+
+// check returns a `LibraryError` if the library is not the
+// `ExpectedVersion`.
+func (library *Library) check() error {
+	if library.Version == "" {
+		return &LibraryError{
+			message: fmt.Sprintf(
+				"Cannot check the Wasmer library %s: its version cannot be detected, this package expects version %s",
+				library.Path,
+				ExpectedVersion,
+			),
+			cause: ErrUnknownLibraryVersion,
+		}
+	}
+
+	if library.Version != ExpectedVersion {
+		return NewLibraryError(
+			fmt.Sprintf(
+				"Wasmer version mismatch: %s is version %s, this package expects version %s",
+				library.Path,
+				library.Version,
+				ExpectedVersion,
+			),
+		)
+	}
+
+	return nil
+}
+
+// libraryVersion returns the Wasmer version of a library shipped next
+// to the sources, known by its checksum, or of a library built by the
+// `make libwasmer` recipe, read from its `LibraryVersionSection`. It is
+// empty for any other library.
+func libraryVersion(path string) (string, error) {
+	var content, err = ioutil.ReadFile(path)
+
+	if err != nil {
+		return "", NewLibraryError(fmt.Sprintf("Failed to read the Wasmer library: %s", err.Error()))
+	}
+
+	var checksum = sha256.Sum256(content)
+
+	if version, ok := knownLibraries[hex.EncodeToString(checksum[:])]; ok {
+		return version, nil
+	}
+
+	file, err := elf.Open(path)
+
+	if err != nil {
+		return "", nil
+	}
+
+	defer file.Close()
+
+	var section = file.Section(LibraryVersionSection)
+
+	if section == nil {
+		return "", nil
+	}
+
+	data, err := section.Data()
+
+	if err != nil {
+		return "", NewLibraryError(fmt.Sprintf("Failed to read the Wasmer library version: %s", err.Error()))
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,8 @@
+// +build !linux,!darwin !amd64,!arm64
+
+package wasmer
+
+// libraryPath is not supported on this platform.
+func libraryPath() (string, error) {
+	return "", NewLibraryError("Failed to locate the Wasmer library: not supported on this platform")
+}
@@ -0,0 +1,77 @@
+package wasmer
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestLibraryVersion(t *testing.T) {
+	for _, path := range []string{"libwasmer.dylib", "wasmer.dll"} {
+		if version, err := libraryVersion(path); err != nil || version != ExpectedVersion {
+			t.Errorf("%s: expected version %s, got `%s`, %v", path, ExpectedVersion, version, err)
+		}
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, err := libraryVersion(executable); err != nil || version != "" {
+		t.Errorf("expected no version in a library without a version section, got `%s`, %v", version, err)
+	}
+
+	if version, err := libraryVersion("library.go"); err != nil || version != "" {
+		t.Errorf("expected no version of a file which is not a shared library, got `%s`, %v", version, err)
+	}
+
+	if _, err := libraryVersion("missing.so"); err == nil {
+		t.Error("expected an error for a missing library")
+	}
+}
+
+func TestLibraryVersionSection(t *testing.T) {
+	objcopy, err := exec.LookPath("objcopy")
+	if err != nil {
+		t.Skip("objcopy is not installed")
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// as the `make libwasmer` recipe does
+	var directory = t.TempDir()
+	var version = filepath.Join(directory, "version")
+	var library = filepath.Join(directory, "libwasmer.so")
+	if err := ioutil.WriteFile(version, []byte(ExpectedVersion+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var command = exec.Command(objcopy, "--add-section", LibraryVersionSection+"="+version, executable, library)
+	if output, err := command.CombinedOutput(); err != nil {
+		t.Skipf("objcopy failed: %v, %s", err, output)
+	}
+
+	if found, err := libraryVersion(library); err != nil || found != ExpectedVersion {
+		t.Errorf("expected version %s, got `%s`, %v", ExpectedVersion, found, err)
+	}
+}
+
+func TestCheckLibrary(t *testing.T) {
+	if err := (&Library{Path: "libwasmer.so", Version: ExpectedVersion}).check(); err != nil {
+		t.Errorf("expected the expected version to be accepted, got %v", err)
+	}
+
+	var err = (&Library{Path: "libwasmer.so", Version: "0.16.2"}).check()
+	if err == nil || errors.Is(err, ErrUnknownLibraryVersion) {
+		t.Errorf("expected a version mismatch, got %v", err)
+	}
+
+	err = (&Library{Path: "libwasmer.so"}).check()
+	if !errors.Is(err, ErrUnknownLibraryVersion) {
+		t.Errorf("expected an unknown version, got %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+// +build linux darwin
+// +build amd64 arm64
+
+package wasmer
+
+// #cgo linux LDFLAGS: -ldl
+// #define _GNU_SOURCE
+// #include <dlfcn.h>
+// #include "./wasmer.h"
+//
+// // The path of the shared library defining the Wasmer C API.
+// static const char *wasmer_library_path() {
+//     Dl_info info;
+//
+//     if (dladdr((void *) wasmer_compile, &info) == 0) {
+//         return NULL;
+//     }
+//
+//     return info.dli_fname;
+// }
+import "C"
+
+// libraryPath returns the path of the Wasmer shared library, as
+// resolved by the dynamic loader.
+func libraryPath() (string, error) {
+	var path = C.wasmer_library_path()
+
+	if path == nil {
+		return "", NewLibraryError("Failed to locate the Wasmer library: the Wasmer C API is not loaded from a shared library")
+	}
+
+	return C.GoString(path), nil
+}
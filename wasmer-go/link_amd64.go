@@ -0,0 +1,11 @@
+// +build amd64,!wasmer_system
+
+package wasmer
+
+// The shared library shipped next to the sources: `libwasmer.so` on
+// Linux, `libwasmer.dylib` on macOS. The Linux library is built by
+// `make libwasmer`. Build with the `wasmer_system` tag to link another
+// one, see `link_system.go`.
+
+// #cgo LDFLAGS: -Wl,-rpath,${SRCDIR} -L${SRCDIR} -lwasmer
+import "C"
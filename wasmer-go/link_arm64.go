@@ -0,0 +1,10 @@
+// +build arm64,!wasmer_system
+
+package wasmer
+
+// The shared library shipped next to the sources: `libwasmer-arm.so`
+// on Linux, built by `make libwasmer`. Build with the `wasmer_system`
+// tag to link another one, see `link_system.go`.
+
+// #cgo LDFLAGS: -Wl,-rpath,${SRCDIR} -L${SRCDIR} -lwasmer-arm
+import "C"
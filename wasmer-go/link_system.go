@@ -0,0 +1,17 @@
+// +build wasmer_system
+
+package wasmer
+
+// With the `wasmer_system` build tag, `libwasmer` is looked up by the
+// linker and the dynamic loader like any system library, rather than
+// next to the sources. A library installed elsewhere is located
+// through the cgo environment, e.g.:
+//
+//     CGO_LDFLAGS="-L/opt/wasmer/lib -Wl,-rpath,/opt/wasmer/lib" \
+//         go build -tags wasmer_system ./...
+//
+// or with `LD_LIBRARY_PATH` at run time. `CheckLibrary` reports the
+// library which has been loaded and whether its version is supported.
+
+// #cgo LDFLAGS: -lwasmer
+import "C"
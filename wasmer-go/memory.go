@@ -3,27 +3,10 @@ package wasmer
 import (
 	"fmt"
 	"reflect"
+	"runtime"
 	"unsafe"
 )
 
-// MemoryError represents any kind of errors related to a WebAssembly memory. It
-// is returned by `Memory` functions only.
-type MemoryError struct {
-	// Error message.
-	message string
-}
-
-// NewMemoryError constructs a new `MemoryError`.
-func NewMemoryError(message string) *MemoryError {
-	return &MemoryError{message}
-}
-
-// `MemoryError` is an actual error. The `Error` function returns
-// the error message.
-func (error *MemoryError) Error() string {
-	return error.message
-}
-
 // Memory represents a WebAssembly memory. To read and write _data,
 // please see the `Data` function. The memory can be owned or
 // borrowed. It is only possible to create an owned memory from the
@@ -41,6 +24,9 @@ func NewMemory(min, max uint32) (*Memory, error) {
 	var memory Memory
 
 	memory.owned = true
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	newResult := cWasmerMemoryNew(&memory.memory, cUint32T(min), cUint32T(max))
 
 	if newResult != cWasmerOk {
@@ -103,6 +89,9 @@ func (memory *Memory) Grow(numberOfPages uint32) error {
 		return nil
 	}
 
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	var growResult = cWasmerMemoryGrow(memory.memory, cUint32T(numberOfPages))
 
 	if growResult != cWasmerOk {
@@ -0,0 +1,36 @@
+package wasmer
+
+import (
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go/wasmertypes"
+)
+
+// MemoryError represents any kind of errors related to a WebAssembly
+// memory, see `wasmertypes.MemoryError`.
+type MemoryError = wasmertypes.MemoryError
+
+// NewMemoryError constructs a new `MemoryError`.
+func NewMemoryError(message string) *MemoryError {
+	return wasmertypes.NewMemoryError(message)
+}
+
+// MemoryResolver resolves the bytes of a WebAssembly memory, see
+// `wasmertypes.MemoryResolver`.
+type MemoryResolver = wasmertypes.MemoryResolver
+
+// MemoryView provides bounds-checked typed accesses to a WebAssembly
+// memory, see `wasmertypes.MemoryView`.
+type MemoryView = wasmertypes.MemoryView
+
+// IoVec represents a WASI `iovec`, see `wasmertypes.IoVec`.
+type IoVec = wasmertypes.IoVec
+
+// NewMemoryView returns a `MemoryView` over the memory resolved by
+// `resolver`.
+func NewMemoryView(resolver MemoryResolver) *MemoryView {
+	return wasmertypes.NewMemoryView(resolver)
+}
+
+// View returns a `MemoryView` over the memory.
+func (memory *Memory) View() *MemoryView {
+	return NewMemoryView(memory)
+}
@@ -3,7 +3,11 @@ package wasmer
 import (
 	"fmt"
 	"io/ioutil"
+	"runtime"
+	"strings"
 	"unsafe"
+
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go/wasmertypes"
 )
 
 // ReadBytes reads a `.wasm` file and returns its content as an array of bytes.
@@ -14,9 +18,87 @@ func ReadBytes(filename string) ([]byte, error) {
 // Validate validates a sequence of bytes that is supposed to represent a valid
 // WebAssembly module.
 func Validate(bytes []byte) bool {
+	if len(bytes) == 0 {
+		return false
+	}
+
 	return true == cWasmerValidate((*cUchar)(unsafe.Pointer(&bytes[0])), cUint(len(bytes)))
 }
 
+// ValidateWithError validates a sequence of bytes like `Validate`, and
+// tells why the module is invalid. It returns nil if the module is
+// valid, a `CompileError` otherwise.
+func ValidateWithError(bytes []byte) error {
+	if len(bytes) == 0 {
+		return newCompileError(CompileErrorKindEmpty, "The byte code is empty.")
+	}
+
+	if Validate(bytes) {
+		return nil
+	}
+
+	// `wasmer_validate` does not report why the module is invalid,
+	// the compiler does.
+	var module *cWasmerModuleT
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if cWasmerCompile(&module, (*cUchar)(unsafe.Pointer(&bytes[0])), cUint(len(bytes))) == cWasmerOk {
+		cWasmerModuleDestroy(module)
+
+		return newCompileError(CompileErrorKindValidation, "(unknown details)")
+	}
+
+	var compileError = lastCompileError()
+	compileError.Kind = CompileErrorKindValidation
+
+	return compileError
+}
+
+// CompileErrorKind represents the reason why a WebAssembly module
+// can not be compiled, see `wasmertypes.CompileErrorKind`.
+type CompileErrorKind = wasmertypes.CompileErrorKind
+
+const (
+	// CompileErrorKindEmpty represents an empty byte code.
+	CompileErrorKindEmpty = wasmertypes.CompileErrorKindEmpty
+
+	// CompileErrorKindValidation represents a byte code which is
+	// not a valid WebAssembly module.
+	CompileErrorKindValidation = wasmertypes.CompileErrorKindValidation
+
+	// CompileErrorKindCompilation represents a valid module the
+	// compiler failed to compile.
+	CompileErrorKindCompilation = wasmertypes.CompileErrorKindCompilation
+)
+
+// CompileError represents an error returned by `ValidateWithError` or
+// `Compile`, see `wasmertypes.CompileError`.
+type CompileError = wasmertypes.CompileError
+
+// newCompileError constructs a new `CompileError`, reading the offset
+// from the message if any.
+func newCompileError(kind CompileErrorKind, message string) *CompileError {
+	return wasmertypes.NewCompileError(kind, message)
+}
+
+// lastCompileError constructs a `CompileError` from the last wasmer
+// error, the OS thread of the failing call must be locked.
+func lastCompileError() *CompileError {
+	var lastError, err = GetLastError()
+
+	if err != nil || lastError == "" {
+		return newCompileError(CompileErrorKindCompilation, "(unknown details)")
+	}
+
+	if strings.HasPrefix(lastError, "Validation error") {
+		return newCompileError(CompileErrorKindValidation, lastError)
+	}
+
+	return newCompileError(CompileErrorKindCompilation, lastError)
+}
+
 // ModuleError represents any kind of errors related to a WebAssembly
 // module.
 type ModuleError struct {
@@ -84,10 +166,18 @@ type Module struct {
 	Imports []ImportDescriptor
 }
 
-// Compile compiles a WebAssembly module from bytes.
+// Compile compiles a WebAssembly module from bytes. The error is a
+// `CompileError`.
 func Compile(bytes []byte) (Module, error) {
 	var module *cWasmerModuleT
 
+	if len(bytes) == 0 {
+		return Module{module: nil}, newCompileError(CompileErrorKindEmpty, "The byte code is empty.")
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	var compileResult = cWasmerCompile(
 		&module,
 		(*cUchar)(unsafe.Pointer(&bytes[0])),
@@ -97,7 +187,7 @@ func Compile(bytes []byte) (Module, error) {
 	var emptyModule = Module{module: nil}
 
 	if compileResult != cWasmerOk {
-		return emptyModule, NewModuleError("Failed to compile the module.")
+		return emptyModule, lastCompileError()
 	}
 
 	var exports = moduleExports(module)
@@ -167,6 +257,9 @@ func (module *Module) InstantiateWithImports(imports *Imports) (Instance, error)
 		func(wasmImportsCPointer *cWasmerImportT, numberOfImports int) (*cWasmerInstanceT, error) {
 			var instance *cWasmerInstanceT
 
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+
 			var instantiateResult = cWasmerModuleInstantiate(
 				module.module,
 				&instance,
@@ -198,6 +291,9 @@ func (module *Module) InstantiateWithImportObject(importObject *ImportObject) (I
 	var instance *cWasmerInstanceT
 	var emptyInstance = Instance{instance: nil, imports: nil, Exports: nil, Memory: nil}
 
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
 	var instantiateResult = cWasmerModuleImportInstantiate(&instance, module.module, importObject.inner)
 
 	if instantiateResult != cWasmerOk {
@@ -213,7 +309,8 @@ func (module *Module) InstantiateWithImportObject(importObject *ImportObject) (I
 		return emptyInstance, NewModuleError(errorMessage)
 	}
 
-	exports, memoryPointer, err := getExportsFromInstance(instance)
+	var handle = &instanceHandle{}
+	exports, functions, memoryPointer, err := getExportsFromInstance(instance, handle)
 
 	if err != nil {
 		return emptyInstance, err
@@ -225,7 +322,7 @@ func (module *Module) InstantiateWithImportObject(importObject *ImportObject) (I
 		return emptyInstance, NewModuleError(fmt.Sprintf("Could not get imports from ImportObject: %s", err))
 	}
 
-	return Instance{instance: instance, imports: imports, Exports: exports, Memory: memoryPointer}, nil
+	return Instance{instance: instance, imports: imports, Exports: exports, Functions: functions, Memory: memoryPointer, handle: handle}, nil
 }
 
 // Serialize serializes the current module into a sequence of
@@ -0,0 +1,17 @@
+package wasmer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateEmptyByteCode(t *testing.T) {
+	if Validate(nil) {
+		t.Error("expected an empty byte code to be invalid")
+	}
+
+	var compileError *CompileError
+	if err := ValidateWithError([]byte{}); !errors.As(err, &compileError) || compileError.Kind != CompileErrorKindEmpty {
+		t.Errorf("expected an empty byte code error, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package wasmer
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// TableError represents any kind of errors related to a WebAssembly
+// table. It is returned by `Table` functions only.
+type TableError struct {
+	// Error message.
+	message string
+}
+
+// NewTableError constructs a new `TableError`.
+func NewTableError(message string) *TableError {
+	return &TableError{message}
+}
+
+// `TableError` is an actual error. The `Error` function returns
+// the error message.
+func (error *TableError) Error() string {
+	return error.message
+}
+
+// Table represents a WebAssembly table of function references
+// created by the host, bound to an imported table with
+// `Imports.AppendTable`.
+type Table struct {
+	table *cWasmerTableT
+}
+
+// NewTable instantiates a new WebAssembly table of `min` elements,
+// growable up to `max` elements, or without limit if `max` is 0.
+func NewTable(min, max uint32) (*Table, error) {
+	var table Table
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	newResult := cWasmerTableNew(&table.table, cUint32T(min), cUint32T(max))
+
+	if newResult != cWasmerOk {
+		var lastError, err = GetLastError()
+		var errorMessage = "Failed to allocate the table:\n    %s"
+
+		if err != nil {
+			errorMessage = fmt.Sprintf(errorMessage, "(unknown details)")
+		} else {
+			errorMessage = fmt.Sprintf(errorMessage, lastError)
+		}
+
+		return nil, NewTableError(errorMessage)
+	}
+
+	return &table, nil
+}
+
+// Length returns the number of elements of the table.
+func (table *Table) Length() uint32 {
+	if nil == table.table {
+		return 0
+	}
+
+	return uint32(cWasmerTableLength(table.table))
+}
+
+// Grow the table by a number of elements.
+func (table *Table) Grow(delta uint32) error {
+	if nil == table.table {
+		return nil
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var growResult = cWasmerTableGrow(table.table, cUint32T(delta))
+
+	if growResult != cWasmerOk {
+		var lastError, err = GetLastError()
+		var errorMessage = "Failed to grow the table:\n    %s"
+
+		if err != nil {
+			errorMessage = fmt.Sprintf(errorMessage, "(unknown details)")
+		} else {
+			errorMessage = fmt.Sprintf(errorMessage, lastError)
+		}
+
+		return NewTableError(errorMessage)
+	}
+
+	return nil
+}
+
+// Close closes/frees the table. It must not be closed while an
+// instance importing it is alive.
+func (table *Table) Close() {
+	if table.table != nil {
+		cWasmerTableDestroy(table.table)
+		table.table = nil
+	}
+}
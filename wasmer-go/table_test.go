@@ -0,0 +1,24 @@
+package wasmer
+
+import (
+	"testing"
+)
+
+func TestClosedTable(t *testing.T) {
+	var table = &Table{}
+
+	if table.Length() != 0 {
+		t.Errorf("expected an empty closed table, got %d elements", table.Length())
+	}
+	if err := table.Grow(1); err != nil {
+		t.Errorf("expected growing a closed table to do nothing, got %v", err)
+	}
+	table.Close()
+
+	if _, err := NewImports().AppendTable("table", table); err == nil {
+		t.Error("expected an error when importing a closed table")
+	}
+	if _, err := NewImports().AppendTable("table", nil); err == nil {
+		t.Error("expected an error when importing a nil table")
+	}
+}
@@ -0,0 +1,65 @@
+package wasmer
+
+import (
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go/wasmertypes"
+)
+
+// TrapKind represents the reason why a WebAssembly instance trapped
+// while running an exported function, see `wasmertypes.TrapKind`.
+type TrapKind = wasmertypes.TrapKind
+
+const (
+	// TrapKindUnknown represents a trap whose reason is not
+	// recognized, e.g. a trap raised by an imported function with
+	// `Trap`.
+	TrapKindUnknown = wasmertypes.TrapKindUnknown
+
+	// TrapKindUnreachable represents an `unreachable` instruction
+	// executed, which is how most languages compile a panic.
+	TrapKindUnreachable = wasmertypes.TrapKindUnreachable
+
+	// TrapKindMemoryOutOfBounds represents a memory access out of
+	// the bounds of the memory.
+	TrapKindMemoryOutOfBounds = wasmertypes.TrapKindMemoryOutOfBounds
+
+	// TrapKindTableOutOfBounds represents a table access out of the
+	// bounds of the table.
+	TrapKindTableOutOfBounds = wasmertypes.TrapKindTableOutOfBounds
+
+	// TrapKindIndirectCall represents an indirect call to a null
+	// function or to a function of another signature.
+	TrapKindIndirectCall = wasmertypes.TrapKindIndirectCall
+
+	// TrapKindIntegerDivisionByZero represents an integer division
+	// or remainder by zero.
+	TrapKindIntegerDivisionByZero = wasmertypes.TrapKindIntegerDivisionByZero
+
+	// TrapKindIntegerOverflow represents an integer overflow, or a
+	// float not convertible to an integer.
+	TrapKindIntegerOverflow = wasmertypes.TrapKindIntegerOverflow
+
+	// TrapKindStackOverflow represents the exhaustion of the call
+	// stack.
+	TrapKindStackOverflow = wasmertypes.TrapKindStackOverflow
+
+	// TrapKindOutOfPoints represents the exhaustion of the points,
+	// i.e. the gas, given by `SetGasLimit`.
+	TrapKindOutOfPoints = wasmertypes.TrapKindOutOfPoints
+)
+
+// TrapError represents a trap of a WebAssembly instance while running
+// an exported function, see `wasmertypes.TrapError`.
+type TrapError = wasmertypes.TrapError
+
+// newTrapError constructs a new `TrapError` from the last wasmer
+// error. The last error is thread-local, the caller must lock its OS
+// thread before the failing call.
+func newTrapError(functionName string) *TrapError {
+	var lastError, err = GetLastError()
+
+	if err != nil {
+		return &TrapError{FunctionName: functionName, Kind: TrapKindUnknown}
+	}
+
+	return wasmertypes.ClassifyTrap(functionName, lastError)
+}
@@ -28,6 +28,24 @@ const (
 	TypeVoid
 )
 
+// String formats the type as its WebAssembly name.
+func (valueType ValueType) String() string {
+	switch valueType {
+	case TypeI32:
+		return "i32"
+	case TypeI64:
+		return "i64"
+	case TypeF32:
+		return "f32"
+	case TypeF64:
+		return "f64"
+	case TypeVoid:
+		return "void"
+	default:
+		return ""
+	}
+}
+
 // Value represents a WebAssembly value of a particular type.
 type Value struct {
 	// The WebAssembly value (as bits).
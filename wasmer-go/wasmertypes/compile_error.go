@@ -0,0 +1,78 @@
+package wasmertypes
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// CompileErrorKind represents the reason why a WebAssembly module
+// can not be compiled.
+type CompileErrorKind int
+
+const (
+	// CompileErrorKindEmpty represents an empty byte code.
+	CompileErrorKindEmpty CompileErrorKind = iota
+
+	// CompileErrorKindValidation represents a byte code which is
+	// not a valid WebAssembly module.
+	CompileErrorKindValidation
+
+	// CompileErrorKindCompilation represents a valid module the
+	// compiler failed to compile.
+	CompileErrorKindCompilation
+)
+
+// String formats the kind.
+func (kind CompileErrorKind) String() string {
+	switch kind {
+	case CompileErrorKindEmpty:
+		return "empty"
+	case CompileErrorKindValidation:
+		return "validation"
+	case CompileErrorKindCompilation:
+		return "compilation"
+	default:
+		return ""
+	}
+}
+
+// CompileError represents an error returned by `ValidateWithError` or
+// `Compile` of the binding, with the message of wasmer.
+type CompileError struct {
+	// The reason of the error.
+	Kind CompileErrorKind
+
+	// The message of wasmer.
+	Message string
+
+	// The offset in the byte code where the error is found, -1 if
+	// wasmer does not report it.
+	Offset int
+}
+
+var compileErrorOffset = regexp.MustCompile(`at offset (0x[0-9a-fA-F]+|[0-9]+)`)
+
+// NewCompileError constructs a new `CompileError`, reading the offset
+// from the message if any.
+func NewCompileError(kind CompileErrorKind, message string) *CompileError {
+	var compileError = CompileError{kind, message, -1}
+
+	if match := compileErrorOffset.FindStringSubmatch(message); match != nil {
+		if offset, err := strconv.ParseInt(match[1], 0, 64); err == nil {
+			compileError.Offset = int(offset)
+		}
+	}
+
+	return &compileError
+}
+
+// `CompileError` is an actual error. The `Error` function returns
+// the error message.
+func (error *CompileError) Error() string {
+	if error.Offset < 0 {
+		return fmt.Sprintf("Failed to compile the module (%s error):\n    %s", error.Kind, error.Message)
+	}
+
+	return fmt.Sprintf("Failed to compile the module (%s error at offset %d):\n    %s", error.Kind, error.Offset, error.Message)
+}
@@ -0,0 +1,17 @@
+package wasmertypes
+
+import (
+	"testing"
+)
+
+func TestCompileErrorOffset(t *testing.T) {
+	for message, offset := range map[string]int{
+		"Validation error: invalid local type at offset 0x1f": 31,
+		"Validation error: unexpected end at offset 42":       42,
+		"Codegen error: unsupported instruction":              -1,
+	} {
+		if compileError := NewCompileError(CompileErrorKindValidation, message); compileError.Offset != offset {
+			t.Errorf("%q expected offset %d, got %d", message, offset, compileError.Offset)
+		}
+	}
+}
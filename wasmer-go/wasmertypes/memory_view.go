@@ -0,0 +1,233 @@
+// Package wasmertypes holds the types of the wasmer binding which do
+// not depend on cgo: the memory view and the errors of the compilation
+// and of the calls. Engines other than the binding, e.g. test doubles,
+// build with them without the Wasmer library.
+package wasmertypes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// MemoryError represents any kind of errors related to a WebAssembly memory. It
+// is returned by `Memory` functions only.
+type MemoryError struct {
+	// Error message.
+	message string
+}
+
+// NewMemoryError constructs a new `MemoryError`.
+func NewMemoryError(message string) *MemoryError {
+	return &MemoryError{message}
+}
+
+// `MemoryError` is an actual error. The `Error` function returns
+// the error message.
+func (error *MemoryError) Error() string {
+	return error.message
+}
+
+// MemoryResolver resolves the bytes of a WebAssembly memory. The
+// `Memory` of the binding is a resolver reading the address and the
+// length of the memory on every call.
+type MemoryResolver interface {
+	Data() []byte
+}
+
+// MemoryView provides bounds-checked typed accesses to a WebAssembly
+// memory. Integers are little-endian, as defined by WebAssembly.
+//
+// A view never keeps the slice returned by its resolver: the memory
+// is resolved again for every access, so that a view stays valid after
+// the memory has grown (and possibly moved), e.g. by a call to the
+// instance.
+type MemoryView struct {
+	memory MemoryResolver
+}
+
+// IoVec represents a WASI `iovec`: a buffer in the memory, 8 bytes in
+// the memory (a 32-bit pointer followed by a 32-bit length).
+type IoVec struct {
+	// Offset of the buffer in the memory.
+	Offset uint32
+
+	// Length of the buffer.
+	Length uint32
+}
+
+// ioVecSize is the size of an `IoVec` in the memory.
+const ioVecSize = 8
+
+// NewMemoryView returns a `MemoryView` over the memory resolved by
+// `resolver`.
+func NewMemoryView(resolver MemoryResolver) *MemoryView {
+	return &MemoryView{resolver}
+}
+
+// Length returns the current length of the memory (in bytes).
+func (view *MemoryView) Length() uint32 {
+	return uint32(len(view.memory.Data()))
+}
+
+// Data resolves the current bytes of the memory. The slice must not
+// be kept once the memory may grow, e.g. across a call to the instance.
+func (view *MemoryView) Data() []byte {
+	return view.memory.Data()
+}
+
+// slice returns the `length` bytes of the memory at `offset`, or a
+// `MemoryError` if they are out of the bounds of the memory. The slice
+// must not be kept after the access.
+func (view *MemoryView) slice(offset uint32, length uint32) ([]byte, error) {
+	var data = view.memory.Data()
+
+	if uint64(offset)+uint64(length) > uint64(len(data)) {
+		return nil, NewMemoryError(
+			fmt.Sprintf(
+				"Memory access out of bounds: %d bytes at offset %d, the memory length is %d",
+				length,
+				offset,
+				len(data),
+			),
+		)
+	}
+
+	return data[offset : offset+length], nil
+}
+
+// ReadBytes copies `length` bytes of the memory at `offset`.
+func (view *MemoryView) ReadBytes(offset uint32, length uint32) ([]byte, error) {
+	var data, err = view.slice(offset, length)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var result = make([]byte, length)
+	copy(result, data)
+
+	return result, nil
+}
+
+// WriteBytes copies `value` into the memory at `offset`. Nothing is
+// written if `value` does not fit in the memory.
+func (view *MemoryView) WriteBytes(offset uint32, value []byte) error {
+	if uint64(len(value)) > uint64(^uint32(0)) {
+		return NewMemoryError(fmt.Sprintf("Cannot write %d bytes in a 32-bit memory", len(value)))
+	}
+
+	var data, err = view.slice(offset, uint32(len(value)))
+
+	if err != nil {
+		return err
+	}
+
+	copy(data, value)
+
+	return nil
+}
+
+// ReadU32 reads the 32-bit integer at `offset`.
+func (view *MemoryView) ReadU32(offset uint32) (uint32, error) {
+	var data, err = view.slice(offset, 4)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint32(data), nil
+}
+
+// ReadU64 reads the 64-bit integer at `offset`.
+func (view *MemoryView) ReadU64(offset uint32) (uint64, error) {
+	var data, err = view.slice(offset, 8)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint64(data), nil
+}
+
+// WriteU32 writes the 32-bit integer `value` at `offset`.
+func (view *MemoryView) WriteU32(offset uint32, value uint32) error {
+	var data, err = view.slice(offset, 4)
+
+	if err != nil {
+		return err
+	}
+
+	binary.LittleEndian.PutUint32(data, value)
+
+	return nil
+}
+
+// ReadCString reads the NUL-terminated string at `offset`, without
+// its terminating NUL byte. It returns a `MemoryError` if the memory
+// ends before the NUL byte.
+func (view *MemoryView) ReadCString(offset uint32) (string, error) {
+	var data = view.memory.Data()
+
+	if uint64(offset) > uint64(len(data)) {
+		return "", NewMemoryError(
+			fmt.Sprintf("Memory access out of bounds: offset %d, the memory length is %d", offset, len(data)),
+		)
+	}
+
+	var end = bytes.IndexByte(data[offset:], 0)
+
+	if end < 0 {
+		return "", NewMemoryError(fmt.Sprintf("The string at offset %d is not NUL-terminated", offset))
+	}
+
+	return string(data[offset : int(offset)+end]), nil
+}
+
+// ReadIoVecs decodes the array of `count` `IoVec`s at `offset`, as
+// passed to the WASI `fd_read` and `fd_write` functions. The buffers
+// themselves are not checked, see `ReadIoVecBytes`.
+func (view *MemoryView) ReadIoVecs(offset uint32, count uint32) ([]IoVec, error) {
+	if uint64(count)*ioVecSize > uint64(^uint32(0)) {
+		return nil, NewMemoryError(fmt.Sprintf("Cannot read %d iovecs in a 32-bit memory", count))
+	}
+
+	var data, err = view.slice(offset, count*ioVecSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var ioVecs = make([]IoVec, count)
+
+	for nth := range ioVecs {
+		ioVecs[nth].Offset = binary.LittleEndian.Uint32(data[nth*ioVecSize:])
+		ioVecs[nth].Length = binary.LittleEndian.Uint32(data[nth*ioVecSize+4:])
+	}
+
+	return ioVecs, nil
+}
+
+// ReadIoVecBytes copies the concatenated buffers of the `count`
+// `IoVec`s at `offset`, i.e. the bytes written by a WASI `fd_write`.
+func (view *MemoryView) ReadIoVecBytes(offset uint32, count uint32) ([]byte, error) {
+	var ioVecs, err = view.ReadIoVecs(offset, count)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var result []byte
+
+	for _, ioVec := range ioVecs {
+		var data, err = view.slice(ioVec.Offset, ioVec.Length)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, data...)
+	}
+
+	return result, nil
+}
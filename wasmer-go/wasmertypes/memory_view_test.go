@@ -0,0 +1,110 @@
+package wasmertypes
+
+import (
+	"bytes"
+	"testing"
+)
+
+// sliceMemory a memory of the bytes of the slice, grown by appending
+type sliceMemory struct {
+	data []byte
+}
+
+func (memory *sliceMemory) Data() []byte {
+	return memory.data
+}
+
+func TestMemoryViewOutOfBounds(t *testing.T) {
+	var view = NewMemoryView(&sliceMemory{make([]byte, 16)})
+	const max = ^uint32(0)
+
+	// the accesses ending past the memory, or whose end overflows 32 bits
+	for name, access := range map[string]func() error{
+		"read after the end":         func() error { _, err := view.ReadBytes(16, 1); return err },
+		"read across the end":        func() error { _, err := view.ReadBytes(12, 5); return err },
+		"read of an overflowing end": func() error { _, err := view.ReadBytes(8, max); return err },
+		"read at the last offset":    func() error { _, err := view.ReadBytes(max, 2); return err },
+		"write across the end":       func() error { return view.WriteBytes(15, []byte{1, 2}) },
+		"write at the last offset":   func() error { return view.WriteBytes(max, []byte{1}) },
+		"u32 across the end":         func() error { _, err := view.ReadU32(13); return err },
+		"u32 at the last offset":     func() error { _, err := view.ReadU32(max - 1); return err },
+		"u64 across the end":         func() error { _, err := view.ReadU64(9); return err },
+		"u32 write across the end":   func() error { return view.WriteU32(14, 1) },
+		"string after the end":       func() error { _, err := view.ReadCString(17); return err },
+		"string without nul":         func() error { _, err := NewMemoryView(&sliceMemory{[]byte("abc")}).ReadCString(1); return err },
+		"iovecs across the end":      func() error { _, err := view.ReadIoVecs(8, 2); return err },
+		"iovecs of an overflowing size": func() error {
+			_, err := view.ReadIoVecs(0, max/4)
+			return err
+		},
+	} {
+		if err := access(); err == nil {
+			t.Errorf("%s: expected a memory error", name)
+		} else if _, ok := err.(*MemoryError); !ok {
+			t.Errorf("%s: expected a memory error, got %T", name, err)
+		}
+	}
+
+	if data, _ := view.ReadBytes(0, 16); !bytes.Equal(data, make([]byte, 16)) {
+		t.Errorf("expected the failed writes to write nothing, got %v", data)
+	}
+}
+
+func TestMemoryViewAccesses(t *testing.T) {
+	var memory = &sliceMemory{make([]byte, 32)}
+	var view = NewMemoryView(memory)
+
+	if err := view.WriteBytes(0, []byte("hi\x00")); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := view.ReadCString(0); err != nil || value != "hi" {
+		t.Errorf("expected the string, got %q, %v", value, err)
+	}
+	// empty accesses at the end of the memory are in bounds
+	if value, err := view.ReadBytes(32, 0); err != nil || len(value) != 0 {
+		t.Errorf("expected an empty read, got %v, %v", value, err)
+	}
+
+	// iovecs of "hi" and "!" at 8
+	if err := view.WriteU32(8, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := view.WriteU32(12, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := view.WriteU32(16, 24); err != nil {
+		t.Fatal(err)
+	}
+	if err := view.WriteU32(20, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := view.WriteBytes(24, []byte("!")); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := view.ReadIoVecBytes(8, 2); err != nil || string(value) != "hi!" {
+		t.Errorf("expected the iovec bytes, got %q, %v", value, err)
+	}
+	if value, err := view.ReadU64(8); err != nil || value != 2<<32 {
+		t.Errorf("expected a little-endian u64, got %x, %v", value, err)
+	}
+
+	// an iovec buffer out of the memory
+	if err := view.WriteU32(20, 9); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := view.ReadIoVecBytes(8, 2); err == nil {
+		t.Error("expected an iovec buffer out of bounds to fail")
+	}
+
+	// the view sees the memory grown and moved after it is created
+	memory.data = append(append([]byte{}, memory.data...), make([]byte, 32)...)
+	if view.Length() != 64 {
+		t.Errorf("expected the grown length, got %d", view.Length())
+	}
+	if err := view.WriteU32(60, 7); err != nil {
+		t.Errorf("expected a write in the grown memory, got %v", err)
+	}
+	if value, err := view.ReadCString(1); err != nil || value != "i" {
+		t.Errorf("expected the string in the moved memory, got %q, %v", value, err)
+	}
+}
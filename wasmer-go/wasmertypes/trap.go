@@ -0,0 +1,140 @@
+package wasmertypes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TrapKind represents the reason why a WebAssembly instance trapped
+// while running an exported function.
+type TrapKind int
+
+const (
+	// TrapKindUnknown represents a trap whose reason is not
+	// recognized, e.g. a trap raised by an imported function with
+	// `Trap`.
+	TrapKindUnknown TrapKind = iota
+
+	// TrapKindUnreachable represents an `unreachable` instruction
+	// executed, which is how most languages compile a panic.
+	TrapKindUnreachable
+
+	// TrapKindMemoryOutOfBounds represents a memory access out of
+	// the bounds of the memory.
+	TrapKindMemoryOutOfBounds
+
+	// TrapKindTableOutOfBounds represents a table access out of the
+	// bounds of the table.
+	TrapKindTableOutOfBounds
+
+	// TrapKindIndirectCall represents an indirect call to a null
+	// function or to a function of another signature.
+	TrapKindIndirectCall
+
+	// TrapKindIntegerDivisionByZero represents an integer division
+	// or remainder by zero.
+	TrapKindIntegerDivisionByZero
+
+	// TrapKindIntegerOverflow represents an integer overflow, or a
+	// float not convertible to an integer.
+	TrapKindIntegerOverflow
+
+	// TrapKindStackOverflow represents the exhaustion of the call
+	// stack.
+	TrapKindStackOverflow
+
+	// TrapKindOutOfPoints represents the exhaustion of the points,
+	// i.e. the gas, given by `SetGasLimit`.
+	TrapKindOutOfPoints
+)
+
+// String formats the kind.
+func (kind TrapKind) String() string {
+	switch kind {
+	case TrapKindUnreachable:
+		return "unreachable"
+	case TrapKindMemoryOutOfBounds:
+		return "memory out of bounds"
+	case TrapKindTableOutOfBounds:
+		return "table out of bounds"
+	case TrapKindIndirectCall:
+		return "indirect call"
+	case TrapKindIntegerDivisionByZero:
+		return "integer division by zero"
+	case TrapKindIntegerOverflow:
+		return "integer overflow"
+	case TrapKindStackOverflow:
+		return "stack overflow"
+	case TrapKindOutOfPoints:
+		return "out of points"
+	default:
+		return "unknown"
+	}
+}
+
+// trapPatterns maps the messages of the wasmer backends to the trap
+// kinds, the first matching pattern wins.
+var trapPatterns = []struct {
+	pattern string
+	kind    TrapKind
+}{
+	{"out of points", TrapKindOutOfPoints},
+	{"out-of-points", TrapKindOutOfPoints},
+	{"execution limit exceeded", TrapKindOutOfPoints},
+	{"out of gas", TrapKindOutOfPoints},
+	{"unreachable", TrapKindUnreachable},
+	{"memory out-of-bounds", TrapKindMemoryOutOfBounds},
+	{"heap access out of bounds", TrapKindMemoryOutOfBounds},
+	{"memory access out of bounds", TrapKindMemoryOutOfBounds},
+	{"out of bounds memory access", TrapKindMemoryOutOfBounds},
+	{"table out-of-bounds", TrapKindTableOutOfBounds},
+	{"table access out of bounds", TrapKindTableOutOfBounds},
+	{"out of bounds table access", TrapKindTableOutOfBounds},
+	{"indirect call", TrapKindIndirectCall},
+	{"signature mismatch", TrapKindIndirectCall},
+	{"divide by zero", TrapKindIntegerDivisionByZero},
+	{"division by zero", TrapKindIntegerDivisionByZero},
+	{"integer overflow", TrapKindIntegerOverflow},
+	{"conversion to integer", TrapKindIntegerOverflow},
+	{"illegal arithmetic", TrapKindIntegerOverflow},
+	{"stack overflow", TrapKindStackOverflow},
+	{"call stack exhausted", TrapKindStackOverflow},
+}
+
+// TrapError represents a trap of a WebAssembly instance while running
+// an exported function. It is returned by the exported functions of
+// an `Instance` of the binding.
+type TrapError struct {
+	// The name of the exported function.
+	FunctionName string
+
+	// The reason of the trap.
+	Kind TrapKind
+
+	// The message of wasmer.
+	Message string
+}
+
+// ClassifyTrap constructs a new `TrapError` of the kind of the first
+// pattern found in the message of wasmer.
+func ClassifyTrap(functionName string, message string) *TrapError {
+	var lowerMessage = strings.ToLower(message)
+
+	for _, trapPattern := range trapPatterns {
+		if strings.Contains(lowerMessage, trapPattern.pattern) {
+			return &TrapError{functionName, trapPattern.kind, message}
+		}
+	}
+
+	return &TrapError{functionName, TrapKindUnknown, message}
+}
+
+// `TrapError` is an actual error. The `Error` function returns the
+// error message.
+func (error *TrapError) Error() string {
+	if error.Message == "" {
+		return fmt.Sprintf("Failed to call the `%s` exported function.", error.FunctionName)
+	}
+
+	return fmt.Sprintf("Failed to call the `%s` exported function. instance call error (%s): %s", error.FunctionName, error.Kind, error.Message)
+}
@@ -0,0 +1,42 @@
+package wasmertypes
+
+import (
+	"testing"
+)
+
+func TestClassifyTrap(t *testing.T) {
+	for message, kind := range map[string]TrapKind{
+		"RuntimeError: unreachable":                                       TrapKindUnreachable,
+		"call error: Out of points":                                       TrapKindOutOfPoints,
+		"RuntimeError: out of bounds memory access":                       TrapKindMemoryOutOfBounds,
+		"RuntimeError: out of bounds table access":                        TrapKindTableOutOfBounds,
+		"wasm trap: memory out-of-bounds access":                          TrapKindMemoryOutOfBounds,
+		"trap at 0x1f: heap access out of bounds":                         TrapKindMemoryOutOfBounds,
+		"wasm trap: table out-of-bounds access":                           TrapKindTableOutOfBounds,
+		"indirect call to null":                                           TrapKindIndirectCall,
+		"wasm trap: indirect call signature mismatch":                     TrapKindIndirectCall,
+		"RuntimeError: integer divide by zero":                            TrapKindIntegerDivisionByZero,
+		"wasm trap: integer overflow":                                     TrapKindIntegerOverflow,
+		"invalid conversion to integer":                                   TrapKindIntegerOverflow,
+		"wasm trap: call stack exhausted":                                 TrapKindStackOverflow,
+		"host function failed":                                            TrapKindUnknown,
+		"unreachable instruction executed after execution limit exceeded": TrapKindOutOfPoints,
+	} {
+		trap := ClassifyTrap("invoke", message)
+		if trap.Kind != kind {
+			t.Errorf("%q expected a trap of kind %s, got %s", message, kind, trap.Kind)
+		}
+		if trap.Message != message || trap.FunctionName != "invoke" {
+			t.Errorf("%q expected the message and function name kept, got %q, %q", message, trap.Message, trap.FunctionName)
+		}
+	}
+}
+
+func TestTrapErrorMessage(t *testing.T) {
+	if message := (&TrapError{"invoke", TrapKindUnknown, ""}).Error(); message != "Failed to call the `invoke` exported function." {
+		t.Errorf("unexpected message %q", message)
+	}
+	if message := ClassifyTrap("invoke", "unreachable").Error(); message != "Failed to call the `invoke` exported function. instance call error (unreachable): unreachable" {
+		t.Errorf("unexpected message %q", message)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmertest
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	wasmer "github.com/Ning-Qing/vm-wasmer/v2"
+)
+
+// AssertSuccess fail the test if the transaction failed
+func (r *Result) AssertSuccess(t testing.TB) {
+	t.Helper()
+	if r.Code != uint32(wasmer.ErrorCodeSuccess) {
+		t.Fatalf("expected the transaction to succeed, got code %d: %s", r.Code, r.Message)
+	}
+}
+
+// AssertError fail the test unless the transaction failed with the error code
+func (r *Result) AssertError(t testing.TB, code wasmer.ErrorCode) {
+	t.Helper()
+	if r.Code != uint32(code) {
+		t.Fatalf("expected the transaction to fail with code %d, got code %d: %s", code, r.Code, r.Message)
+	}
+}
+
+// AssertResult fail the test unless the contract returned the result
+func (r *Result) AssertResult(t testing.TB, expected []byte) {
+	t.Helper()
+	if !bytes.Equal(r.Result, expected) {
+		t.Fatalf("expected the result %q, got %q", expected, r.Result)
+	}
+}
+
+// AssertWrites fail the test unless the transaction changed the state exactly by the writes, in any order
+func (r *Result) AssertWrites(t testing.TB, expected ...StateWrite) {
+	t.Helper()
+	if got, want := sortedWrites(r.Writes), sortedWrites(expected); got != want {
+		t.Fatalf("expected the state changes\n%s\ngot\n%s", want, got)
+	}
+}
+
+// AssertEvent fail the test unless the transaction emitted an event of the topic with the data
+func (r *Result) AssertEvent(t testing.TB, topic string, data ...string) {
+	t.Helper()
+	var emitted []string
+	for _, event := range r.ContractEvent {
+		if event.Topic == topic && fmt.Sprint(event.EventData) == fmt.Sprint(data) {
+			return
+		}
+		emitted = append(emitted, fmt.Sprintf("%s %v", event.Topic, event.EventData))
+	}
+	t.Fatalf("expected the event %s %v, emitted\n%s", topic, data, strings.Join(emitted, "\n"))
+}
+
+// AssertNoEvent fail the test if the transaction emitted an event
+func (r *Result) AssertNoEvent(t testing.TB) {
+	t.Helper()
+	if len(r.ContractEvent) > 0 {
+		t.Fatalf("expected no event, got %d, the first of topic %s", len(r.ContractEvent), r.ContractEvent[0].Topic)
+	}
+}
+
+// AssertGasAtMost fail the test if the transaction used more gas
+func (r *Result) AssertGasAtMost(t testing.TB, gas uint64) {
+	t.Helper()
+	if r.GasUsed > gas {
+		t.Fatalf("expected at most %d gas, used %d", gas, r.GasUsed)
+	}
+}
+
+// AssertState fail the test unless the chain state of the contract holds the value, nil for an absent key
+func (c *Chain) AssertState(t testing.TB, contractName, key string, expected []byte) {
+	t.Helper()
+	if value := c.State(contractName, key); !bytes.Equal(value, expected) {
+		t.Fatalf("expected %s/%s=%q, got %q", contractName, key, expected, value)
+	}
+}
+
+func sortedWrites(writes []StateWrite) string {
+	lines := make([]string, 0, len(writes))
+	for _, write := range writes {
+		lines = append(lines, write.String())
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,254 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package wasmertest runs wasmer contracts on an in-memory chain, for the unit tests of contract developers:
+//
+//	chain := wasmertest.NewChain("chain1", nil)
+//	defer chain.Close()
+//	if _, err := chain.DeployFile("counter", "1.0", "counter.wasm", nil); err != nil {
+//		t.Fatal(err)
+//	}
+//	result := chain.Invoke("counter", "increase", map[string][]byte{"key": []byte("a")})
+//	result.AssertSuccess(t)
+//	result.AssertWrites(t, wasmertest.StateWrite{Contract: "counter", Key: "a", Value: []byte("1")})
+package wasmertest
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"chainmaker.org/chainmaker/logger/v2"
+	pbac "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	wasmer "github.com/Ning-Qing/vm-wasmer/v2"
+)
+
+// Chain an in-memory chain running wasmer contracts, transactions are executed one at a time
+type Chain struct {
+	ID string
+	// the block height, proposer, creator and sender seen by the contracts
+	BlockHeight uint64
+	Proposer    *pbac.Member
+	Creator     *pbac.Member
+	Sender      *pbac.Member
+	// the store of the sql statements of the contracts, sql sys_calls fail if nil
+	Store protocol.BlockchainStore
+
+	manager   *wasmer.InstancesManager
+	log       *logger.CMLogger
+	state     map[stateKey][]byte
+	contracts map[string]*deployedContract
+	// the contract versions having a vm pool, failed deployments included
+	pools   map[string]*commonPb.Contract
+	txCount int
+}
+
+type deployedContract struct {
+	contract *commonPb.Contract
+	byteCode []byte
+}
+
+// Result the result of a transaction
+type Result struct {
+	*commonPb.ContractResult
+	// the changes of the state made by the transaction, in write order
+	Writes []StateWrite
+	// the sql statements recorded by the transaction
+	Records []Record
+	// the writes are applied to the chain state, false for failed transactions and queries
+	Committed bool
+}
+
+// NewChain return a chain with the runtime config, DefaultRuntimeConfig if nil
+func NewChain(chainId string, config *wasmer.RuntimeConfig) *Chain {
+	if config == nil {
+		config = wasmer.DefaultRuntimeConfig()
+	}
+	member := &pbac.Member{OrgId: "wasmertest", MemberInfo: []byte("wasmertest")}
+	return &Chain{
+		ID:          chainId,
+		BlockHeight: 1,
+		Proposer:    member,
+		Creator:     member,
+		Sender:      member,
+		manager:     wasmer.NewInstancesManagerWithConfig(chainId, config),
+		log:         logger.GetLoggerByChain(logger.MODULE_VM, chainId),
+		state:       make(map[stateKey][]byte),
+		contracts:   make(map[string]*deployedContract),
+		pools:       make(map[string]*commonPb.Contract),
+	}
+}
+
+// Close release the vm pools of the contracts
+func (c *Chain) Close() {
+	for _, contract := range c.pools {
+		c.manager.CloseAVmPool(contract)
+	}
+}
+
+// Manager the InstancesManager running the contracts, e.g. to add admission checks
+func (c *Chain) Manager() *wasmer.InstancesManager {
+	return c.manager
+}
+
+// DeployFile deploy the contract of a .wasm file, see Deploy
+func (c *Chain) DeployFile(name, version, path string, parameters map[string][]byte) (*Result, error) {
+	byteCode, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return c.Deploy(name, version, byteCode, parameters)
+}
+
+// Deploy install the contract by calling its init_contract method.
+// the contract is deployed only if the method succeeds, otherwise the error carries the result message
+func (c *Chain) Deploy(name, version string, byteCode []byte, parameters map[string][]byte) (*Result, error) {
+	if _, ok := c.contracts[name]; ok {
+		return nil, fmt.Errorf("contract %s is already deployed", name)
+	}
+	return c.install(name, version, byteCode, protocol.ContractInitMethod, parameters)
+}
+
+// Upgrade upgrade the deployed contract to the version by calling its upgrade method
+func (c *Chain) Upgrade(name, version string, byteCode []byte, parameters map[string][]byte) (*Result, error) {
+	if _, ok := c.contracts[name]; !ok {
+		return nil, fmt.Errorf("contract %s is not deployed", name)
+	}
+	return c.install(name, version, byteCode, protocol.ContractUpgradeMethod, parameters)
+}
+
+func (c *Chain) install(name, version string, byteCode []byte, method string,
+	parameters map[string][]byte) (*Result, error) {
+
+	contract := &commonPb.Contract{Name: name, Version: version, RuntimeType: commonPb.RuntimeType_WASMER}
+	result := c.execute(&deployedContract{contract: contract, byteCode: byteCode}, method, parameters,
+		commonPb.TxType_INVOKE_CONTRACT)
+	if !result.Committed {
+		return result, fmt.Errorf("%s %s failed, code %d, %s", name, method, result.Code, result.Message)
+	}
+	c.contracts[name] = &deployedContract{contract: contract, byteCode: byteCode}
+	return result, nil
+}
+
+// Invoke execute an invoke transaction calling the method of the deployed contract,
+// its writes are applied to the chain state if it succeeds
+func (c *Chain) Invoke(contractName, method string, parameters map[string][]byte) *Result {
+	return c.call(contractName, method, parameters, commonPb.TxType_INVOKE_CONTRACT)
+}
+
+// Query execute a query transaction calling the method of the deployed contract, its writes are discarded
+func (c *Chain) Query(contractName, method string, parameters map[string][]byte) *Result {
+	return c.call(contractName, method, parameters, commonPb.TxType_QUERY_CONTRACT)
+}
+
+// State the value of the key in the chain state of the contract, nil if absent
+func (c *Chain) State(contractName, key string) []byte {
+	return c.state[stateKey{contractName, key}]
+}
+
+// SetState write the chain state of the contract, e.g. to set up a test
+func (c *Chain) SetState(contractName, key string, value []byte) {
+	c.state[stateKey{contractName, key}] = value
+}
+
+func (c *Chain) call(contractName, method string, parameters map[string][]byte, txType commonPb.TxType) *Result {
+	deployed, ok := c.contracts[contractName]
+	if !ok {
+		return &Result{ContractResult: &commonPb.ContractResult{
+			Code:    uint32(wasmer.ErrorCodeInvalidParameter),
+			Message: fmt.Sprintf("contract %s is not deployed", contractName),
+		}}
+	}
+	return c.execute(deployed, method, parameters, txType)
+}
+
+// execute run the transaction and apply its writes if it succeeds
+func (c *Chain) execute(deployed *deployedContract, method string, parameters map[string][]byte,
+	txType commonPb.TxType) *Result {
+
+	txContext := c.newTxContext(deployed.contract.Name, method, parameters, txType)
+	contractResult, _ := c.run(txContext, deployed.contract, deployed.byteCode, method, parameters, 0)
+	return c.finish(txContext, contractResult)
+}
+
+func (c *Chain) newTxContext(contractName, method string, parameters map[string][]byte,
+	txType commonPb.TxType) *TxContext {
+
+	c.txCount++
+	keys := make([]string, 0, len(parameters))
+	for key := range parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]*commonPb.KeyValuePair, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, &commonPb.KeyValuePair{Key: key, Value: parameters[key]})
+	}
+	return newTxContext(c, &commonPb.Transaction{Payload: &commonPb.Payload{
+		ChainId:      c.ID,
+		TxType:       txType,
+		TxId:         fmt.Sprintf("%s-tx-%d", c.ID, c.txCount),
+		Timestamp:    time.Now().Unix(),
+		ContractName: contractName,
+		Method:       method,
+		Parameters:   pairs,
+	}})
+}
+
+// run invoke the method of the contract in the transaction, for the transaction itself or a cross contract call
+func (c *Chain) run(txContext *TxContext, contract *commonPb.Contract, byteCode []byte, method string,
+	parameters map[string][]byte, gasUsed uint64) (*commonPb.ContractResult, protocol.ExecOrderTxType) {
+
+	// the contract changes the parameters
+	copied := make(map[string][]byte, len(parameters))
+	for key, value := range parameters {
+		copied[key] = value
+	}
+	runtime, err := c.manager.NewRuntimeInstance(txContext, c.ID, method, "", contract, byteCode, c.log)
+	if err == nil && runtime == nil {
+		err = fmt.Errorf("no runtime for contract %s", contract.Name)
+	}
+	if err == nil {
+		c.pools[contract.Name+"_"+contract.Version] = contract
+	}
+	if err != nil {
+		code := wasmer.ErrorCodeBytecodeInvalid
+		var contractErr *wasmer.ContractError
+		if errors.As(err, &contractErr) {
+			code = contractErr.Code
+		}
+		return &commonPb.ContractResult{Code: uint32(code), Message: err.Error()}, protocol.ExecOrderTxTypeNormal
+	}
+	return runtime.Invoke(contract, method, byteCode, copied, txContext, gasUsed)
+}
+
+// finish apply the writes of a succeeded invoke transaction to the chain state
+func (c *Chain) finish(txContext *TxContext, contractResult *commonPb.ContractResult) *Result {
+	result := &Result{
+		ContractResult: contractResult,
+		Writes:         txContext.diff(),
+		Records:        txContext.records,
+	}
+	if contractResult.Code != 0 || txContext.tx.Payload.TxType == commonPb.TxType_QUERY_CONTRACT {
+		return result
+	}
+	for _, write := range result.Writes {
+		k := stateKey{write.Contract, write.Key}
+		if write.Value == nil {
+			delete(c.state, k)
+		} else {
+			c.state[k] = write.Value
+		}
+	}
+	result.Committed = true
+	c.BlockHeight++
+	return result
+}
@@ -0,0 +1,276 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmertest
+
+import (
+	"fmt"
+	"testing"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	wasmer "github.com/Ning-Qing/vm-wasmer/v2"
+	"github.com/Ning-Qing/vm-wasmer/v2/wasmer-go/wasmertypes"
+)
+
+// funcEngine wasmer.Engine running contracts made of go functions, see funcByteCode
+type funcEngine map[string]map[string]func(instance *funcInstance) error
+
+// funcByteCode an empty wasm module with a custom section named by the contract, for the admission checks
+func funcByteCode(name string) []byte {
+	byteCode := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x00, byte(len(name) + 1), byte(len(name))}
+	return append(byteCode, name...)
+}
+
+func (e funcEngine) Validate(byteCode []byte) error {
+	if _, ok := e[funcName(byteCode)]; !ok {
+		return fmt.Errorf("unknown contract %q", byteCode)
+	}
+	return nil
+}
+
+func (e funcEngine) Compile(byteCode []byte) (wasmer.ModuleHandle, error) {
+	return funcModule(e[funcName(byteCode)]), nil
+}
+
+func funcName(byteCode []byte) string {
+	if len(byteCode) < 11 {
+		return ""
+	}
+	return string(byteCode[11:])
+}
+
+type funcModule map[string]func(instance *funcInstance) error
+
+func (m funcModule) Instantiate() (wasmer.InstanceHandle, error) {
+	return &funcInstance{exports: m, memory: make([]byte, 1024)}, nil
+}
+
+func (m funcModule) Close() {}
+
+type funcInstance struct {
+	exports map[string]func(instance *funcInstance) error
+	memory  []byte
+	gasUsed uint64
+}
+
+func (i *funcInstance) HasExport(name string) bool {
+	_, ok := i.exports[name]
+	return ok || name == protocol.ContractRuntimeTypeMethod || name == protocol.ContractAllocateMethod ||
+		name == wasmer.ContractAbiVersionMethod
+}
+
+func (i *funcInstance) Call(name string, args ...int32) (int32, error) {
+	switch name {
+	case protocol.ContractRuntimeTypeMethod:
+		return int32(commonPb.RuntimeType_WASMER), nil
+	case wasmer.ContractAbiVersionMethod:
+		// the contracts are of a contract sdk saving the error codes
+		return int32(wasmer.AbiVersion2), nil
+	case protocol.ContractAllocateMethod, protocol.ContractDeallocateMethod:
+		return 0, nil
+	}
+	export, ok := i.exports[name]
+	if !ok {
+		return 0, fmt.Errorf("method [%s] not export", name)
+	}
+	return 0, export(i)
+}
+
+func (i *funcInstance) Data() []byte                    { return i.memory }
+func (i *funcInstance) Memory() *wasmertypes.MemoryView { return wasmertypes.NewMemoryView(i) }
+func (i *funcInstance) GetGasUsed() uint64              { return i.gasUsed }
+func (i *funcInstance) SetGasUsed(gas uint64)           { i.gasUsed = gas }
+func (i *funcInstance) SetGasLimit(gas uint64)          {}
+func (i *funcInstance) SetContextData(ctxPtr int32)     {}
+func (i *funcInstance) Close()                          {}
+
+func noop(*funcInstance) error { return nil }
+
+func newFuncChain(t *testing.T, engine funcEngine) *Chain {
+	config := wasmer.DefaultRuntimeConfig()
+	config.Engine = engine
+	// the modules export nothing, the functions are go
+	config.Admission = nil
+	chain := NewChain("chain1", config)
+	t.Cleanup(chain.Close)
+	return chain
+}
+
+func TestStateWritesAreCommittedOnSuccess(t *testing.T) {
+	var txContext *TxContext
+	chain := newFuncChain(t, funcEngine{
+		"counter": {
+			protocol.ContractInitMethod: noop,
+			"increase": func(instance *funcInstance) error {
+				instance.gasUsed += 100
+				if err := txContext.Put("counter", []byte("a"), []byte("1")); err != nil {
+					return err
+				}
+				return txContext.Del("counter", []byte("b"))
+			},
+			"fail": func(*funcInstance) error {
+				_ = txContext.Put("counter", []byte("a"), []byte("2"))
+				return &wasmertypes.TrapError{Kind: wasmertypes.TrapKindUnreachable, Message: "unreachable"}
+			},
+		},
+	})
+	if _, err := chain.Deploy("counter", "1.0", funcByteCode("counter"), nil); err != nil {
+		t.Fatal(err)
+	}
+	chain.SetState("counter", "b", []byte("0"))
+
+	txContext = chain.newTxContext("counter", "increase", nil, commonPb.TxType_INVOKE_CONTRACT)
+	result, _ := chain.run(txContext, chain.contracts["counter"].contract, funcByteCode("counter"), "increase", nil, 0)
+	invoked := chain.finish(txContext, result)
+	invoked.AssertSuccess(t)
+	invoked.AssertGasAtMost(t, 100)
+	invoked.AssertWrites(t, StateWrite{Contract: "counter", Key: "a", Value: []byte("1")},
+		StateWrite{Contract: "counter", Key: "b"})
+	chain.AssertState(t, "counter", "a", []byte("1"))
+	chain.AssertState(t, "counter", "b", nil)
+
+	txContext = chain.newTxContext("counter", "fail", nil, commonPb.TxType_INVOKE_CONTRACT)
+	result, _ = chain.run(txContext, chain.contracts["counter"].contract, funcByteCode("counter"), "fail", nil, 0)
+	failed := chain.finish(txContext, result)
+	failed.AssertError(t, wasmer.ErrorCodeTrapUnreachable)
+	if failed.Committed {
+		t.Error("expected the writes of a failed transaction to be discarded")
+	}
+	chain.AssertState(t, "counter", "a", []byte("1"))
+}
+
+func TestInvokeUndeployedContract(t *testing.T) {
+	chain := newFuncChain(t, funcEngine{})
+	chain.Invoke("absent", "increase", nil).AssertError(t, wasmer.ErrorCodeInvalidParameter)
+	if _, err := chain.Deploy("absent", "1.0", []byte("absent"), nil); err == nil {
+		t.Error("expected the deployment of an invalid byte code to fail")
+	}
+}
+
+func TestCallContractRoutesToDeployedContract(t *testing.T) {
+	var txContext *TxContext
+	var calleeDepth int
+	chain := newFuncChain(t, funcEngine{
+		"caller": {
+			protocol.ContractInitMethod: noop,
+			"call": func(*funcInstance) error {
+				result, _, status := txContext.CallContract(&commonPb.Contract{Name: "callee"}, "get", nil,
+					map[string][]byte{"key": []byte("a")}, 0, commonPb.TxType_INVOKE_CONTRACT)
+				if status != commonPb.TxStatusCode_SUCCESS {
+					return fmt.Errorf("cross contract call failed, %s", result.Message)
+				}
+				_, _, status = txContext.CallContract(&commonPb.Contract{Name: "absent"}, "get", nil,
+					nil, 0, commonPb.TxType_INVOKE_CONTRACT)
+				if status == commonPb.TxStatusCode_SUCCESS {
+					return fmt.Errorf("expected the call of an undeployed contract to fail")
+				}
+				return nil
+			},
+		},
+		"callee": {
+			protocol.ContractInitMethod: noop,
+			"get": func(*funcInstance) error {
+				calleeDepth = txContext.GetDepth()
+				return nil
+			},
+		},
+	})
+	for _, name := range []string{"caller", "callee"} {
+		if _, err := chain.Deploy(name, "1.0", funcByteCode(name), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	txContext = chain.newTxContext("caller", "call", nil, commonPb.TxType_INVOKE_CONTRACT)
+	result, _ := chain.run(txContext, chain.contracts["caller"].contract, funcByteCode("caller"), "call", nil, 0)
+	chain.finish(txContext, result).AssertSuccess(t)
+	if calleeDepth != 1 || txContext.GetDepth() != 0 {
+		t.Errorf("expected the callee at depth 1 and the caller back at depth 0, got %d and %d",
+			calleeDepth, txContext.GetDepth())
+	}
+}
+
+func TestSelectIteratesTheWritesInKeyOrder(t *testing.T) {
+	chain := NewChain("chain1", nil)
+	chain.SetState("counter", "a", []byte("1"))
+	chain.SetState("counter", "c", []byte("3"))
+	chain.SetState("counter", "d", []byte("4"))
+	chain.SetState("other", "b", []byte("0"))
+	txContext := chain.newTxContext("counter", "list", nil, commonPb.TxType_QUERY_CONTRACT)
+	_ = txContext.Put("counter", []byte("b"), []byte("2"))
+	_ = txContext.Del("counter", []byte("c"))
+
+	iterator, err := txContext.Select("counter", []byte("a"), []byte("d"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for iterator.Next() {
+		kv, err := iterator.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(kv.Key)+"="+string(kv.Value))
+	}
+	iterator.Release()
+	if fmt.Sprint(got) != "[a=1 b=2]" {
+		t.Errorf("expected [a=1 b=2], got %v", got)
+	}
+
+	rwSet := txContext.GetTxRWSet(false)
+	if len(rwSet.TxWrites) != 0 {
+		t.Errorf("expected no write in the read-write set of a failed vm, got %d", len(rwSet.TxWrites))
+	}
+	if rwSet = txContext.GetTxRWSet(true); len(rwSet.TxWrites) != 2 {
+		t.Errorf("expected the 2 writes in the read-write set, got %d", len(rwSet.TxWrites))
+	}
+}
+
+// recordingTB a testing.TB recording the failures instead of failing the test
+type recordingTB struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Fatalf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func TestAssertions(t *testing.T) {
+	result := &Result{ContractResult: &commonPb.ContractResult{
+		Result:  []byte("ok"),
+		GasUsed: 50,
+		ContractEvent: []*commonPb.ContractEvent{
+			{Topic: "transfer", EventData: []string{"alice", "bob"}},
+		},
+	}, Writes: []StateWrite{{Contract: "token", Key: "alice", Value: []byte("1")}, {Contract: "token", Key: "bob"}}}
+
+	passing := &recordingTB{}
+	result.AssertSuccess(passing)
+	result.AssertResult(passing, []byte("ok"))
+	result.AssertEvent(passing, "transfer", "alice", "bob")
+	result.AssertGasAtMost(passing, 50)
+	result.AssertWrites(passing, StateWrite{Contract: "token", Key: "bob"},
+		StateWrite{Contract: "token", Key: "alice", Value: []byte("1")})
+	if len(passing.failures) > 0 {
+		t.Errorf("unexpected failures %v", passing.failures)
+	}
+
+	failing := &recordingTB{}
+	result.AssertError(failing, wasmer.ErrorCodeContract)
+	result.AssertResult(failing, []byte("ko"))
+	result.AssertEvent(failing, "transfer", "bob")
+	result.AssertNoEvent(failing)
+	result.AssertGasAtMost(failing, 49)
+	result.AssertWrites(failing, StateWrite{Contract: "token", Key: "alice", Value: []byte("1")})
+	if len(failing.failures) != 6 {
+		t.Errorf("expected 6 failures, got %v", failing.failures)
+	}
+}
@@ -0,0 +1,340 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmertest
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	pbac "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/store"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+// maxCallDepth the max depth of cross contract calls, as the chain
+const maxCallDepth = 5
+
+// stateKey a key of the state of a contract
+type stateKey struct {
+	contract string
+	key      string
+}
+
+// StateWrite a change of the state made by a transaction
+type StateWrite struct {
+	Contract string
+	Key      string
+	// the new value, nil if the key is deleted
+	Value []byte
+}
+
+func (w StateWrite) String() string {
+	if w.Value == nil {
+		return fmt.Sprintf("%s/%s deleted", w.Contract, w.Key)
+	}
+	return fmt.Sprintf("%s/%s=%q", w.Contract, w.Key, w.Value)
+}
+
+// Record a sql statement recorded by a contract through PutRecord
+type Record struct {
+	Contract string
+	SQL      string
+	Type     protocol.SqlType
+}
+
+// TxContext an in-memory protocol.TxSimContext of one transaction of a Chain.
+// the writes are buffered until the transaction succeeds, the reads see them.
+// the methods of protocol.TxSimContext not implemented here panic
+type TxContext struct {
+	protocol.TxSimContext
+
+	chain *Chain
+	tx    *commonPb.Transaction
+	// the value read first from the chain state, for the read set
+	reads      map[stateKey][]byte
+	readOrder  []stateKey
+	writes     map[stateKey][]byte
+	writeOrder []stateKey
+	records    []Record
+
+	depth         int
+	runtimeTypes  []commonPb.RuntimeType
+	currentResult []byte
+	txResult      *commonPb.Result
+	txExecSeq     int
+	kvHandles     map[int32]protocol.StateIterator
+	sqlHandles    map[int32]protocol.SqlRows
+}
+
+func newTxContext(chain *Chain, tx *commonPb.Transaction) *TxContext {
+	return &TxContext{
+		chain:      chain,
+		tx:         tx,
+		reads:      make(map[stateKey][]byte),
+		writes:     make(map[stateKey][]byte),
+		kvHandles:  make(map[int32]protocol.StateIterator),
+		sqlHandles: make(map[int32]protocol.SqlRows),
+	}
+}
+
+func (c *TxContext) Get(contractName string, key []byte) ([]byte, error) {
+	k := stateKey{contractName, string(key)}
+	if value, ok := c.writes[k]; ok {
+		return value, nil
+	}
+	value := c.chain.state[k]
+	if _, ok := c.reads[k]; !ok {
+		c.reads[k] = value
+		c.readOrder = append(c.readOrder, k)
+	}
+	return value, nil
+}
+
+func (c *TxContext) Put(name string, key []byte, value []byte) error {
+	k := stateKey{name, string(key)}
+	if _, ok := c.writes[k]; !ok {
+		c.writeOrder = append(c.writeOrder, k)
+	}
+	c.writes[k] = append([]byte{}, value...)
+	return nil
+}
+
+func (c *TxContext) Del(name string, key []byte) error {
+	k := stateKey{name, string(key)}
+	if _, ok := c.writes[k]; !ok {
+		c.writeOrder = append(c.writeOrder, k)
+	}
+	c.writes[k] = nil
+	return nil
+}
+
+func (c *TxContext) PutRecord(contractName string, value []byte, sqlType protocol.SqlType) {
+	c.records = append(c.records, Record{Contract: contractName, SQL: string(value), Type: sqlType})
+}
+
+// Select iterate the keys of the contract in [startKey, limit), in key order, the writes of the transaction included
+func (c *TxContext) Select(name string, startKey []byte, limit []byte) (protocol.StateIterator, error) {
+	values := make(map[string][]byte)
+	for k, value := range c.chain.state {
+		if k.contract == name {
+			values[k.key] = value
+		}
+	}
+	for k, value := range c.writes {
+		if k.contract == name {
+			values[k.key] = value
+		}
+	}
+	iterator := &kvIterator{position: -1}
+	for key, value := range values {
+		if value == nil || bytes.Compare([]byte(key), startKey) < 0 || bytes.Compare([]byte(key), limit) >= 0 {
+			continue
+		}
+		iterator.kvs = append(iterator.kvs, &store.KV{ContractName: name, Key: []byte(key), Value: value})
+	}
+	sort.Slice(iterator.kvs, func(i, j int) bool {
+		return bytes.Compare(iterator.kvs[i].Key, iterator.kvs[j].Key) < 0
+	})
+	return iterator, nil
+}
+
+// CallContract route a cross contract call to a contract deployed on the chain
+func (c *TxContext) CallContract(contract *commonPb.Contract, method string, byteCode []byte,
+	parameter map[string][]byte, gasUsed uint64, refTxType commonPb.TxType) (
+	*commonPb.ContractResult, protocol.ExecOrderTxType, commonPb.TxStatusCode) {
+
+	if c.depth+1 > maxCallDepth {
+		return &commonPb.ContractResult{Code: 1, Message: fmt.Sprintf("CallContract too deep %d", c.depth+1)},
+			protocol.ExecOrderTxTypeNormal, commonPb.TxStatusCode_CONTRACT_FAIL
+	}
+	deployed, ok := c.chain.contracts[contract.Name]
+	if !ok {
+		return &commonPb.ContractResult{Code: 1, Message: fmt.Sprintf("contract %s is not deployed", contract.Name)},
+			protocol.ExecOrderTxTypeNormal, commonPb.TxStatusCode_CONTRACT_FAIL
+	}
+
+	c.depth++
+	result, specialTxType := c.chain.run(c, deployed.contract, deployed.byteCode, method, parameter, gasUsed)
+	c.depth--
+	c.currentResult = result.Result
+
+	status := commonPb.TxStatusCode_SUCCESS
+	if result.Code != 0 {
+		status = commonPb.TxStatusCode_CONTRACT_FAIL
+	}
+	return result, specialTxType, status
+}
+
+func (c *TxContext) GetCurrentResult() []byte {
+	return c.currentResult
+}
+
+func (c *TxContext) GetTx() *commonPb.Transaction {
+	return c.tx
+}
+
+func (c *TxContext) GetBlockHeight() uint64 {
+	return c.chain.BlockHeight
+}
+
+func (c *TxContext) GetBlockProposer() *pbac.Member {
+	return c.chain.Proposer
+}
+
+func (c *TxContext) GetTxResult() *commonPb.Result {
+	return c.txResult
+}
+
+func (c *TxContext) SetTxResult(result *commonPb.Result) {
+	c.txResult = result
+}
+
+// GetTxRWSet the values read from the chain state, and the writes if the vm succeeded
+func (c *TxContext) GetTxRWSet(runVmSuccess bool) *commonPb.TxRWSet {
+	rwSet := &commonPb.TxRWSet{TxId: c.tx.Payload.TxId}
+	for _, k := range c.readOrder {
+		rwSet.TxReads = append(rwSet.TxReads,
+			&commonPb.TxRead{ContractName: k.contract, Key: []byte(k.key), Value: c.reads[k]})
+	}
+	if !runVmSuccess {
+		return rwSet
+	}
+	for _, k := range c.writeOrder {
+		rwSet.TxWrites = append(rwSet.TxWrites,
+			&commonPb.TxWrite{ContractName: k.contract, Key: []byte(k.key), Value: c.writes[k]})
+	}
+	return rwSet
+}
+
+func (c *TxContext) GetCreator(namespace string) *pbac.Member {
+	return c.chain.Creator
+}
+
+func (c *TxContext) GetSender() *pbac.Member {
+	return c.chain.Sender
+}
+
+// GetBlockchainStore the store of the sql statements, nil unless set in Chain.Store
+func (c *TxContext) GetBlockchainStore() protocol.BlockchainStore {
+	return c.chain.Store
+}
+
+func (c *TxContext) GetTxExecSeq() int {
+	return c.txExecSeq
+}
+
+func (c *TxContext) SetTxExecSeq(seq int) {
+	c.txExecSeq = seq
+}
+
+func (c *TxContext) GetDepth() int {
+	return c.depth
+}
+
+func (c *TxContext) SetStateSqlHandle(index int32, rows protocol.SqlRows) {
+	c.sqlHandles[index] = rows
+}
+
+func (c *TxContext) GetStateSqlHandle(index int32) (protocol.SqlRows, bool) {
+	rows, ok := c.sqlHandles[index]
+	return rows, ok
+}
+
+func (c *TxContext) SetStateKvHandle(index int32, iterator protocol.StateIterator) {
+	c.kvHandles[index] = iterator
+}
+
+func (c *TxContext) GetStateKvHandle(index int32) (protocol.StateIterator, bool) {
+	iterator, ok := c.kvHandles[index]
+	return iterator, ok
+}
+
+func (c *TxContext) GetContractByName(name string) (*commonPb.Contract, error) {
+	deployed, ok := c.chain.contracts[name]
+	if !ok {
+		return nil, fmt.Errorf("contract %s is not deployed", name)
+	}
+	return deployed.contract, nil
+}
+
+func (c *TxContext) GetContractBytecode(name string) ([]byte, error) {
+	deployed, ok := c.chain.contracts[name]
+	if !ok {
+		return nil, fmt.Errorf("contract %s is not deployed", name)
+	}
+	return deployed.byteCode, nil
+}
+
+// GetCrossInfo the runtime types of the cross contract calls in progress, one bit per runtime type
+func (c *TxContext) GetCrossInfo() uint64 {
+	var crossInfo uint64
+	for _, runtimeType := range c.runtimeTypes {
+		crossInfo |= 1 << uint(runtimeType)
+	}
+	return crossInfo
+}
+
+func (c *TxContext) HasUsed(runtimeType commonPb.RuntimeType) bool {
+	for _, used := range c.runtimeTypes {
+		if used == runtimeType {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *TxContext) RecordRuntimeTypeIntoCrossInfo(runtimeType commonPb.RuntimeType) {
+	c.runtimeTypes = append(c.runtimeTypes, runtimeType)
+}
+
+func (c *TxContext) RemoveRuntimeTypeFromCrossInfo() {
+	if len(c.runtimeTypes) > 0 {
+		c.runtimeTypes = c.runtimeTypes[:len(c.runtimeTypes)-1]
+	}
+}
+
+// diff the writes changing the chain state, in write order
+func (c *TxContext) diff() []StateWrite {
+	var writes []StateWrite
+	for _, k := range c.writeOrder {
+		value := c.writes[k]
+		previous, existed := c.chain.state[k]
+		if (value == nil && !existed) || (value != nil && existed && bytes.Equal(value, previous)) {
+			continue
+		}
+		writes = append(writes, StateWrite{Contract: k.contract, Key: k.key, Value: value})
+	}
+	return writes
+}
+
+// kvIterator a StateIterator over a snapshot of the keys
+type kvIterator struct {
+	kvs      []*store.KV
+	position int
+}
+
+func (i *kvIterator) Next() bool {
+	if i.position < len(i.kvs) {
+		i.position++
+	}
+	return i.position < len(i.kvs)
+}
+
+func (i *kvIterator) Value() (*store.KV, error) {
+	if i.position < 0 || i.position >= len(i.kvs) {
+		return nil, fmt.Errorf("iterator has no value")
+	}
+	return i.kvs[i.position], nil
+}
+
+func (i *kvIterator) Release() {
+	i.kvs = nil
+	i.position = 0
+}
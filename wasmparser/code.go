@@ -0,0 +1,433 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmparser
+
+import (
+	"fmt"
+)
+
+// Feature a wasm feature whose result may differ across CPUs or runs, a consensus risk for contracts
+type Feature int
+
+const (
+	// f32/f64 instructions, NaN bit patterns are not deterministic
+	FeatureFloat Feature = iota
+	// 128-bit SIMD instructions, the relaxed and float lanes are not deterministic
+	FeatureSIMD
+	// atomic instructions and shared memories
+	FeatureThreads
+)
+
+func (f Feature) String() string {
+	switch f {
+	case FeatureFloat:
+		return "float"
+	case FeatureSIMD:
+		return "simd"
+	case FeatureThreads:
+		return "threads"
+	}
+	return fmt.Sprintf("feature_%d", int(f))
+}
+
+// instruction prefixes
+const (
+	prefixMisc    byte = 0xfc
+	prefixSIMD    byte = 0xfd
+	prefixThreads byte = 0xfe
+)
+
+// Finding a use of a non deterministic feature
+type Finding struct {
+	Feature Feature
+	// index of the function in the function index space (imports first), -1 outside of the code section
+	Function int
+	// offset of the instruction in the module
+	Offset int
+	// the instruction opcode, prefixed instructions are followed by their sub opcode
+	Opcode string
+}
+
+func (f Finding) String() string {
+	if f.Function < 0 {
+		return fmt.Sprintf("%s at offset %d", f.Feature, f.Offset)
+	}
+	return fmt.Sprintf("%s instruction %s in function %d at offset %d", f.Feature, f.Opcode, f.Function, f.Offset)
+}
+
+// ScanCode parse the module and report its non deterministic features
+func ScanCode(code []byte) ([]Finding, error) {
+	module, err := Parse(code)
+	if err != nil {
+		return nil, err
+	}
+	return module.ScanCode(code)
+}
+
+// ScanCode report the non deterministic features of the module: the instructions of every function body
+// and shared memories. code must be the byte code the module is parsed from
+func (m *Module) ScanCode(code []byte) ([]Finding, error) {
+	var findings []Finding
+	for _, section := range m.Sections {
+		if section.ID == SectionMemory || section.ID == SectionImport {
+			findings = append(findings, m.sharedMemories(section)...)
+		}
+		if section.ID != SectionCode {
+			continue
+		}
+		s := &scanner{
+			r:        newReader(code[:section.Offset+section.Size], section.Offset),
+			function: m.ImportedCount(KindFunction),
+		}
+		if err := s.scanBodies(); err != nil {
+			return nil, fmt.Errorf("code section: %s", err.Error())
+		}
+		findings = append(findings, s.findings...)
+	}
+	return findings, nil
+}
+
+// FunctionAt return the index of the function whose body contains the offset of the module, in the function
+// index space (imports first), false outside of the function bodies. code must be the byte code the module
+// is parsed from
+func (m *Module) FunctionAt(code []byte, offset int) (int, bool) {
+	section, ok := m.SectionAt(offset)
+	if !ok || section.ID != SectionCode {
+		return 0, false
+	}
+	r := newReader(code[:section.Offset+section.Size], section.Offset)
+	count, err := readCount(r)
+	if err != nil {
+		return 0, false
+	}
+	for i := 0; i < count; i++ {
+		size, err := r.readU32()
+		if err != nil {
+			return 0, false
+		}
+		start := r.pos
+		r.pos += int(size)
+		if offset >= start && offset < r.pos {
+			return m.ImportedCount(KindFunction) + i, true
+		}
+	}
+	return 0, false
+}
+
+// FunctionBody return the offset in the module of the first instruction of the function, after its locals,
+// false for an imported function. code must be the byte code the module is parsed from
+func (m *Module) FunctionBody(code []byte, function int) (int, bool) {
+	defined := function - m.ImportedCount(KindFunction)
+	if defined < 0 {
+		return 0, false
+	}
+	for _, section := range m.Sections {
+		if section.ID != SectionCode {
+			continue
+		}
+		r := newReader(code[:section.Offset+section.Size], section.Offset)
+		count, err := readCount(r)
+		if err != nil || defined >= count {
+			return 0, false
+		}
+		for i := 0; i < defined; i++ {
+			size, err := r.readU32()
+			if err != nil {
+				return 0, false
+			}
+			r.pos += int(size)
+		}
+		if _, err = r.readU32(); err != nil {
+			return 0, false
+		}
+		// skip the local declarations
+		locals, err := readCount(r)
+		if err != nil {
+			return 0, false
+		}
+		for i := 0; i < locals; i++ {
+			if _, err = r.readU32(); err != nil {
+				return 0, false
+			}
+			if _, err = r.readByte(); err != nil {
+				return 0, false
+			}
+		}
+		return r.pos, true
+	}
+	return 0, false
+}
+
+func (m *Module) sharedMemories(section Section) []Finding {
+	var findings []Finding
+	shared := func(limits Limits) {
+		if limits.Shared {
+			findings = append(findings, Finding{Feature: FeatureThreads, Function: -1, Offset: section.Offset})
+		}
+	}
+	if section.ID == SectionImport {
+		for _, imp := range m.Imports {
+			if imp.Kind == KindMemory {
+				shared(imp.Limits)
+			}
+		}
+		return findings
+	}
+	for _, limits := range m.Memories {
+		shared(limits)
+	}
+	return findings
+}
+
+// scanner walks the instructions of the code section
+type scanner struct {
+	r        *reader
+	function int
+	findings []Finding
+}
+
+func (s *scanner) scanBodies() error {
+	count, err := readCount(s.r)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		size, err := s.r.readU32()
+		if err != nil {
+			return err
+		}
+		end := s.r.pos + int(size)
+		if end > len(s.r.data) {
+			return s.r.errorf("function %d body exceeds the section", s.function)
+		}
+		body := &scanner{r: newReader(s.r.data[:end], s.r.pos), function: s.function}
+		if err = body.scanBody(); err != nil {
+			return fmt.Errorf("function %d: %s", s.function, err.Error())
+		}
+		s.findings = append(s.findings, body.findings...)
+		s.r.pos = end
+		s.function++
+	}
+	return nil
+}
+
+func (s *scanner) scanBody() error {
+	groups, err := readCount(s.r)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < groups; i++ {
+		if _, err = s.r.readU32(); err != nil {
+			return err
+		}
+		valueType, err := s.r.readByte()
+		if err != nil {
+			return err
+		}
+		if valueType == valueTypeV128 {
+			s.report(FeatureSIMD, s.r.pos-1, "v128 local")
+		}
+	}
+	for !s.r.eof() {
+		if err = s.scanInstruction(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *scanner) report(feature Feature, offset int, opcode string) {
+	s.findings = append(s.findings, Finding{Feature: feature, Function: s.function, Offset: offset, Opcode: opcode})
+}
+
+// value types
+const (
+	valueTypeI32  byte = 0x7f
+	valueTypeI64  byte = 0x7e
+	valueTypeF32  byte = 0x7d
+	valueTypeF64  byte = 0x7c
+	valueTypeV128 byte = 0x7b
+	refTypeFunc   byte = 0x70
+	refTypeExtern byte = 0x6f
+	blockTypeVoid byte = 0x40
+)
+
+// isFloatOpcode whether the single byte opcode operates on f32 or f64
+func isFloatOpcode(op byte) bool {
+	switch {
+	case op == 0x2a || op == 0x2b || op == 0x38 || op == 0x39: // f32/f64 load and store
+		return true
+	case op == 0x43 || op == 0x44: // f32/f64 const
+		return true
+	case op >= 0x5b && op <= 0x66: // f32/f64 comparisons
+		return true
+	case op >= 0x8b && op <= 0xa6: // f32/f64 arithmetic
+		return true
+	case op >= 0xa8 && op <= 0xab: // i32.trunc_f32/f64
+		return true
+	case op >= 0xae && op <= 0xbf: // i64.trunc, convert, demote, promote, reinterpret
+		return true
+	}
+	return false
+}
+
+func (s *scanner) scanInstruction() error {
+	offset := s.r.pos
+	op, err := s.r.readByte()
+	if err != nil {
+		return err
+	}
+	if isFloatOpcode(op) {
+		s.report(FeatureFloat, offset, fmt.Sprintf("0x%02x", op))
+	}
+	r := s.r
+	switch {
+	case op <= 0x01 || op == 0x05 || op == 0x0b || op == 0x0f || op == 0x1a || op == 0x1b || op == 0xd1:
+		// no immediate
+	case op >= 0x02 && op <= 0x04: // block, loop, if
+		return s.blockType()
+	case op == 0x0c || op == 0x0d || op == 0x10 || op == 0x12 || op == 0xd2 ||
+		(op >= 0x20 && op <= 0x26): // branch, call, variable, table.get/set, ref.func
+		_, err = r.readU32()
+	case op == 0x0e: // br_table
+		err = s.readU32s(1)
+	case op == 0x11 || op == 0x13: // call_indirect, return_call_indirect
+		err = s.readN(2)
+	case op == 0x1c: // typed select
+		count, err := readCount(r)
+		if err == nil {
+			_, err = r.readBytes(count)
+		}
+		return err
+	case op >= 0x28 && op <= 0x3e: // load and store
+		err = s.readN(2)
+	case op == 0x3f || op == 0x40 || op == 0xd0: // memory.size, memory.grow, ref.null
+		_, err = r.readByte()
+	case op == 0x41:
+		err = r.readSigned(32)
+	case op == 0x42:
+		err = r.readSigned(64)
+	case op == 0x43:
+		_, err = r.readBytes(4)
+	case op == 0x44:
+		_, err = r.readBytes(8)
+	case op >= 0x45 && op <= 0xc4: // numeric
+	case op == prefixMisc:
+		err = s.miscInstruction(offset)
+	case op == prefixSIMD:
+		err = s.simdInstruction(offset)
+	case op == prefixThreads:
+		err = s.threadsInstruction(offset)
+	default:
+		return r.errorf("unknown opcode 0x%02x", op)
+	}
+	return err
+}
+
+func (s *scanner) blockType() error {
+	b, err := s.r.readByte()
+	if err != nil {
+		return err
+	}
+	switch b {
+	case blockTypeVoid, valueTypeI32, valueTypeI64, valueTypeF32, valueTypeF64, refTypeFunc, refTypeExtern:
+		return nil
+	case valueTypeV128:
+		s.report(FeatureSIMD, s.r.pos-1, "v128 block")
+		return nil
+	}
+	// type index as a signed 33-bit integer
+	s.r.pos--
+	return s.r.readSigned(33)
+}
+
+// readN skip n u32 immediates
+func (s *scanner) readN(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := s.r.readU32(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readU32s skip a vector of u32 followed by extra u32 immediates
+func (s *scanner) readU32s(extra int) error {
+	count, err := readCount(s.r)
+	if err != nil {
+		return err
+	}
+	return s.readN(count + extra)
+}
+
+func (s *scanner) miscInstruction(offset int) error {
+	sub, err := s.r.readU32()
+	if err != nil {
+		return err
+	}
+	switch {
+	case sub <= 7: // trunc_sat from f32/f64
+		s.report(FeatureFloat, offset, fmt.Sprintf("0xfc %d", sub))
+		return nil
+	case sub == 8: // memory.init
+		if _, err = s.r.readU32(); err == nil {
+			_, err = s.r.readByte()
+		}
+	case sub == 9 || sub == 13 || (sub >= 15 && sub <= 17): // data.drop, elem.drop, table.grow/size/fill
+		_, err = s.r.readU32()
+	case sub == 10: // memory.copy
+		_, err = s.r.readBytes(2)
+	case sub == 11: // memory.fill
+		_, err = s.r.readByte()
+	case sub == 12 || sub == 14: // table.init, table.copy
+		err = s.readN(2)
+	default:
+		return s.r.errorf("unknown opcode 0xfc %d", sub)
+	}
+	return err
+}
+
+func (s *scanner) simdInstruction(offset int) error {
+	sub, err := s.r.readU32()
+	if err != nil {
+		return err
+	}
+	s.report(FeatureSIMD, offset, fmt.Sprintf("0xfd %d", sub))
+	switch {
+	case sub <= 0x0b || sub == 0x5c || sub == 0x5d: // load and store
+		err = s.readN(2)
+	case sub == 0x0c || sub == 0x0d: // v128.const, i8x16.shuffle
+		_, err = s.r.readBytes(16)
+	case sub >= 0x15 && sub <= 0x22: // extract and replace lane
+		_, err = s.r.readByte()
+	case sub >= 0x54 && sub <= 0x5b: // load and store lane
+		if err = s.readN(2); err == nil {
+			_, err = s.r.readByte()
+		}
+	case sub > 0x113:
+		return s.r.errorf("unknown opcode 0xfd %d", sub)
+	}
+	return err
+}
+
+func (s *scanner) threadsInstruction(offset int) error {
+	sub, err := s.r.readU32()
+	if err != nil {
+		return err
+	}
+	s.report(FeatureThreads, offset, fmt.Sprintf("0xfe %d", sub))
+	switch {
+	case sub == 0x03: // atomic.fence
+		_, err = s.r.readByte()
+	case sub <= 0x02 || (sub >= 0x10 && sub <= 0x4e): // notify, wait, atomic load, store and rmw
+		err = s.readN(2)
+	default:
+		return s.r.errorf("unknown opcode 0xfe %d", sub)
+	}
+	return err
+}
@@ -0,0 +1,110 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmparser
+
+import (
+	"testing"
+)
+
+// codeModule a module with one function type and the bodies given, each body is a complete function body
+func codeModule(bodies ...[]byte) []byte {
+	code := header()
+	code = append(code, section(SectionType, 0x01, 0x60, 0x00, 0x00)...)
+	functions := []byte{byte(len(bodies))}
+	content := []byte{byte(len(bodies))}
+	for _, body := range bodies {
+		functions = append(functions, 0x00)
+		content = append(content, byte(len(body)))
+		content = append(content, body...)
+	}
+	code = append(code, section(SectionFunction, functions...)...)
+	return append(code, section(SectionCode, content...)...)
+}
+
+func TestScanCode(t *testing.T) {
+	integer := []byte{
+		0x01, 0x01, 0x7f, // one i32 local
+		0x02, 0x40, // block
+		0x41, 0xff, 0xff, 0xff, 0xff, 0x07, // i32.const
+		0x21, 0x00, // local.set 0
+		0x42, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01, // i64.const
+		0x1a,                   // drop
+		0x0e, 0x01, 0x00, 0x00, // br_table
+		0x0b, // end
+		0x0b, // end
+	}
+	float := []byte{
+		0x00,
+		0x43, 0x00, 0x00, 0xc0, 0x7f, // f32.const NaN
+		0x1a,       // drop
+		0xfc, 0x00, // i32.trunc_sat_f32_s
+		0x0b,
+	}
+	simd := []byte{
+		0x00,
+		0xfd, 0x0c, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, // v128.const
+		0x1a,
+		0xfe, 0x03, 0x00, // atomic.fence
+		0x0b,
+	}
+
+	findings, err := ScanCode(codeModule(integer, float, simd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []struct {
+		feature  Feature
+		function int
+	}{
+		{FeatureFloat, 1},
+		{FeatureFloat, 1},
+		{FeatureSIMD, 2},
+		{FeatureThreads, 2},
+	}
+	if len(findings) != len(expect) {
+		t.Fatalf("expect %d findings, but got %v", len(expect), findings)
+	}
+	for i, e := range expect {
+		if findings[i].Feature != e.feature || findings[i].Function != e.function {
+			t.Errorf("finding %d expect %s in function %d, but got %s", i, e.feature, e.function, findings[i])
+		}
+	}
+}
+
+func TestScanCodeInvalid(t *testing.T) {
+	bodies := map[string][]byte{
+		"unknown opcode": {0x00, 0x06, 0x0b},
+		"truncated":      {0x00, 0x41},
+	}
+	for name, body := range bodies {
+		if _, err := ScanCode(codeModule(body)); err == nil {
+			t.Errorf("%s: expect error, but scanned", name)
+		}
+	}
+}
+
+func TestFunctionAt(t *testing.T) {
+	code := codeModule([]byte{0x00, 0x0b}, []byte{0x00, 0x01, 0x0b})
+	module, err := Parse(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the module ends with the second body, preceded by the first body and the body sizes
+	second := len(code) - 3
+	expect := map[int]int{second - 3: 0, second - 2: 0, second: 1, second + 2: 1}
+	for offset, function := range expect {
+		if got, ok := module.FunctionAt(code, offset); !ok || got != function {
+			t.Errorf("offset %d expect function %d, but got %d %v", offset, function, got, ok)
+		}
+	}
+	for _, offset := range []int{0, second - 1, len(code)} {
+		if got, ok := module.FunctionAt(code, offset); ok {
+			t.Errorf("offset %d expect no function, but got %d", offset, got)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmparser
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// custom sections of the DWARF debug info, the addresses are offsets in the content of the code section
+const (
+	debugInfoSection = ".debug_info"
+	debugLineSection = ".debug_line"
+)
+
+// LineEntry a row of the DWARF line table
+type LineEntry struct {
+	// offset in the content of the code section
+	Address uint64
+	File    string
+	Line    int
+	Column  int
+	// the row ends a sequence of instructions, it locates no instruction
+	EndSequence bool
+}
+
+func (e LineEntry) String() string {
+	if e.Column > 0 {
+		return fmt.Sprintf("%s:%d:%d", e.File, e.Line, e.Column)
+	}
+	return fmt.Sprintf("%s:%d", e.File, e.Line)
+}
+
+// Lines the DWARF line table of the module, sorted by address
+type Lines struct {
+	entries []LineEntry
+}
+
+// At return the source location of the instruction at the offset in the content of the code section,
+// false if the line table does not cover it
+func (l *Lines) At(address uint64) (LineEntry, bool) {
+	if l == nil {
+		return LineEntry{}, false
+	}
+	i := sort.Search(len(l.entries), func(i int) bool { return l.entries[i].Address > address })
+	if i == 0 || l.entries[i-1].EndSequence {
+		return LineEntry{}, false
+	}
+	return l.entries[i-1], true
+}
+
+// DWARF decode the DWARF debug info embedded in the custom sections of the module, nil if the module has none
+func (m *Module) DWARF() (*dwarf.Data, error) {
+	if _, ok := m.Custom(debugInfoSection); !ok {
+		return nil, nil
+	}
+	section := func(name string) []byte {
+		custom, _ := m.Custom(name)
+		return custom.Data
+	}
+	data, err := dwarf.New(section(".debug_abbrev"), section(".debug_aranges"), nil, section(debugInfoSection),
+		section(debugLineSection), nil, section(".debug_ranges"), section(".debug_str"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid dwarf sections, %s", err.Error())
+	}
+	// sections of DWARF 5
+	for _, name := range []string{".debug_addr", ".debug_line_str", ".debug_rnglists", ".debug_str_offsets"} {
+		if custom, ok := m.Custom(name); ok {
+			if err = data.AddSection(name, custom.Data); err != nil {
+				return nil, fmt.Errorf("invalid dwarf sections, %s", err.Error())
+			}
+		}
+	}
+	return data, nil
+}
+
+// Lines decode the DWARF line table of the module, nil if the module has no DWARF debug info
+func (m *Module) Lines() (*Lines, error) {
+	data, err := m.DWARF()
+	if data == nil || err != nil {
+		return nil, err
+	}
+	lines := &Lines{}
+	units := data.Reader()
+	for {
+		unit, err := units.Next()
+		if err != nil {
+			return nil, fmt.Errorf("invalid dwarf sections, %s", err.Error())
+		}
+		if unit == nil {
+			break
+		}
+		if unit.Tag != dwarf.TagCompileUnit {
+			units.SkipChildren()
+			continue
+		}
+		lineReader, err := data.LineReader(unit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dwarf sections, %s", err.Error())
+		}
+		units.SkipChildren()
+		if lineReader == nil {
+			continue
+		}
+		var entry dwarf.LineEntry
+		for {
+			if err = lineReader.Next(&entry); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("invalid dwarf line table, %s", err.Error())
+			}
+			file := ""
+			if entry.File != nil {
+				file = entry.File.Name
+			}
+			lines.entries = append(lines.entries, LineEntry{
+				Address:     entry.Address,
+				File:        file,
+				Line:        entry.Line,
+				Column:      entry.Column,
+				EndSequence: entry.EndSequence,
+			})
+		}
+	}
+	// an end of sequence sorts before a row starting the next sequence at the same address
+	sort.SliceStable(lines.entries, func(i, j int) bool {
+		if lines.entries[i].Address != lines.entries[j].Address {
+			return lines.entries[i].Address < lines.entries[j].Address
+		}
+		return lines.entries[i].EndSequence && !lines.entries[j].EndSequence
+	})
+	return lines, nil
+}
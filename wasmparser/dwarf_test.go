@@ -0,0 +1,77 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmparser
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+// debugModule the module of testdata/debug.wasm, generated by testdata/debug_wasm.go
+func debugModule(t *testing.T) ([]byte, *Module) {
+	code, err := ioutil.ReadFile("testdata/debug.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	module, err := Parse(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code, module
+}
+
+func TestLines(t *testing.T) {
+	_, module := debugModule(t)
+	lines, err := module.Lines()
+	if err != nil || lines == nil {
+		t.Fatalf("expect a line table, but got %v, %v", lines, err)
+	}
+
+	expect := map[uint64]string{3: "/src/lib.rs:3:5", 8: "/src/lib.rs:3:5", 9: "/src/lib.rs:8:9", 10: "/src/lib.rs:8:9"}
+	for address, location := range expect {
+		if line, ok := lines.At(address); !ok || line.String() != location {
+			t.Errorf("address %d expect %s, but got %s %v", address, location, line, ok)
+		}
+	}
+	// before the first row and from the end of the sequence
+	for _, address := range []uint64{0, 2, 11, 100} {
+		if line, ok := lines.At(address); ok {
+			t.Errorf("address %d expect no location, but got %s", address, line)
+		}
+	}
+	if _, ok := (*Lines)(nil).At(3); ok {
+		t.Error("expect no location without a line table")
+	}
+}
+
+func TestFunctionBody(t *testing.T) {
+	code, module := debugModule(t)
+	names, err := module.Names()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names.Function(1) != "allocate" || names.Function(2) != "invoke" {
+		t.Fatalf("unexpected names %+v", names)
+	}
+
+	// the first instructions after the locals, the nop of allocate and the unreachable of invoke
+	for function, opcode := range map[int]byte{1: 0x01, 2: 0x00} {
+		offset, ok := module.FunctionBody(code, function)
+		if !ok || code[offset] != opcode {
+			t.Errorf("function %d expect its first instruction, but got offset %d %v", function, offset, ok)
+		}
+		if got, ok := module.FunctionAt(code, offset); !ok || got != function {
+			t.Errorf("function %d expect its body at offset %d, but got %d %v", function, offset, got, ok)
+		}
+	}
+	for _, function := range []int{0, 3} {
+		if offset, ok := module.FunctionBody(code, function); ok {
+			t.Errorf("function %d expect no body, but got offset %d", function, offset)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package wasmparser decodes the sections of a wasm module in pure go, without compiling it or loading libwasmer,
+// for the admission checks of contract byte code, tooling and tests
+package wasmparser
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// section ids of the wasm binary format
+const (
+	SectionCustom    byte = 0
+	SectionType      byte = 1
+	SectionImport    byte = 2
+	SectionFunction  byte = 3
+	SectionTable     byte = 4
+	SectionMemory    byte = 5
+	SectionGlobal    byte = 6
+	SectionExport    byte = 7
+	SectionStart     byte = 8
+	SectionElement   byte = 9
+	SectionCode      byte = 10
+	SectionData      byte = 11
+	SectionDataCount byte = 12
+)
+
+var sectionNames = map[byte]string{
+	SectionCustom:    "custom",
+	SectionType:      "type",
+	SectionImport:    "import",
+	SectionFunction:  "function",
+	SectionTable:     "table",
+	SectionMemory:    "memory",
+	SectionGlobal:    "global",
+	SectionExport:    "export",
+	SectionStart:     "start",
+	SectionElement:   "element",
+	SectionCode:      "code",
+	SectionData:      "data",
+	SectionDataCount: "data count",
+}
+
+// SectionName return the name of the section id
+func SectionName(id byte) string {
+	if name, ok := sectionNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("section_%d", id)
+}
+
+// ExternalKind the kind of an import or an export
+type ExternalKind byte
+
+const (
+	KindFunction ExternalKind = 0
+	KindTable    ExternalKind = 1
+	KindMemory   ExternalKind = 2
+	KindGlobal   ExternalKind = 3
+)
+
+func (k ExternalKind) String() string {
+	switch k {
+	case KindFunction:
+		return "function"
+	case KindTable:
+		return "table"
+	case KindMemory:
+		return "memory"
+	case KindGlobal:
+		return "global"
+	}
+	return fmt.Sprintf("kind_%d", byte(k))
+}
+
+var magic = []byte{0x00, 0x61, 0x73, 0x6d}
+
+const version = 1
+
+// Limits the size limits of a memory (in 64KiB pages) or a table (in elements)
+type Limits struct {
+	Min    uint32
+	Max    uint32
+	HasMax bool
+	// a memory shared between threads
+	Shared bool
+}
+
+// Import an import of the module
+type Import struct {
+	Module string
+	Name   string
+	Kind   ExternalKind
+	// type index of an imported function
+	TypeIndex uint32
+	// limits of an imported memory or table
+	Limits Limits
+	// element type of an imported table
+	ElemType ValueType
+	// type of an imported global
+	Global GlobalType
+}
+
+// Export an export of the module
+type Export struct {
+	Name  string
+	Kind  ExternalKind
+	Index uint32
+}
+
+// Section the position of a section in the module
+type Section struct {
+	ID byte
+	// offset and size of the section content
+	Offset int
+	Size   int
+}
+
+// Module the structure of a wasm module, the functions, tables, memories and globals
+// are the ones defined by the module, imports excluded
+type Module struct {
+	Sections []Section
+	Types    []FuncType
+	Imports  []Import
+	// type index of every function
+	Functions []uint32
+	Tables    []Table
+	Memories  []Limits
+	Globals   []Global
+	Exports   []Export
+	// the module has a start function
+	HasStart      bool
+	StartFunction uint32
+	Data          []DataSegment
+	Customs       []CustomSection
+}
+
+// Parse read the structure of a wasm module
+func Parse(code []byte) (*Module, error) {
+	if len(code) < 8 || !bytes.Equal(code[:4], magic) {
+		return nil, fmt.Errorf("not a wasm module, magic number mismatch")
+	}
+	if v := uint32(code[4]) | uint32(code[5])<<8 | uint32(code[6])<<16 | uint32(code[7])<<24; v != version {
+		return nil, fmt.Errorf("unsupported wasm version %d", v)
+	}
+
+	module := &Module{}
+	r := newReader(code, 8)
+	lastOrder := 0
+	for !r.eof() {
+		id, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.readU32()
+		if err != nil {
+			return nil, err
+		}
+		content, err := r.readBytes(int(size))
+		if err != nil {
+			return nil, fmt.Errorf("section %d: %s", id, err.Error())
+		}
+		if id > SectionDataCount {
+			return nil, fmt.Errorf("unknown section id %d", id)
+		}
+		if id != SectionCustom {
+			if sectionOrder(id) <= lastOrder {
+				return nil, fmt.Errorf("section %d out of order or duplicated", id)
+			}
+			lastOrder = sectionOrder(id)
+		}
+		section := Section{ID: id, Offset: r.pos - len(content), Size: len(content)}
+		module.Sections = append(module.Sections, section)
+		if err = module.parseSection(section, newReader(code[:section.Offset+section.Size], section.Offset)); err != nil {
+			return nil, fmt.Errorf("section %d: %s", id, err.Error())
+		}
+	}
+	return module, nil
+}
+
+// sectionOrder the position of a non custom section in the module, the data count section
+// comes between the element section and the code section
+func sectionOrder(id byte) int {
+	if id == SectionDataCount {
+		return int(SectionElement)*2 + 1
+	}
+	return int(id) * 2
+}
+
+// ImportedCount the number of imports of the kind
+func (m *Module) ImportedCount(kind ExternalKind) int {
+	count := 0
+	for _, imp := range m.Imports {
+		if imp.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// SectionAt return the section whose content contains the offset of the module, false if none does
+func (m *Module) SectionAt(offset int) (Section, bool) {
+	for _, section := range m.Sections {
+		if offset >= section.Offset && offset < section.Offset+section.Size {
+			return section, true
+		}
+	}
+	return Section{}, false
+}
+
+// Export return the export of the name, false if the module does not export it
+func (m *Module) Export(name string) (Export, bool) {
+	for _, export := range m.Exports {
+		if export.Name == name {
+			return export, true
+		}
+	}
+	return Export{}, false
+}
+
+func (m *Module) parseSection(section Section, r *reader) error {
+	var err error
+	switch section.ID {
+	case SectionCustom:
+		return m.parseCustom(r)
+	case SectionType:
+		err = m.parseTypes(r)
+	case SectionImport:
+		err = m.parseImports(r)
+	case SectionFunction:
+		err = m.parseFunctions(r)
+	case SectionTable:
+		err = m.parseTables(r)
+	case SectionMemory:
+		err = m.parseMemories(r)
+	case SectionGlobal:
+		err = m.parseGlobals(r)
+	case SectionExport:
+		err = m.parseExports(r)
+	case SectionStart:
+		m.HasStart = true
+		m.StartFunction, err = r.readU32()
+	case SectionData:
+		err = m.parseData(r)
+	default:
+		// element, code and data count sections are not decoded
+		return nil
+	}
+	if err == nil && !r.eof() {
+		err = r.errorf("section size mismatch")
+	}
+	return err
+}
+
+// readCount read the length of the vector starting the section
+func readCount(r *reader) (int, error) {
+	n, err := r.readU32()
+	return int(n), err
+}
+
+func (m *Module) parseImports(r *reader) error {
+	count, err := readCount(r)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		var imp Import
+		if imp.Module, err = r.readName(); err != nil {
+			return err
+		}
+		if imp.Name, err = r.readName(); err != nil {
+			return err
+		}
+		kind, err := r.readByte()
+		if err != nil {
+			return err
+		}
+		imp.Kind = ExternalKind(kind)
+		switch imp.Kind {
+		case KindFunction:
+			imp.TypeIndex, err = r.readU32()
+		case KindTable:
+			var table Table
+			if table, err = r.readTable(); err == nil {
+				imp.ElemType, imp.Limits = table.ElemType, table.Limits
+			}
+		case KindMemory:
+			imp.Limits, err = r.readLimits()
+		case KindGlobal:
+			imp.Global, err = r.readGlobalType()
+		default:
+			err = r.errorf("invalid import kind %d", kind)
+		}
+		if err != nil {
+			return err
+		}
+		m.Imports = append(m.Imports, imp)
+	}
+	return nil
+}
+
+func (m *Module) parseMemories(r *reader) error {
+	count, err := readCount(r)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		limits, err := r.readLimits()
+		if err != nil {
+			return err
+		}
+		m.Memories = append(m.Memories, limits)
+	}
+	return nil
+}
+
+func (m *Module) parseExports(r *reader) error {
+	count, err := readCount(r)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		var export Export
+		if export.Name, err = r.readName(); err != nil {
+			return err
+		}
+		kind, err := r.readByte()
+		if err != nil {
+			return err
+		}
+		if kind > byte(KindGlobal) {
+			return r.errorf("invalid export kind %d", kind)
+		}
+		export.Kind = ExternalKind(kind)
+		if export.Index, err = r.readU32(); err != nil {
+			return err
+		}
+		m.Exports = append(m.Exports, export)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmparser
+
+import (
+	"bytes"
+	"testing"
+)
+
+// section encode a section with its content
+func section(id byte, content ...byte) []byte {
+	return append([]byte{id, byte(len(content))}, content...)
+}
+
+func header() []byte {
+	return []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+}
+
+func TestParse(t *testing.T) {
+	code := header()
+	// type: () -> (), (i32) -> (i64)
+	code = append(code, section(SectionType, 0x02, 0x60, 0x00, 0x00, 0x60, 0x01, 0x7f, 0x01, 0x7e)...)
+	// import: env.sys_call func 0
+	code = append(code, section(SectionImport, 0x01,
+		0x03, 'e', 'n', 'v', 0x08, 's', 'y', 's', '_', 'c', 'a', 'l', 'l', 0x00, 0x00)...)
+	// function: 2 functions of type 0 and 1
+	code = append(code, section(SectionFunction, 0x02, 0x00, 0x01)...)
+	// memory: min 17, max 300 (0xac 0x02)
+	code = append(code, section(SectionMemory, 0x01, 0x01, 0x11, 0xac, 0x02)...)
+	// global: mutable i32 = 1024 (0x80 0x08)
+	code = append(code, section(SectionGlobal, 0x01, 0x7f, 0x01, 0x41, 0x80, 0x08, 0x0b)...)
+	// export: "allocate" func 1
+	code = append(code, section(SectionExport, 0x01,
+		0x08, 'a', 'l', 'l', 'o', 'c', 'a', 't', 'e', 0x00, 0x01)...)
+	// start: func 1
+	code = append(code, section(SectionStart, 0x01)...)
+	// data: active at i32.const 8, "hi"
+	code = append(code, section(SectionData, 0x01, 0x00, 0x41, 0x08, 0x0b, 0x02, 'h', 'i')...)
+	// custom: sdk metadata
+	sdk := `{"name":"contract-sdk-rust","version":"v2.1.0"}`
+	code = append(code, section(SectionCustom, append(append([]byte{byte(len(SDKSection))}, SDKSection...), sdk...)...)...)
+
+	module, err := Parse(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(module.Imports) != 1 || module.Imports[0].Module != "env" || module.Imports[0].Name != "sys_call" ||
+		module.Imports[0].Kind != KindFunction {
+		t.Fatalf("unexpected imports %+v", module.Imports)
+	}
+	if len(module.Functions) != 2 || module.ImportedCount(KindFunction) != 1 {
+		t.Fatalf("unexpected functions %v", module.Functions)
+	}
+	if funcType, err := module.FuncType(2); err != nil || funcType.String() != "[i32] -> [i64]" {
+		t.Fatalf("unexpected type of function 2 %s, %v", funcType, err)
+	}
+	if len(module.Memories) != 1 || module.Memories[0] != (Limits{Min: 17, Max: 300, HasMax: true}) {
+		t.Fatalf("unexpected memories %+v", module.Memories)
+	}
+	if export, ok := module.Export("allocate"); !ok || export.Kind != KindFunction || export.Index != 1 {
+		t.Fatalf("unexpected exports %+v", module.Exports)
+	}
+	if !module.HasStart || module.StartFunction != 1 {
+		t.Fatalf("start function not found")
+	}
+	if len(module.Globals) != 1 || !module.Globals[0].Mutable || module.Globals[0].Type != ValueTypeI32 ||
+		!bytes.Equal(module.Globals[0].Init, []byte{0x41, 0x80, 0x08}) {
+		t.Fatalf("unexpected globals %+v", module.Globals)
+	}
+	if len(module.Data) != 1 || module.Data[0].Passive || string(module.Data[0].Init) != "hi" {
+		t.Fatalf("unexpected data %+v", module.Data)
+	}
+	metadata, err := module.SDKMetadata()
+	if err != nil || metadata == nil || metadata.Name != "contract-sdk-rust" || metadata.Version != "v2.1.0" {
+		t.Fatalf("unexpected sdk metadata %+v, %v", metadata, err)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	cases := map[string][]byte{
+		"magic":       {0x00, 0x61, 0x73, 0x00, 0x01, 0x00, 0x00, 0x00},
+		"version":     {0x00, 0x61, 0x73, 0x6d, 0x02, 0x00, 0x00, 0x00},
+		"truncated":   append(header(), SectionType, 0x05, 0x01),
+		"order":       append(append(header(), section(SectionExport, 0x00)...), section(SectionImport, 0x00)...),
+		"unknown id":  append(header(), section(0x20)...),
+		"import kind": append(header(), section(SectionImport, 0x01, 0x00, 0x00, 0x07)...),
+		"size":        append(header(), section(SectionFunction, 0x01, 0x00, 0x00)...),
+		"global init": append(header(), section(SectionGlobal, 0x01, 0x7f, 0x00, 0x20, 0x00, 0x0b)...),
+	}
+	for name, code := range cases {
+		if _, err := Parse(code); err == nil {
+			t.Errorf("%s: expect error, but parsed", name)
+		}
+	}
+}
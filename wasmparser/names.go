@@ -0,0 +1,92 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmparser
+
+import (
+	"fmt"
+)
+
+// NameSection the custom section of the debug names of the module
+const NameSection = "name"
+
+// subsections of the name section
+const (
+	nameSubsectionModule   byte = 0
+	nameSubsectionFunction byte = 1
+)
+
+// Names the debug names of the module, the other subsections (locals, labels...) are skipped
+type Names struct {
+	Module string
+	// function index (imports first) -> name
+	Functions map[uint32]string
+}
+
+// Function return the name of the function, "function[<index>]" if it has none
+func (n *Names) Function(function uint32) string {
+	if n != nil {
+		if name, ok := n.Functions[function]; ok {
+			return name
+		}
+	}
+	return fmt.Sprintf("function[%d]", function)
+}
+
+// Names decode the name section of the module, nil if the module has none
+func (m *Module) Names() (*Names, error) {
+	custom, ok := m.Custom(NameSection)
+	if !ok {
+		return nil, nil
+	}
+	names := &Names{Functions: make(map[uint32]string)}
+	r := newReader(custom.Data, 0)
+	for !r.eof() {
+		id, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := readCount(r)
+		if err != nil {
+			return nil, err
+		}
+		content, err := r.readBytes(size)
+		if err != nil {
+			return nil, err
+		}
+		sub := newReader(content, 0)
+		switch id {
+		case nameSubsectionModule:
+			names.Module, err = sub.readName()
+		case nameSubsectionFunction:
+			err = names.parseFunctions(sub)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s section, subsection %d: %s", NameSection, id, err.Error())
+		}
+	}
+	return names, nil
+}
+
+func (n *Names) parseFunctions(r *reader) error {
+	count, err := readCount(r)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		function, err := r.readU32()
+		if err != nil {
+			return err
+		}
+		name, err := r.readName()
+		if err != nil {
+			return err
+		}
+		n.Functions[function] = name
+	}
+	return nil
+}
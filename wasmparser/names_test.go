@@ -0,0 +1,38 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmparser
+
+import (
+	"testing"
+)
+
+func TestNames(t *testing.T) {
+	names := []byte{byte(len(NameSection))}
+	names = append(names, NameSection...)
+	// module name "token"
+	names = append(names, nameSubsectionModule, 0x06, 0x05, 't', 'o', 'k', 'e', 'n')
+	// local names of function 0 are skipped
+	names = append(names, 0x02, 0x03, 0x01, 0x00, 0x00)
+	// function 1 "transfer"
+	names = append(names, nameSubsectionFunction, 0x0b, 0x01, 0x01, 0x08, 't', 'r', 'a', 'n', 's', 'f', 'e', 'r')
+	module, err := Parse(append(header(), section(SectionCustom, names...)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := module.Names()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Module != "token" || decoded.Function(1) != "transfer" || decoded.Function(2) != "function[2]" {
+		t.Fatalf("unexpected names %+v", decoded)
+	}
+	if lines, err := module.Lines(); lines != nil || err != nil {
+		t.Fatalf("expect no line table, but got %v, %v", lines, err)
+	}
+}
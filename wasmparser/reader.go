@@ -0,0 +1,122 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmparser
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// reader reads the binary encoding of a wasm module
+type reader struct {
+	data []byte
+	// offset of the next byte in the module
+	pos int
+}
+
+func newReader(data []byte, offset int) *reader {
+	return &reader{data: data, pos: offset}
+}
+
+func (r *reader) eof() bool {
+	return r.pos >= len(r.data)
+}
+
+func (r *reader) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("offset %d: %s", r.pos, fmt.Sprintf(format, args...))
+}
+
+func (r *reader) readByte() (byte, error) {
+	if r.eof() {
+		return 0, r.errorf("unexpected end")
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *reader) readBytes(n int) ([]byte, error) {
+	if n < 0 || n > len(r.data)-r.pos {
+		return nil, r.errorf("unexpected end, %d bytes expected", n)
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// readU32 read an unsigned LEB128 32-bit integer
+func (r *reader) readU32() (uint32, error) {
+	var result uint32
+	for shift := uint(0); shift < 35; shift += 7 {
+		b, err := r.readByte()
+		if err != nil {
+			return 0, err
+		}
+		if shift == 28 && b&0x70 != 0 {
+			return 0, r.errorf("u32 overflow")
+		}
+		result |= uint32(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return result, nil
+		}
+	}
+	return 0, r.errorf("u32 too long")
+}
+
+// readSigned skip a signed LEB128 integer of at most bits bits
+func (r *reader) readSigned(bits uint) error {
+	for shift := uint(0); shift < bits; shift += 7 {
+		b, err := r.readByte()
+		if err != nil {
+			return err
+		}
+		if b&0x80 == 0 {
+			return nil
+		}
+	}
+	return r.errorf("signed integer too long")
+}
+
+// readName read a length prefixed utf-8 name
+func (r *reader) readName() (string, error) {
+	n, err := r.readU32()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.readBytes(int(n))
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(b) {
+		return "", r.errorf("name is not valid utf-8")
+	}
+	return string(b), nil
+}
+
+// readLimits read the limits of a memory or a table
+func (r *reader) readLimits() (Limits, error) {
+	flag, err := r.readByte()
+	if err != nil {
+		return Limits{}, err
+	}
+	if flag > 0x03 {
+		return Limits{}, r.errorf("invalid limits flag 0x%x", flag)
+	}
+	var limits Limits
+	if limits.Min, err = r.readU32(); err != nil {
+		return Limits{}, err
+	}
+	limits.Shared = flag&0x02 != 0
+	if flag&0x01 != 0 {
+		limits.HasMax = true
+		if limits.Max, err = r.readU32(); err != nil {
+			return Limits{}, err
+		}
+	}
+	return limits, nil
+}
@@ -0,0 +1,38 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmparser
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SDKSection name of the custom section the contract sdk embeds its metadata in, a json object
+const SDKSection = "chainmaker_sdk"
+
+// SDKMetadata the contract sdk the module is built with
+type SDKMetadata struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Language string `json:"language,omitempty"`
+	// version of the sys_call protocol, 0 if not declared
+	AbiVersion int32 `json:"abi_version,omitempty"`
+}
+
+// SDKMetadata return the sdk metadata embedded in the module, nil if the module has none
+func (m *Module) SDKMetadata() (*SDKMetadata, error) {
+	custom, ok := m.Custom(SDKSection)
+	if !ok {
+		return nil, nil
+	}
+	metadata := &SDKMetadata{}
+	if err := json.Unmarshal(custom.Data, metadata); err != nil {
+		return nil, fmt.Errorf("invalid %s section, %s", SDKSection, err.Error())
+	}
+	return metadata, nil
+}
@@ -0,0 +1,315 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package wasmparser
+
+import (
+	"fmt"
+)
+
+// ValueType a wasm value type
+type ValueType byte
+
+const (
+	ValueTypeI32       = ValueType(valueTypeI32)
+	ValueTypeI64       = ValueType(valueTypeI64)
+	ValueTypeF32       = ValueType(valueTypeF32)
+	ValueTypeF64       = ValueType(valueTypeF64)
+	ValueTypeV128      = ValueType(valueTypeV128)
+	ValueTypeFuncRef   = ValueType(refTypeFunc)
+	ValueTypeExternRef = ValueType(refTypeExtern)
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case ValueTypeI32:
+		return "i32"
+	case ValueTypeI64:
+		return "i64"
+	case ValueTypeF32:
+		return "f32"
+	case ValueTypeF64:
+		return "f64"
+	case ValueTypeV128:
+		return "v128"
+	case ValueTypeFuncRef:
+		return "funcref"
+	case ValueTypeExternRef:
+		return "externref"
+	}
+	return fmt.Sprintf("type_0x%02x", byte(t))
+}
+
+// FuncType the signature of a function
+type FuncType struct {
+	Params  []ValueType
+	Results []ValueType
+}
+
+func (t FuncType) String() string {
+	return fmt.Sprintf("%v -> %v", t.Params, t.Results)
+}
+
+// Table a table of references
+type Table struct {
+	ElemType ValueType
+	Limits   Limits
+}
+
+// GlobalType the type of a global
+type GlobalType struct {
+	Type    ValueType
+	Mutable bool
+}
+
+// Global a global defined by the module
+type Global struct {
+	GlobalType
+	// constant expression of the initial value, the end opcode excluded
+	Init []byte
+}
+
+// DataSegment a data segment of the module
+type DataSegment struct {
+	// a passive segment is copied by memory.init, an active one at instantiation
+	Passive bool
+	Memory  uint32
+	// constant expression of the offset of an active segment, the end opcode excluded
+	Offset []byte
+	Init   []byte
+}
+
+// CustomSection a custom section of the module
+type CustomSection struct {
+	Name string
+	Data []byte
+}
+
+// Custom return the first custom section of the name, false if the module has none
+func (m *Module) Custom(name string) (CustomSection, bool) {
+	for _, custom := range m.Customs {
+		if custom.Name == name {
+			return custom, true
+		}
+	}
+	return CustomSection{}, false
+}
+
+// FuncType return the signature of the function in the function index space (imports first)
+func (m *Module) FuncType(function uint32) (FuncType, error) {
+	typeIndex := uint32(0)
+	imported := uint32(m.ImportedCount(KindFunction))
+	if function < imported {
+		for _, imp := range m.Imports {
+			if imp.Kind != KindFunction {
+				continue
+			}
+			if function == 0 {
+				typeIndex = imp.TypeIndex
+				break
+			}
+			function--
+		}
+	} else if function-imported < uint32(len(m.Functions)) {
+		typeIndex = m.Functions[function-imported]
+	} else {
+		return FuncType{}, fmt.Errorf("function %d not found", function)
+	}
+	if typeIndex >= uint32(len(m.Types)) {
+		return FuncType{}, fmt.Errorf("type %d of function %d not found", typeIndex, function)
+	}
+	return m.Types[typeIndex], nil
+}
+
+func (r *reader) readValueTypes() ([]ValueType, error) {
+	count, err := readCount(r)
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.readBytes(count)
+	if err != nil {
+		return nil, err
+	}
+	types := make([]ValueType, count)
+	for i := range b {
+		types[i] = ValueType(b[i])
+	}
+	return types, nil
+}
+
+func (r *reader) readTable() (Table, error) {
+	elemType, err := r.readByte()
+	if err != nil {
+		return Table{}, err
+	}
+	limits, err := r.readLimits()
+	return Table{ElemType: ValueType(elemType), Limits: limits}, err
+}
+
+func (r *reader) readGlobalType() (GlobalType, error) {
+	b, err := r.readBytes(2)
+	if err != nil {
+		return GlobalType{}, err
+	}
+	if b[1] > 1 {
+		return GlobalType{}, r.errorf("invalid global mutability %d", b[1])
+	}
+	return GlobalType{Type: ValueType(b[0]), Mutable: b[1] == 1}, nil
+}
+
+// readConstExpr read a constant expression, return it without the end opcode
+func (r *reader) readConstExpr() ([]byte, error) {
+	start := r.pos
+	for {
+		op, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case 0x0b: // end
+			return r.data[start : r.pos-1], nil
+		case 0x41: // i32.const
+			err = r.readSigned(32)
+		case 0x42: // i64.const
+			err = r.readSigned(64)
+		case 0x43: // f32.const
+			_, err = r.readBytes(4)
+		case 0x44: // f64.const
+			_, err = r.readBytes(8)
+		case 0x23, 0xd2: // global.get, ref.func
+			_, err = r.readU32()
+		case 0xd0: // ref.null
+			_, err = r.readByte()
+		case 0x6a, 0x6b, 0x6c, 0x7c, 0x7d, 0x7e: // extended constant arithmetic
+		default:
+			return nil, r.errorf("opcode 0x%02x is not constant", op)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (m *Module) parseCustom(r *reader) error {
+	name, err := r.readName()
+	if err != nil {
+		return err
+	}
+	m.Customs = append(m.Customs, CustomSection{Name: name, Data: r.data[r.pos:]})
+	return nil
+}
+
+func (m *Module) parseTypes(r *reader) error {
+	count, err := readCount(r)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		form, err := r.readByte()
+		if err != nil {
+			return err
+		}
+		if form != 0x60 {
+			return r.errorf("invalid function type form 0x%02x", form)
+		}
+		var funcType FuncType
+		if funcType.Params, err = r.readValueTypes(); err != nil {
+			return err
+		}
+		if funcType.Results, err = r.readValueTypes(); err != nil {
+			return err
+		}
+		m.Types = append(m.Types, funcType)
+	}
+	return nil
+}
+
+func (m *Module) parseFunctions(r *reader) error {
+	count, err := readCount(r)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		typeIndex, err := r.readU32()
+		if err != nil {
+			return err
+		}
+		m.Functions = append(m.Functions, typeIndex)
+	}
+	return nil
+}
+
+func (m *Module) parseTables(r *reader) error {
+	count, err := readCount(r)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		table, err := r.readTable()
+		if err != nil {
+			return err
+		}
+		m.Tables = append(m.Tables, table)
+	}
+	return nil
+}
+
+func (m *Module) parseGlobals(r *reader) error {
+	count, err := readCount(r)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		var global Global
+		if global.GlobalType, err = r.readGlobalType(); err != nil {
+			return err
+		}
+		if global.Init, err = r.readConstExpr(); err != nil {
+			return err
+		}
+		m.Globals = append(m.Globals, global)
+	}
+	return nil
+}
+
+func (m *Module) parseData(r *reader) error {
+	count, err := readCount(r)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		flag, err := r.readU32()
+		if err != nil {
+			return err
+		}
+		var segment DataSegment
+		switch flag {
+		case 0:
+		case 1:
+			segment.Passive = true
+		case 2:
+			segment.Memory, err = r.readU32()
+		default:
+			return r.errorf("invalid data segment flag %d", flag)
+		}
+		if err == nil && !segment.Passive {
+			segment.Offset, err = r.readConstExpr()
+		}
+		if err != nil {
+			return err
+		}
+		size, err := readCount(r)
+		if err != nil {
+			return err
+		}
+		if segment.Init, err = r.readBytes(size); err != nil {
+			return err
+		}
+		m.Data = append(m.Data, segment)
+	}
+	return nil
+}
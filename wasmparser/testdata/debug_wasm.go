@@ -0,0 +1,113 @@
+//go:build ignore
+// +build ignore
+
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// debug_wasm generates debug.wasm, a module with a name section and a DWARF 4 line table:
+//
+//	go run debug_wasm.go
+//
+// function 0 is the import env.sys_call, functions 1 "allocate" and 2 "invoke" are exported.
+// the line table maps the nop of allocate (offset 3 in the code section content) to /src/lib.rs:3:5
+// and the unreachable of invoke (offset 9) to /src/lib.rs:8:9, the sequence ends at offset 11
+package main
+
+import (
+	"io/ioutil"
+	"log"
+)
+
+func uleb(n int) []byte {
+	var b []byte
+	for {
+		c := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+func name(s string) []byte {
+	return append(uleb(len(s)), s...)
+}
+
+func section(id byte, content ...byte) []byte {
+	return append(append([]byte{id}, uleb(len(content))...), content...)
+}
+
+func custom(sectionName string, content ...byte) []byte {
+	return section(0x00, append(name(sectionName), content...)...)
+}
+
+func u32(n int) []byte {
+	return []byte{byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24)}
+}
+
+// unit prefix the content with its 32-bit DWARF unit length
+func unit(content ...byte) []byte {
+	return append(u32(len(content)), content...)
+}
+
+func main() {
+	code := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	// type 0: () -> ()
+	code = append(code, section(0x01, 0x01, 0x60, 0x00, 0x00)...)
+	code = append(code, section(0x02, append(append([]byte{0x01}, name("env")...), append(name("sys_call"), 0x00, 0x00)...)...)...)
+	code = append(code, section(0x03, 0x02, 0x00, 0x00)...)
+	exports := []byte{0x02}
+	exports = append(append(exports, name("allocate")...), 0x00, 0x01)
+	exports = append(append(exports, name("invoke")...), 0x00, 0x02)
+	code = append(code, section(0x07, exports...)...)
+	// allocate: nop; invoke: one i32 local, unreachable
+	code = append(code, section(0x0a, 0x02,
+		0x03, 0x00, 0x01, 0x0b,
+		0x05, 0x01, 0x01, 0x7f, 0x00, 0x0b)...)
+
+	functions := []byte{0x03}
+	for index, function := range []string{"sys_call", "allocate", "invoke"} {
+		functions = append(append(functions, byte(index)), name(function)...)
+	}
+	code = append(code, custom("name", append([]byte{0x01}, append(uleb(len(functions)), functions...)...)...)...)
+
+	// compile unit: name, stmt_list, comp_dir
+	code = append(code, custom(".debug_abbrev", 0x01, 0x11, 0x00, 0x03, 0x08, 0x10, 0x17, 0x1b, 0x08, 0x00, 0x00, 0x00)...)
+	info := []byte{0x04, 0x00}
+	info = append(info, u32(0)...)
+	info = append(info, 0x04, 0x01)
+	info = append(info, "lib.rs\x00"...)
+	info = append(info, u32(0)...)
+	info = append(info, "/src\x00"...)
+	code = append(code, custom(".debug_info", unit(info...)...)...)
+
+	header := []byte{0x01, 0x01, 0x01, 0xfb, 0x0e, 0x0d, 0x00, 0x01, 0x01, 0x01, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x01}
+	// no include directory, file lib.rs in the compilation directory
+	header = append(header, 0x00)
+	header = append(header, "lib.rs\x00"...)
+	header = append(header, 0x00, 0x00, 0x00, 0x00)
+	program := []byte{
+		0x00, 0x05, 0x02, 0x03, 0x00, 0x00, 0x00, // set_address 3
+		0x05, 0x05, // set_column 5
+		0x03, 0x02, // advance_line 2, line 3
+		0x01,       // copy
+		0x02, 0x06, // advance_pc 6, address 9
+		0x05, 0x09, // set_column 9
+		0x03, 0x05, // advance_line 5, line 8
+		0x01,       // copy
+		0x02, 0x02, // advance_pc 2, address 11
+		0x00, 0x01, 0x01, // end_sequence
+	}
+	line := append([]byte{0x04, 0x00}, u32(len(header))...)
+	line = append(append(line, header...), program...)
+	code = append(code, custom(".debug_line", unit(line...)...)...)
+
+	if err := ioutil.WriteFile("debug.wasm", code, 0644); err != nil {
+		log.Fatal(err)
+	}
+}